@@ -1,9 +1,17 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+
 	"github.com/opencredo/smokeshift/pkg/config"
+	"github.com/opencredo/smokeshift/pkg/report"
 	"github.com/opencredo/smokeshift/pkg/smokeshift"
+	"github.com/opencredo/smokeshift/pkg/util"
 	"github.com/spf13/cobra"
 
 )
@@ -11,6 +19,7 @@ import (
 // NewKismaticCommand creates the kismatic command
 func NewSmokeshiftCommand(version string, in io.Reader, out io.Writer) *cobra.Command {
 	var skipCleanup bool
+	var outputFormat string
 	cmd := &cobra.Command{
 		Use:   "smokeshift",
 		SilenceUsage:  true,
@@ -22,7 +31,7 @@ creates a Project (smoketest), deploys an Nginx Pod on to each Node, provisions
 using DNS and IP based connections to the Nginx Pods. Unless the 'skip-cleanup' flag is set all Pods, Services and the
 smokeshift Project are deleted on completion`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return doCheckOpenshift(skipCleanup)
+			return doCheckOpenshift(out, skipCleanup, outputFormat)
 		},
 
 	}
@@ -32,10 +41,201 @@ smokeshift Project are deleted on completion`,
 	cmd.PersistentFlags().StringVar(&config.RegistryURL, "registry-url", "",
 		"Override the default Docker Hub URL to use a local offline registry for required Docker images.")
 	cmd.Flags().BoolVar(&skipCleanup, "skip-cleanup", false, "Don't clean up. Leave all deployed artifacts running on the cluster.")
+	cmd.Flags().StringVarP(&outputFormat, "output", "o", "text",
+		"Output format: 'text' prints a report as the checks run, 'json' and 'junit' print a single JSON or JUnit XML document once the run completes.")
+	cmd.PersistentFlags().StringVar(&config.Backend, "backend", "oc",
+		"How to talk to the cluster: 'oc' shells out to the oc CLI, 'api' talks to the API server directly using the kubeconfig.")
+	cmd.PersistentFlags().StringVar(&config.Kubeconfig, "kubeconfig", "",
+		"Path to the kubeconfig used by the 'api' backend. Defaults to $KUBECONFIG or ~/.kube/config.")
+	cmd.PersistentFlags().DurationVar(&config.Timeout, "timeout", 0,
+		"Give up on the whole run after this long, e.g. 10m. Zero means no limit. Cleanup still runs after a timeout.")
+	cmd.PersistentFlags().DurationVar(&config.CallTimeout, "call-timeout", 2*time.Minute,
+		"Give up on a single oc invocation after this long. Zero means no limit.")
+	cmd.Flags().DurationVar(&config.CleanupTimeout, "cleanup-timeout", 2*time.Minute,
+		"Give up on cleanup after this long. Cleanup runs after --timeout or an interrupt, a second interrupt skips it. Zero means no limit.")
+	cmd.PersistentFlags().DurationVar(&config.HTTPTimeout, "http-timeout", time.Second,
+		"Give up on a single HTTP probe from this machine after this long.")
+	cmd.PersistentFlags().StringSliceVar(&config.Only, "only", nil,
+		"Only run the checks with these names or tags, e.g. --only=network,dns. See 'smokeshift list-checks'.")
+	cmd.PersistentFlags().StringSliceVar(&config.Skip, "skip", nil,
+		"Don't run the checks with these names or tags, e.g. --skip=egress.")
+	cmd.Flags().BoolVar(&config.Strict, "strict", false,
+		"Fail the run with exit code 2 when an advisory check fails.")
+	cmd.Flags().StringArrayVar(&config.EgressTargets, "egress-target", nil,
+		"URL that should be reachable from the cluster and this machine, optionally followed by =STATUS for the expected status, e.g. https://registry.example.com/v2/=401. Can be repeated. Defaults to http://google.com/.")
+	cmd.Flags().StringVar(&config.HTTPProxy, "http-proxy", "", "Proxy for http egress targets. Defaults to $HTTP_PROXY.")
+	cmd.Flags().StringVar(&config.HTTPSProxy, "https-proxy", "", "Proxy for https egress targets. Defaults to $HTTPS_PROXY.")
+	cmd.Flags().StringVar(&config.NoProxy, "no-proxy", "", "Comma separated hosts and domains egress targets are fetched from directly. Defaults to $NO_PROXY.")
+	cmd.Flags().StringVar(&config.RouterCA, "router-ca", "",
+		"PEM CA bundle the certificates served by TLS routes are verified against. Defaults to the system roots.")
+	cmd.PersistentFlags().BoolVar(&config.Mesh, "mesh", false,
+		"Run a client pod on every node and access every Nginx pod from each of them, reporting a node by node matrix.")
+	cmd.Flags().StringArrayVar(&config.StorageClasses, "storage-class", nil,
+		"StorageClass the storage check provisions a claim from, \"all\" for every StorageClass. Can be repeated. Defaults to the default StorageClass.")
+	cmd.Flags().BoolVar(&config.StorageRemount, "storage-remount", false,
+		"Remount the storage check's claim in a pod on another node and read the payload back.")
+	cmd.Flags().StringVar(&config.SDNMode, "sdn-mode", "",
+		"SDN plugin mode: subnet, multitenant or networkpolicy. Detected from the cluster network if empty.")
+	cmd.Flags().StringSliceVar(&config.IsolationExpectations, "isolation-expect", nil,
+		"Whether projects are isolated or open under an SDN mode, e.g. networkpolicy=isolated when new projects get a default deny policy. Defaults to isolated for multitenant, open otherwise.")
+	cmd.Flags().BoolVar(&config.JoinProjects, "join-projects", false,
+		"Join the pod networks of the isolation check's projects and expect them to reach each other afterwards (multitenant only).")
+	cmd.Flags().BoolVar(&config.Restricted, "restricted", false,
+		"Run as a project admin: unprivileged images under the restricted SCC, checks needing cluster-scoped access are skipped.")
+	cmd.Flags().StringSliceVar(&config.APIEndpoints, "api-endpoint", nil,
+		"API server URL to probe the health endpoints of, e.g. https://master1.example.com:8443. Can be repeated. Defaults to the endpoints of the kubernetes service.")
+	cmd.Flags().IntVar(&config.APILatencyRequests, "api-latency-requests", 20,
+		"Number of reads the api-latency check times to report latency percentiles.")
+	cmd.Flags().BoolVar(&config.CollectDiagnostics, "collect-diagnostics", false,
+		"Write a tarball of the project's objects, pod logs and events, the nodes, the oc commands run and the report before cleaning up.")
+	cmd.PersistentFlags().StringVar(&config.DiagnosticsFile, "diagnostics-file", "",
+		"Where to write the diagnostics tarball. Defaults to smokeshift-diagnostics-TIME.tar.gz in the current directory.")
+
+	cmd.AddCommand(NewListChecksCommand(out))
+	cmd.AddCommand(NewGatherCommand(out))
 
 	return cmd
 }
 
-func doCheckOpenshift(skipCleanup bool) error {
-	return smokeshift.CheckOpenshift(skipCleanup)
+// NewListChecksCommand creates the list-checks command
+func NewListChecksCommand(out io.Writer) *cobra.Command {
+	return &cobra.Command{
+		Use:   "list-checks",
+		Short: "List the checks smokeshift runs",
+		Long: `List every check with its tags, severity and description. Failures of required checks fail the run,
+failures of advisory checks are reported but ignored. The --only and --skip flags narrow the list down to the
+checks that would run, pod-mesh only runs with --mesh or when --only names it.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return doListChecks(out)
+		},
+	}
+}
+
+func doListChecks(out io.Writer) error {
+	checks, err := smokeshift.SelectChecks()
+	if err != nil {
+		return err
+	}
+	rows := [][]string{}
+	for _, c := range checks.Checks() {
+		rows = append(rows, []string{c.Name(), strings.Join(c.Tags(), ","), string(c.Severity()), c.Description()})
+	}
+	util.PrintTable(out, []string{"name", "tags", "severity", "description"}, rows)
+	return nil
+}
+
+// NewGatherCommand creates the gather command
+func NewGatherCommand(out io.Writer) *cobra.Command {
+	return &cobra.Command{
+		Use:   "gather",
+		Short: "Write a diagnostics tarball of the smokeshift project",
+		Long: `Write a tarball of what a run left in the smokeshift project, e.g. after --skip-cleanup or when it was
+interrupted: every object as YAML and described, the logs of every container, the project events, a summary of the
+nodes and the oc commands gather ran. Runs collect the same tarball, with their report, with --collect-diagnostics.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return doGather(out)
+		},
+	}
+}
+
+func doGather(out io.Writer) error {
+	executor, err := newExecutor()
+	if err != nil {
+		return err
+	}
+	ctx, stop := cancelOnSignal(context.Background())
+	defer stop()
+	if config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, config.Timeout)
+		defer cancel()
+	}
+	path, err := smokeshift.Gather(ctx, executor)
+	if err != nil {
+		return err
+	}
+	util.PrettyPrintInfo(out, "Diagnostics written to %s", path)
+	return nil
+}
+
+func doCheckOpenshift(out io.Writer, skipCleanup bool, outputFormat string) error {
+	progress := out
+	switch outputFormat {
+	case "text":
+	case "json", "junit":
+		// Only the final document goes to out so it can be parsed
+		progress = ioutil.Discard
+	default:
+		return fmt.Errorf("unknown output format %q, expected 'text', 'json' or 'junit'", outputFormat)
+	}
+	for _, target := range config.EgressTargets {
+		if _, err := smokeshift.ParseEgressTarget(target); err != nil {
+			return err
+		}
+	}
+	if _, err := smokeshift.ParseIsolationExpectations(config.IsolationExpectations); err != nil {
+		return err
+	}
+	executor, err := newExecutor()
+	if err != nil {
+		return err
+	}
+	ctx, stop := cancelOnSignal(context.Background())
+	defer stop()
+	if config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, config.Timeout)
+		defer cancel()
+	}
+	rep, err := smokeshift.CheckOpenshift(ctx, executor, progress, skipCleanup)
+	var writeErr error
+	switch outputFormat {
+	case "json":
+		writeErr = report.WriteJSON(out, rep)
+	case "junit":
+		writeErr = report.WriteJUnit(out, rep, config.Strict)
+	}
+	if writeErr != nil {
+		return writeErr
+	}
+	if err != nil {
+		return exitError{code: rep.ExitCode(config.Strict), err: err}
+	}
+	return nil
+}
+
+// exitError carries the exit code documented for the way a run failed
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e exitError) Error() string {
+	return e.err.Error()
+}
+
+// exitCode returns the code to exit with after err, errors that did not
+// come from a run, e.g. bad flags, exit with 1
+func exitCode(err error) int {
+	if e, ok := err.(exitError); ok {
+		return e.code
+	}
+	return 1
+}
+
+// newExecutor creates the Executor of the --backend the run talks to the
+// cluster with
+func newExecutor() (smokeshift.Executor, error) {
+	switch config.Backend {
+	case "oc", "":
+		return smokeshift.OCExecutor{}, nil
+	case "api":
+		executor, err := smokeshift.NewAPIExecutor(config.Kubeconfig)
+		if err != nil {
+			return nil, err
+		}
+		return executor, nil
+	default:
+		return nil, fmt.Errorf("unknown backend %q, expected 'oc' or 'api'", config.Backend)
+	}
 }
@@ -14,6 +14,6 @@ func main() {
 
 	if err := cmd.Execute(); err != nil {
 		util.PrintColor(os.Stderr, util.Red, "Error running command: %v\n", err)
-		os.Exit(1)
+		os.Exit(exitCode(err))
 	}
 }
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/opencredo/smokeshift/pkg/config"
+	"github.com/opencredo/smokeshift/pkg/report"
+	"github.com/opencredo/smokeshift/pkg/util"
+)
+
+// cancelOnSignal returns a context cancelled on the first SIGINT or SIGTERM,
+// which stops the oc calls in flight and lets the run clean up. A second
+// signal exits straight away, leaving the project behind. The returned
+// function stops listening for signals.
+func cancelOnSignal(ctx context.Context) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case sig := <-signals:
+			util.PrintColor(os.Stderr, util.Orange, "Received %s, stopping the run and cleaning up, send it again to exit straight away\n", sig)
+			cancel()
+		case <-done:
+			return
+		}
+		select {
+		case sig := <-signals:
+			util.PrintColor(os.Stderr, util.Red, "Received %s again, exiting without cleaning up, project %s may be left behind\n", sig, config.Namespace)
+			os.Exit(report.ExitInterrupted)
+		case <-done:
+		}
+	}()
+	return ctx, func() {
+		signal.Stop(signals)
+		close(done)
+		cancel()
+	}
+}
@@ -1,6 +1,68 @@
 package config
 
+import "time"
+
 var (
 	Namespace   string
 	RegistryURL string
+	Backend     string
+	Kubeconfig  string
+	// Timeout bounds the whole run, zero means no limit
+	Timeout time.Duration
+	// CallTimeout bounds every single oc invocation
+	CallTimeout time.Duration
+	// CleanupTimeout bounds cleanup, which runs after the run's own
+	// deadline or an interrupt. Zero means no limit.
+	CleanupTimeout time.Duration
+	// HTTPTimeout bounds every HTTP probe made from this machine
+	HTTPTimeout time.Duration
+	// Only selects the checks to run by name or tag, empty runs all checks
+	Only []string
+	// Skip deselects checks by name or tag
+	Skip []string
+	// Strict fails the run when an advisory check fails
+	Strict bool
+	// RouterCA is the CA bundle the certificates served by TLS routes are
+	// verified against, the system roots are used if empty
+	RouterCA string
+	// EgressTargets are URL[=STATUS] that should be reachable from the
+	// cluster and this machine, empty means the default targets
+	EgressTargets []string
+	// HTTPProxy, HTTPSProxy and NoProxy are used for the egress targets,
+	// the HTTP_PROXY, HTTPS_PROXY and NO_PROXY variables if empty
+	HTTPProxy  string
+	HTTPSProxy string
+	NoProxy    string
+	// Mesh runs a client pod on every node and probes every Nginx pod from
+	// each of them
+	Mesh bool
+	// StorageClasses are the StorageClasses the storage check provisions a
+	// claim from, "all" for every one, empty means the default StorageClass
+	StorageClasses []string
+	// StorageRemount mounts the storage check's claim again on another node
+	StorageRemount bool
+	// SDNMode is the SDN plugin mode, e.g. multitenant, detected from the
+	// cluster network if empty
+	SDNMode string
+	// IsolationExpectations are MODE=isolated or MODE=open, overriding
+	// whether projects are expected to be isolated under the SDN mode
+	IsolationExpectations []string
+	// JoinProjects joins the pod networks of the projects and expects them
+	// to reach each other afterwards
+	JoinProjects bool
+	// Restricted runs the workloads under the restricted SCC, with
+	// unprivileged images on high ports, and skips whatever needs
+	// cluster-scoped access, for users who only administer their project
+	Restricted bool
+	// APIEndpoints are the API server URLs the api-health check probes
+	// besides the server oc talks to, the kubernetes service endpoints if
+	// empty
+	APIEndpoints []string
+	// APILatencyRequests is how many reads the api-latency check times
+	APILatencyRequests int
+	// CollectDiagnostics writes a diagnostics tarball before cleanup
+	CollectDiagnostics bool
+	// DiagnosticsFile is where the diagnostics tarball is written, a name
+	// with the time in the current directory if empty
+	DiagnosticsFile string
 )
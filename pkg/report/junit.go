@@ -0,0 +1,145 @@
+package report
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// JUnit XML as understood by Jenkins and GitLab. Every phase of the run
+// becomes a test suite and every step a test case. Advisory steps that did
+// not pass are reported as skipped so they show up without failing the build,
+// unless in strict mode where they fail the run and are reported as failures.
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name       string          `xml:"name,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Skipped    int             `xml:"skipped,attr"`
+	Time       string          `xml:"time,attr"`
+	Timestamp  string          `xml:"timestamp,attr"`
+	Hostname   string          `xml:"hostname,attr,omitempty"`
+	Properties []junitProperty `xml:"properties>property,omitempty"`
+	Cases      []junitTestCase `xml:"testcase"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr,omitempty"`
+	Body    string `xml:",chardata"`
+}
+
+var junitPhases = []Phase{PhasePrecondition, PhaseSetup, PhaseCheck, PhaseCleanup}
+
+// WriteJUnit writes the report as JUnit XML, in strict mode failures of
+// advisory steps are failures
+func WriteJUnit(w io.Writer, r *Report, strict bool) error {
+	hostname, _ := os.Hostname()
+	suites := junitTestSuites{
+		Name: "smokeshift",
+		Time: junitSeconds(r.Duration),
+	}
+	for _, phase := range junitPhases {
+		suite := junitTestSuite{
+			Name:      "smokeshift." + string(phase),
+			Timestamp: r.StartTime.UTC().Format(time.RFC3339),
+			Hostname:  hostname,
+			Properties: []junitProperty{
+				{Name: "server", Value: r.Server},
+				{Name: "user", Value: r.User},
+				{Name: "namespace", Value: r.Namespace},
+			},
+		}
+		var total time.Duration
+		for _, check := range r.Checks {
+			if check.Phase != phase {
+				continue
+			}
+			suite.Cases = append(suite.Cases, junitCase(check, strict))
+			suite.Tests++
+			total += time.Duration(check.Duration)
+			switch {
+			case check.Status.Failed(), strict && check.Status.Ignored():
+				suite.Failures++
+			case check.Status != OK:
+				suite.Skipped++
+			}
+		}
+		if suite.Tests == 0 {
+			continue
+		}
+		suite.Time = junitSeconds(Duration(total))
+		suites.Tests += suite.Tests
+		suites.Failures += suite.Failures
+		suites.Skipped += suite.Skipped
+		suites.Suites = append(suites.Suites, suite)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(suites); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func junitCase(check CheckResult, strict bool) junitTestCase {
+	tc := junitTestCase{
+		Name:      check.Name,
+		Classname: "smokeshift." + string(check.Phase),
+		Time:      junitSeconds(check.Duration),
+	}
+	if check.Target != nil {
+		tc.SystemOut = check.Target.String()
+	}
+	if check.Source != nil {
+		tc.SystemOut = "from " + check.Source.String() + " to " + tc.SystemOut
+	}
+	for _, key := range check.InfoKeys() {
+		tc.SystemOut += "\n" + key + ": " + check.Info[key]
+	}
+	tc.SystemOut = strings.TrimPrefix(tc.SystemOut, "\n")
+	switch {
+	case check.Status == OK:
+	case check.Status.Failed(), strict && check.Status.Ignored():
+		tc.Failure = &junitMessage{Message: string(check.Status) + ": " + check.Name, Type: string(check.Status), Body: check.Detail}
+	default:
+		tc.Skipped = &junitMessage{Message: string(check.Status), Body: check.Detail}
+	}
+	return tc
+}
+
+func junitSeconds(d Duration) string {
+	return fmt.Sprintf("%.3f", time.Duration(d).Seconds())
+}
@@ -0,0 +1,84 @@
+package report
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWriteJUnit(t *testing.T) {
+	r := New("smokeshift")
+	r.Add(CheckResult{Name: "Issued Nginx start request", Phase: PhaseSetup, Status: OK, Duration: Duration(200 * time.Millisecond)})
+	r.Add(CheckResult{Name: "Accessed Nginx service at 172.30.0.10 from BusyBox", Phase: PhaseCheck, Status: OK, Duration: Duration(time.Second)})
+	r.Add(CheckResult{Name: "Accessed Nginx pod at 10.1.0.5 from BusyBox", Phase: PhaseCheck, Status: Error, Detail: "wget: can't connect to remote host (10.1.0.5): No route to host\n", Target: &Target{Pod: "smokeshift-nginx-1-aaaaa", IP: "10.1.0.5"}})
+	r.Add(CheckResult{Name: "Accessed Google.com from this node", Phase: PhaseCheck, Status: ErrorIgnored})
+	r.Finish(errors.New("One or more required steps failed"))
+
+	var buf bytes.Buffer
+	if err := WriteJUnit(&buf, r, false); err != nil {
+		t.Fatal(err)
+	}
+	decoded := junitTestSuites{}
+	if err := xml.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("Expected valid XML, got %v:\n%s", err, buf.String())
+	}
+	if decoded.Tests != 4 || decoded.Failures != 1 || decoded.Skipped != 1 {
+		t.Errorf("Expected 4 tests, 1 failure and 1 skipped, got %d, %d and %d", decoded.Tests, decoded.Failures, decoded.Skipped)
+	}
+	if len(decoded.Suites) != 2 || decoded.Suites[0].Name != "smokeshift.setup" || decoded.Suites[1].Name != "smokeshift.check" {
+		t.Fatalf("Expected a setup and a check suite, got %+v", decoded.Suites)
+	}
+	failed := decoded.Suites[1].Cases[1]
+	if failed.Failure == nil || failed.Failure.Body != "wget: can't connect to remote host (10.1.0.5): No route to host\n" {
+		t.Errorf("Expected failure body with the oc output, got %+v", failed.Failure)
+	}
+	if failed.SystemOut != "pod=smokeshift-nginx-1-aaaaa ip=10.1.0.5" {
+		t.Errorf("Expected target in system-out, got %q", failed.SystemOut)
+	}
+	if ignored := decoded.Suites[1].Cases[2]; ignored.Skipped == nil || ignored.Skipped.Message != "ERROR IGNORED" {
+		t.Errorf("Expected ignored error to be skipped, got %+v", ignored)
+	}
+}
+
+func TestWriteJUnitStrict(t *testing.T) {
+	r := New("smokeshift")
+	r.Add(CheckResult{Name: "Accessed Google.com from this node", Phase: PhaseCheck, Status: ErrorIgnored, Detail: "wget: bad address 'google.com'\n"})
+	r.Add(CheckResult{Name: "Accessed Google.com from BusyBox", Phase: PhaseCheck, Status: TimeoutIgnored})
+	r.Finish(errors.New("One or more advisory steps failed"))
+
+	var buf bytes.Buffer
+	if err := WriteJUnit(&buf, r, true); err != nil {
+		t.Fatal(err)
+	}
+	decoded := junitTestSuites{}
+	if err := xml.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("Expected valid XML, got %v:\n%s", err, buf.String())
+	}
+	if decoded.Failures != 2 || decoded.Skipped != 0 {
+		t.Errorf("Expected advisory failures to fail in strict mode, got %d failures and %d skipped", decoded.Failures, decoded.Skipped)
+	}
+	for _, tc := range decoded.Suites[0].Cases {
+		if tc.Failure == nil || tc.Skipped != nil {
+			t.Errorf("Expected %q to be a failure, got %+v", tc.Name, tc)
+		}
+	}
+	if failure := decoded.Suites[0].Cases[0].Failure; failure.Type != "ERROR IGNORED" || failure.Body != "wget: bad address 'google.com'\n" {
+		t.Errorf("Expected the status and detail of the step, got %+v", failure)
+	}
+}
+
+func TestJUnitCaseSystemOut(t *testing.T) {
+	tc := junitCase(CheckResult{
+		Name:   "Route smokeshift-nginx admitted by a router",
+		Phase:  PhaseCheck,
+		Status: OK,
+		Target: &Target{Pod: "smokeshift-nginx-1-aaaaa"},
+		Source: &Target{Node: "node2"},
+		Info:   map[string]string{"router": "router", "admission time": "1.5s"},
+	}, false)
+	if expected := "from node=node2 to pod=smokeshift-nginx-1-aaaaa\nadmission time: 1.5s\nrouter: router"; tc.SystemOut != expected {
+		t.Errorf("Expected %q, got %q", expected, tc.SystemOut)
+	}
+}
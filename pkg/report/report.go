@@ -0,0 +1,277 @@
+package report
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Status is the outcome of a single step
+type Status string
+
+const (
+	OK             Status = "OK"
+	Error          Status = "ERROR"
+	ErrorIgnored   Status = "ERROR IGNORED"
+	Timeout        Status = "TIMEOUT"
+	TimeoutIgnored Status = "TIMEOUT IGNORED"
+	Skipped        Status = "SKIPPED"
+)
+
+// Failed reports whether the status fails the run
+func (s Status) Failed() bool {
+	return s == Error || s == Timeout
+}
+
+// Ignored reports whether the status is a failure of an advisory step
+func (s Status) Ignored() bool {
+	return s == ErrorIgnored || s == TimeoutIgnored
+}
+
+// Phase groups the steps of a run
+type Phase string
+
+const (
+	PhasePrecondition Phase = "precondition"
+	PhaseSetup        Phase = "setup"
+	PhaseCheck        Phase = "check"
+	PhaseCleanup      Phase = "cleanup"
+)
+
+// Duration is a time.Duration that is written to JSON as seconds
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.FormatFloat(time.Duration(d).Seconds(), 'f', 3, 64)), nil
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	seconds, err := strconv.ParseFloat(string(data), 64)
+	if err != nil {
+		return err
+	}
+	*d = Duration(seconds * float64(time.Second))
+	return nil
+}
+
+// Target is what a step was run against
+type Target struct {
+	Pod  string `json:"pod,omitempty"`
+	IP   string `json:"ip,omitempty"`
+	Node string `json:"node,omitempty"`
+}
+
+func (t Target) String() string {
+	parts := []string{}
+	if t.Pod != "" {
+		parts = append(parts, "pod="+t.Pod)
+	}
+	if t.IP != "" {
+		parts = append(parts, "ip="+t.IP)
+	}
+	if t.Node != "" {
+		parts = append(parts, "node="+t.Node)
+	}
+	return strings.Join(parts, " ")
+}
+
+// CheckResult is the outcome of a single step
+type CheckResult struct {
+	Name string `json:"name"`
+	// Check is the name of the registered check that produced the result
+	Check    string   `json:"check,omitempty"`
+	Phase    Phase    `json:"phase"`
+	Status   Status   `json:"status"`
+	Duration Duration `json:"duration"`
+	Detail   string   `json:"detail,omitempty"`
+	Target   *Target  `json:"target,omitempty"`
+	// Source is where the target was accessed from, if not BusyBox or this
+	// machine
+	Source *Target `json:"source,omitempty"`
+	// Info holds what the step measured or found, e.g. timings
+	Info map[string]string `json:"info,omitempty"`
+}
+
+// NodeCoverage tells whether a schedulable node ran a test pod that could
+// be reached
+type NodeCoverage struct {
+	Node      string `json:"node"`
+	Pod       string `json:"pod,omitempty"`
+	Scheduled bool   `json:"scheduled"`
+	Ready     bool   `json:"ready"`
+	// Reachable is unset when the pod was not probed
+	Reachable *bool `json:"reachable,omitempty"`
+	Covered   bool  `json:"covered"`
+}
+
+// NodeInfo describes a node as found when the run started
+type NodeInfo struct {
+	Name        string   `json:"name"`
+	Roles       []string `json:"roles,omitempty"`
+	Ready       bool     `json:"ready"`
+	Schedulable bool     `json:"schedulable"`
+	// Problems are the conditions reporting trouble, e.g. "DiskPressure"
+	Problems         []string `json:"problems,omitempty"`
+	Taints           []string `json:"taints,omitempty"`
+	KubeletVersion   string   `json:"kubeletVersion,omitempty"`
+	OSImage          string   `json:"osImage,omitempty"`
+	KernelVersion    string   `json:"kernelVersion,omitempty"`
+	ContainerRuntime string   `json:"containerRuntime,omitempty"`
+}
+
+// InfoKeys returns the keys of Info in order
+func (c CheckResult) InfoKeys() []string {
+	keys := []string{}
+	for key := range c.Info {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Report is the outcome of a whole smokeshift run
+type Report struct {
+	Server    string        `json:"server,omitempty"`
+	User      string        `json:"user,omitempty"`
+	Namespace string        `json:"namespace"`
+	StartTime time.Time     `json:"startTime"`
+	Duration  Duration      `json:"duration"`
+	Success   bool          `json:"success"`
+	Error     string        `json:"error,omitempty"`
+	Checks    []CheckResult `json:"checks"`
+	// Nodes has an entry for every node, it is not set in restricted mode
+	Nodes []NodeInfo `json:"nodes,omitempty"`
+	// Coverage has an entry for every schedulable node
+	Coverage []NodeCoverage `json:"coverage,omitempty"`
+	// Mesh tells, by client node then Nginx node, whether the nodes could
+	// talk to each other. It is only set in mesh mode.
+	Mesh map[string]map[string]bool `json:"mesh,omitempty"`
+	// SkippedForPermissions are the checks skipped because they need
+	// permissions the run does without, e.g. in restricted mode
+	SkippedForPermissions []string `json:"skippedForPermissions,omitempty"`
+	// MissingPermissions are what the preflight found the user may not do
+	MissingPermissions []MissingPermission `json:"missingPermissions,omitempty"`
+	// Diagnostics is the path of the diagnostics tarball written for the
+	// run, if any
+	Diagnostics string `json:"diagnostics,omitempty"`
+	// Interrupted is set when a signal stopped the run before it completed
+	Interrupted bool `json:"interrupted,omitempty"`
+	// Cleanup is how cleanup ended, one of the Cleanup constants, or empty
+	// when the run stopped before deploying anything
+	Cleanup string `json:"cleanup,omitempty"`
+}
+
+// How cleanup ended
+const (
+	CleanupDone     = "done"
+	CleanupFailed   = "failed"
+	CleanupTimedOut = "timed out"
+	CleanupSkipped  = "skipped"
+)
+
+// MissingPermission is an action the user may not perform, e.g. update
+// securitycontextconstraints, with the checks that need it
+type MissingPermission struct {
+	Verb     string `json:"verb"`
+	Resource string `json:"resource"`
+	// Scope is "cluster" or the namespace the permission was reviewed in
+	Scope    string   `json:"scope"`
+	NeededBy []string `json:"neededBy"`
+}
+
+// New creates an empty report for a run starting now
+func New(namespace string) *Report {
+	return &Report{
+		Namespace: namespace,
+		StartTime: time.Now(),
+		Checks:    []CheckResult{},
+	}
+}
+
+// Add appends the result of a step
+func (r *Report) Add(result CheckResult) {
+	r.Checks = append(r.Checks, result)
+}
+
+// Finish records the overall outcome of the run
+func (r *Report) Finish(err error) {
+	r.Duration = Duration(time.Since(r.StartTime))
+	r.Success = err == nil
+	if err != nil {
+		r.Error = err.Error()
+	}
+}
+
+// Exit codes of a smokeshift run, the most severe failure wins
+const (
+	// ExitOK means every required step passed
+	ExitOK = 0
+	// ExitRequiredFailure means a setup step or a required check failed
+	ExitRequiredFailure = 1
+	// ExitAdvisoryFailure means only advisory checks failed, it is only used
+	// in strict mode
+	ExitAdvisoryFailure = 2
+	// ExitPreconditionFailure means the run could not start, e.g. oc is
+	// missing or the user is not logged in
+	ExitPreconditionFailure = 3
+	// ExitCleanupFailure means the checks passed but the deployed workloads
+	// could not be removed
+	ExitCleanupFailure = 4
+	// ExitInterrupted means a signal stopped the run, whatever the checks
+	// did until then
+	ExitInterrupted = 130
+)
+
+// ExitCode tells how the run ended. In strict mode failures of advisory
+// checks are not ignored. An interrupted run exits with ExitInterrupted as
+// its results are incomplete.
+func (r *Report) ExitCode(strict bool) int {
+	switch {
+	case r.Interrupted:
+		return ExitInterrupted
+	case r.failedIn(PhasePrecondition):
+		return ExitPreconditionFailure
+	case r.failedIn(PhaseSetup), r.failedIn(PhaseCheck):
+		return ExitRequiredFailure
+	case r.failedIn(PhaseCleanup):
+		return ExitCleanupFailure
+	case strict && r.IgnoredFailures():
+		return ExitAdvisoryFailure
+	case !r.Success:
+		return ExitRequiredFailure
+	}
+	return ExitOK
+}
+
+// IgnoredFailures reports whether an advisory step failed
+func (r *Report) IgnoredFailures() bool {
+	for _, c := range r.Checks {
+		if c.Status.Ignored() {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Report) failedIn(phase Phase) bool {
+	for _, c := range r.Checks {
+		if c.Phase == phase && c.Status.Failed() {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteJSON writes the report as a single indented JSON document
+func WriteJSON(w io.Writer, r *Report) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	_, err = w.Write(data)
+	return err
+}
@@ -0,0 +1,103 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWriteJSON(t *testing.T) {
+	r := New("smokeshift")
+	r.Add(CheckResult{Name: "Accessed Nginx pod at 10.1.0.5 from BusyBox", Phase: PhaseCheck, Status: Error, Duration: Duration(1500 * time.Millisecond), Detail: "wget: timed out\n", Target: &Target{Pod: "smokeshift-nginx-1-aaaaa", IP: "10.1.0.5", Node: "node2"}})
+	r.Add(CheckResult{Name: "Accessed Google.com from this node", Phase: PhaseCheck, Status: ErrorIgnored})
+	r.Finish(errors.New("One or more required steps failed"))
+
+	var buf bytes.Buffer
+	if err := WriteJSON(&buf, r); err != nil {
+		t.Fatal(err)
+	}
+	decoded := struct {
+		Success bool   `json:"success"`
+		Error   string `json:"error"`
+		Checks  []struct {
+			Name     string  `json:"name"`
+			Status   string  `json:"status"`
+			Duration float64 `json:"duration"`
+			Target   *Target `json:"target"`
+		} `json:"checks"`
+	}{}
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("Expected a single valid JSON document, got %v:\n%s", err, buf.String())
+	}
+	if decoded.Success || decoded.Error != "One or more required steps failed" {
+		t.Errorf("Expected failed run, got success=%v error=%q", decoded.Success, decoded.Error)
+	}
+	if len(decoded.Checks) != 2 {
+		t.Fatalf("Expected 2 checks, got %d", len(decoded.Checks))
+	}
+	if c := decoded.Checks[0]; c.Status != "ERROR" || c.Duration != 1.5 || c.Target == nil || c.Target.Node != "node2" {
+		t.Errorf("Unexpected first check %+v", c)
+	}
+	if c := decoded.Checks[1]; c.Status != "ERROR IGNORED" || c.Target != nil {
+		t.Errorf("Unexpected second check %+v", c)
+	}
+}
+
+func TestDurationRoundTrip(t *testing.T) {
+	d := Duration(2250 * time.Millisecond)
+	data, err := json.Marshal(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Duration
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded != d {
+		t.Errorf("Expected %v, got %v (%s)", time.Duration(d), time.Duration(decoded), data)
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	result := func(phase Phase, status Status) CheckResult {
+		return CheckResult{Name: string(phase), Phase: phase, Status: status}
+	}
+	tests := []struct {
+		name     string
+		checks   []CheckResult
+		err      error
+		strict   bool
+		expected int
+	}{
+		{"all pass", []CheckResult{result(PhaseCheck, OK), result(PhaseCleanup, OK)}, nil, false, ExitOK},
+		{"advisory failure", []CheckResult{result(PhaseCheck, ErrorIgnored)}, nil, false, ExitOK},
+		{"strict advisory failure", []CheckResult{result(PhaseCheck, TimeoutIgnored)}, errors.New("failed"), true, ExitAdvisoryFailure},
+		{"required failure", []CheckResult{result(PhaseCheck, Timeout), result(PhaseCleanup, Error)}, errors.New("failed"), true, ExitRequiredFailure},
+		{"setup failure", []CheckResult{result(PhaseSetup, Error)}, errors.New("failed"), false, ExitRequiredFailure},
+		{"precondition failure", []CheckResult{result(PhasePrecondition, Error)}, errors.New("failed"), false, ExitPreconditionFailure},
+		{"cleanup failure", []CheckResult{result(PhaseCheck, ErrorIgnored), result(PhaseCleanup, Error)}, errors.New("failed"), true, ExitCleanupFailure},
+		{"unexplained failure", nil, errors.New("failed"), false, ExitRequiredFailure},
+	}
+	for _, test := range tests {
+		r := New("smokeshift")
+		for _, c := range test.checks {
+			r.Add(c)
+		}
+		r.Finish(test.err)
+		if code := r.ExitCode(test.strict); code != test.expected {
+			t.Errorf("%s: expected exit code %d, got %d", test.name, test.expected, code)
+		}
+	}
+}
+
+func TestExitCodeInterrupted(t *testing.T) {
+	r := New("smokeshift")
+	r.Add(CheckResult{Phase: PhaseCleanup, Status: Error})
+	r.Interrupted = true
+	r.Finish(errors.New("interrupted"))
+	if code := r.ExitCode(false); code != ExitInterrupted {
+		t.Errorf("Expected an interrupted run to exit with %d, got %d", ExitInterrupted, code)
+	}
+}
@@ -0,0 +1,617 @@
+package smokeshift
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// APIExecutor is an Executor that talks to the API server directly instead
+// of shelling out to oc. It understands the subset of oc command lines used
+// by smokeshift and returns the same JSON oc would print, so the parsers in
+// ocparser.go work unchanged for both backends.
+type APIExecutor struct {
+	config *APIConfig
+	client *http.Client
+}
+
+// apiResource describes where a resource oc knows by name lives in the API
+type apiResource struct {
+	prefix     string
+	plural     string
+	namespaced bool
+}
+
+var apiResources = map[string]apiResource{}
+
+func registerAPIResource(r apiResource, names ...string) {
+	for _, name := range names {
+		apiResources[name] = r
+	}
+}
+
+func init() {
+	registerAPIResource(apiResource{"/api/v1", "pods", true}, "po", "pod", "pods")
+	registerAPIResource(apiResource{"/api/v1", "services", true}, "svc", "service", "services")
+	registerAPIResource(apiResource{"/api/v1", "endpoints", true}, "ep", "endpoints")
+	registerAPIResource(apiResource{"/api/v1", "events", true}, "ev", "event", "events")
+	registerAPIResource(apiResource{"/api/v1", "componentstatuses", false}, "cs", "componentstatus", "componentstatuses")
+	registerAPIResource(apiResource{"/apis/config.openshift.io/v1", "clusteroperators", false}, "co", "clusteroperator", "clusteroperators")
+	registerAPIResource(apiResource{"/api/v1", "nodes", false}, "no", "node", "nodes")
+	registerAPIResource(apiResource{"/api/v1", "namespaces", false}, "ns", "namespace", "namespaces")
+	registerAPIResource(apiResource{"/api/v1", "replicationcontrollers", true}, "rc", "replicationcontroller", "replicationcontrollers")
+	registerAPIResource(apiResource{"/apis/apps.openshift.io/v1", "deploymentconfigs", true}, "dc", "deploymentconfig", "deploymentconfigs")
+	registerAPIResource(apiResource{"/apis/project.openshift.io/v1", "projects", false}, "project", "projects")
+	registerAPIResource(apiResource{"/apis/apps/v1", "daemonsets", true}, "ds", "daemonset", "daemonsets")
+	registerAPIResource(apiResource{"/apis/route.openshift.io/v1", "routes", true}, "route", "routes")
+	registerAPIResource(apiResource{"/api/v1", "secrets", true}, "secret", "secrets")
+	registerAPIResource(apiResource{"/api/v1", "configmaps", true}, "cm", "configmap", "configmaps")
+	registerAPIResource(apiResource{"/api/v1", "persistentvolumeclaims", true}, "pvc", "persistentvolumeclaim", "persistentvolumeclaims")
+	registerAPIResource(apiResource{"/apis/storage.k8s.io/v1", "storageclasses", false}, "sc", "storageclass", "storageclasses")
+	registerAPIResource(apiResource{"/apis/image.openshift.io/v1", "imagestreams", true}, "is", "imagestream", "imagestreams")
+	registerAPIResource(apiResource{"/apis/build.openshift.io/v1", "buildconfigs", true}, "bc", "buildconfig", "buildconfigs")
+	registerAPIResource(apiResource{"/apis/build.openshift.io/v1", "builds", true}, "build", "builds")
+	registerAPIResource(apiResource{"/apis/networking.k8s.io/v1", "networkpolicies", true}, "netpol", "networkpolicy", "networkpolicies")
+	registerAPIResource(apiResource{"/apis/network.openshift.io/v1", "clusternetworks", false}, "clusternetwork", "clusternetworks")
+	registerAPIResource(apiResource{"/apis/network.openshift.io/v1", "netnamespaces", false}, "netnamespace", "netnamespaces")
+}
+
+// NewAPIExecutor creates an APIExecutor for the current context of the
+// kubeconfig at path, or the default kubeconfig if path is empty.
+func NewAPIExecutor(path string) (*APIExecutor, error) {
+	kc, err := LoadKubeconfig(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := kc.CurrentConfig()
+	if err != nil {
+		return nil, err
+	}
+	return NewAPIExecutorForConfig(cfg), nil
+}
+
+// NewAPIExecutorForConfig creates an APIExecutor from a resolved config
+func NewAPIExecutorForConfig(cfg *APIConfig) *APIExecutor {
+	return &APIExecutor{
+		config: cfg,
+		client: &http.Client{Transport: &http.Transport{TLSClientConfig: cfg.TLS, Proxy: http.ProxyFromEnvironment}},
+	}
+}
+
+// ocArgs is an oc command line split into positional arguments, flags and
+// the command following "--"
+type ocArgs struct {
+	positional []string
+	flags      map[string]string
+	command    []string
+}
+
+func parseOCArgs(args []string) ocArgs {
+	parsed := ocArgs{flags: map[string]string{}}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--":
+			parsed.command = args[i+1:]
+			return parsed
+		case strings.HasPrefix(arg, "--"):
+			if eq := strings.Index(arg, "="); eq > 0 {
+				parsed.flags[arg[2:eq]] = arg[eq+1:]
+			} else {
+				parsed.flags[arg[2:]] = "true"
+			}
+		case arg == "-o" || arg == "-l" || arg == "-n" || arg == "-f":
+			if i+1 < len(args) {
+				parsed.flags[arg[1:]] = args[i+1]
+				i++
+			}
+		default:
+			parsed.positional = append(parsed.positional, arg)
+		}
+	}
+	return parsed
+}
+
+// output is the format given with -o or --output
+func (p ocArgs) output() string {
+	if output := p.flags["o"]; output != "" {
+		return output
+	}
+	return p.flags["output"]
+}
+
+func (p ocArgs) namespace(fallback string) string {
+	if ns := p.flags["namespace"]; ns != "" {
+		return ns
+	}
+	if ns := p.flags["n"]; ns != "" {
+		return ns
+	}
+	if fallback != "" {
+		return fallback
+	}
+	return "default"
+}
+
+// Execute translates the oc command line into API requests
+func (e *APIExecutor) Execute(ctx context.Context, args ...string) OCOutput {
+	p := parseOCArgs(args)
+	if len(p.positional) == 0 {
+		return failedOutput(fmt.Errorf("api backend: no command given"))
+	}
+	ns := p.namespace(e.config.Namespace)
+	verb, rest := p.positional[0], p.positional[1:]
+	if server := p.flags["server"]; server != "" {
+		e = e.withServer(server)
+	}
+
+	var out []byte
+	var err error
+	switch {
+	case verb == "version":
+		out, err = e.version(ctx)
+	case verb == "whoami":
+		out, err = e.whoami(ctx, p.flags["show-server"] == "true")
+	case verb == "get" && p.flags["raw"] != "":
+		out, err = e.do(ctx, "GET", p.flags["raw"], nil)
+	case verb == "get" && len(rest) > 0:
+		out, err = e.get(ctx, ns, rest[0], rest[1:], p.flags["l"], p.output())
+	case verb == "delete" && len(rest) == 2:
+		out, err = e.delete(ctx, ns, rest[0], rest[1])
+	case verb == "new-project" && len(rest) == 1:
+		out, err = e.newProject(ctx, rest[0])
+	case verb == "adm" && len(rest) == 4 && rest[0] == "policy" && rest[1] == "add-scc-to-user":
+		out, err = e.addSCCToUser(ctx, rest[2], rest[3])
+	case verb == "adm" && len(rest) == 3 && rest[0] == "pod-network" && rest[1] == "join-projects" && p.flags["to"] != "":
+		out, err = e.joinProjects(ctx, p.flags["to"], rest[2])
+	case verb == "auth" && len(rest) == 3 && rest[0] == "can-i":
+		return e.canI(ctx, ns, rest[1], rest[2], p.flags["subresource"])
+	case verb == "run" && len(rest) == 1:
+		out, err = e.run(ctx, ns, rest[0], p.flags["image"], p.flags["replicas"], p.command)
+	case verb == "expose" && len(rest) == 2 && rest[0] == "dc":
+		out, err = e.exposeDeploymentConfig(ctx, ns, rest[1], p.flags["name"], p.flags["port"])
+	case verb == "create" && len(rest) == 0 && p.flags["f"] != "":
+		out, err = e.create(ctx, ns, p.flags["f"])
+	case verb == "start-build" && len(rest) == 1:
+		out, err = e.startBuild(ctx, ns, rest[0], p.flags["o"] == "name")
+	case verb == "logs" && len(rest) == 1:
+		out, err = e.logs(ctx, ns, rest[0], p.flags)
+	case verb == "exec" && len(rest) == 1 && len(p.command) > 0:
+		return e.exec(ctx, ns, rest[0], p.command)
+	default:
+		err = fmt.Errorf("api backend: unsupported command \"oc %s\"", strings.Join(args, " "))
+	}
+	if err != nil {
+		return failedOutput(err)
+	}
+	return OCOutput{Success: true, CombinedOut: string(out), RawOut: out}
+}
+
+// withServer returns an executor sending the same credentials to another
+// API server, like oc --server
+func (e *APIExecutor) withServer(server string) *APIExecutor {
+	cfg := *e.config
+	cfg.Server = server
+	return &APIExecutor{config: &cfg, client: e.client}
+}
+
+func failedOutput(err error) OCOutput {
+	out := err.Error() + "\n"
+	return OCOutput{Success: false, CombinedOut: out, RawOut: []byte(out), ExitCode: 1}
+}
+
+func (e *APIExecutor) version(ctx context.Context) ([]byte, error) {
+	body, err := e.do(ctx, "GET", "/version", nil)
+	if err != nil {
+		return nil, err
+	}
+	info := struct {
+		GitVersion string `json:"gitVersion"`
+	}{}
+	json.Unmarshal(body, &info)
+	return []byte(fmt.Sprintf("Server %s\nkubernetes %s\n", e.config.Server, info.GitVersion)), nil
+}
+
+func (e *APIExecutor) whoami(ctx context.Context, showServer bool) ([]byte, error) {
+	if showServer {
+		return []byte(e.config.Server + "\n"), nil
+	}
+	body, err := e.do(ctx, "GET", "/apis/user.openshift.io/v1/users/~", nil)
+	if err != nil {
+		return nil, err
+	}
+	user := objectMeta{}
+	json.Unmarshal(body, &user)
+	return []byte(user.Metadata.Name + "\n"), nil
+}
+
+// get returns objects as JSON, the only format the workflow reads, other
+// formats are rejected rather than answered with JSON
+func (e *APIExecutor) get(ctx context.Context, ns, resource string, names []string, selector, output string) ([]byte, error) {
+	if output != "json" {
+		return nil, fmt.Errorf("api backend: unsupported output format %q for get, only -o json is supported", output)
+	}
+	path, err := resourcePath(ns, resource, "")
+	if err != nil {
+		return nil, err
+	}
+	if len(names) > 0 {
+		path += "/" + names[0]
+	}
+	if selector != "" {
+		path += "?labelSelector=" + url.QueryEscape(selector)
+	}
+	return e.do(ctx, "GET", path, nil)
+}
+
+func (e *APIExecutor) delete(ctx context.Context, ns, resource, name string) ([]byte, error) {
+	path, err := resourcePath(ns, resource, name)
+	if err != nil {
+		return nil, err
+	}
+	// Like oc, remove what the object owns as well
+	options := map[string]interface{}{"kind": "DeleteOptions", "apiVersion": "v1", "propagationPolicy": "Background"}
+	if _, err := e.do(ctx, "DELETE", path, options); err != nil {
+		return nil, err
+	}
+	return []byte(fmt.Sprintf("%s \"%s\" deleted\n", resource, name)), nil
+}
+
+func (e *APIExecutor) newProject(ctx context.Context, name string) ([]byte, error) {
+	request := map[string]interface{}{
+		"kind":       "ProjectRequest",
+		"apiVersion": "project.openshift.io/v1",
+		"metadata":   map[string]string{"name": name},
+	}
+	if _, err := e.do(ctx, "POST", "/apis/project.openshift.io/v1/projectrequests", request); err != nil {
+		return nil, err
+	}
+	return []byte(fmt.Sprintf("Now using project \"%s\" on server \"%s\".\n", name, e.config.Server)), nil
+}
+
+func (e *APIExecutor) addSCCToUser(ctx context.Context, scc, user string) ([]byte, error) {
+	path := "/apis/security.openshift.io/v1/securitycontextconstraints/" + scc
+	body, err := e.do(ctx, "GET", path, nil)
+	if err != nil {
+		return nil, err
+	}
+	obj := map[string]interface{}{}
+	if err := json.Unmarshal(body, &obj); err != nil {
+		return nil, err
+	}
+	users, _ := obj["users"].([]interface{})
+	for _, u := range users {
+		if u == user {
+			return []byte(fmt.Sprintf("scc %q added to: [%q]\n", scc, user)), nil
+		}
+	}
+	obj["users"] = append(users, user)
+	if _, err := e.do(ctx, "PUT", path, obj); err != nil {
+		return nil, err
+	}
+	return []byte(fmt.Sprintf("scc %q added to: [%q]\n", scc, user)), nil
+}
+
+// logs reads the log of a pod, or of a build when name is "build/NAME"
+func (e *APIExecutor) logs(ctx context.Context, ns, name string, flags map[string]string) ([]byte, error) {
+	resource := "pods"
+	if slash := strings.Index(name, "/"); slash > 0 {
+		resource, name = name[:slash], name[slash+1:]
+	}
+	path, err := resourcePath(ns, resource, name)
+	if err != nil {
+		return nil, err
+	}
+	query := url.Values{}
+	if container := flags["container"]; container != "" {
+		query.Set("container", container)
+	}
+	if tail := flags["tail"]; tail != "" {
+		query.Set("tailLines", tail)
+	}
+	if flags["previous"] == "true" {
+		query.Set("previous", "true")
+	}
+	path += "/log"
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	return e.do(ctx, "GET", path, nil)
+}
+
+// canI reviews whether the user may perform verb on resource, which is what
+// oc auth can-i does, printing yes or no and failing on no
+func (e *APIExecutor) canI(ctx context.Context, ns, verb, resource, subresource string) OCOutput {
+	group := ""
+	if dot := strings.Index(resource, "."); dot > 0 {
+		resource, group = resource[:dot], resource[dot+1:]
+	}
+	review := map[string]interface{}{
+		"kind":       "SelfSubjectAccessReview",
+		"apiVersion": "authorization.k8s.io/v1",
+		"spec": map[string]interface{}{
+			"resourceAttributes": map[string]string{
+				"namespace":   ns,
+				"verb":        verb,
+				"group":       group,
+				"resource":    resource,
+				"subresource": subresource,
+			},
+		},
+	}
+	body, err := e.do(ctx, "POST", "/apis/authorization.k8s.io/v1/selfsubjectaccessreviews", review)
+	if err != nil {
+		return failedOutput(err)
+	}
+	status := struct {
+		Status struct {
+			Allowed bool `json:"allowed"`
+		} `json:"status"`
+	}{}
+	if err := json.Unmarshal(body, &status); err != nil {
+		return failedOutput(err)
+	}
+	if !status.Status.Allowed {
+		return OCOutput{Success: false, CombinedOut: "no\n", RawOut: []byte("no\n"), ExitCode: 1}
+	}
+	return OCOutput{Success: true, CombinedOut: "yes\n", RawOut: []byte("yes\n")}
+}
+
+// joinProjects gives the NetNamespace of project the network ID of target,
+// which is what oc adm pod-network join-projects does
+func (e *APIExecutor) joinProjects(ctx context.Context, target, project string) ([]byte, error) {
+	body, err := e.do(ctx, "GET", "/apis/network.openshift.io/v1/netnamespaces/"+target, nil)
+	if err != nil {
+		return nil, err
+	}
+	to := map[string]interface{}{}
+	if err := json.Unmarshal(body, &to); err != nil {
+		return nil, err
+	}
+	path := "/apis/network.openshift.io/v1/netnamespaces/" + project
+	body, err = e.do(ctx, "GET", path, nil)
+	if err != nil {
+		return nil, err
+	}
+	obj := map[string]interface{}{}
+	if err := json.Unmarshal(body, &obj); err != nil {
+		return nil, err
+	}
+	obj["netid"] = to["netid"]
+	if _, err := e.do(ctx, "PUT", path, obj); err != nil {
+		return nil, err
+	}
+	return []byte{}, nil
+}
+
+// run creates a DeploymentConfig the way the deploymentconfig/v1 generator of oc run does
+func (e *APIExecutor) run(ctx context.Context, ns, name, image, replicas string, args []string) ([]byte, error) {
+	count := int64(1)
+	if replicas != "" {
+		n, err := strconv.ParseInt(replicas, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --replicas %q", replicas)
+		}
+		count = n
+	}
+	labels := map[string]string{"run": name}
+	container := map[string]interface{}{"name": name, "image": image}
+	if len(args) > 0 {
+		container["args"] = args
+	}
+	dc := map[string]interface{}{
+		"kind":       "DeploymentConfig",
+		"apiVersion": "apps.openshift.io/v1",
+		"metadata":   map[string]interface{}{"name": name, "labels": labels},
+		"spec": map[string]interface{}{
+			"replicas": count,
+			"selector": labels,
+			"triggers": []map[string]string{{"type": "ConfigChange"}},
+			"template": map[string]interface{}{
+				"metadata": map[string]interface{}{"labels": labels},
+				"spec":     map[string]interface{}{"containers": []interface{}{container}},
+			},
+		},
+	}
+	return e.do(ctx, "POST", "/apis/apps.openshift.io/v1/namespaces/"+ns+"/deploymentconfigs", dc)
+}
+
+func (e *APIExecutor) exposeDeploymentConfig(ctx context.Context, ns, dcName, svcName, port string) ([]byte, error) {
+	body, err := e.do(ctx, "GET", "/apis/apps.openshift.io/v1/namespaces/"+ns+"/deploymentconfigs/"+dcName, nil)
+	if err != nil {
+		return nil, err
+	}
+	dc := struct {
+		Spec struct {
+			Selector map[string]string `json:"selector"`
+		} `json:"spec"`
+	}{}
+	if err := json.Unmarshal(body, &dc); err != nil {
+		return nil, err
+	}
+	if svcName == "" {
+		svcName = dcName
+	}
+	portNumber, err := strconv.Atoi(port)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --port %q", port)
+	}
+	svc := map[string]interface{}{
+		"kind":       "Service",
+		"apiVersion": "v1",
+		"metadata":   map[string]interface{}{"name": svcName, "labels": dc.Spec.Selector},
+		"spec": map[string]interface{}{
+			"selector": dc.Spec.Selector,
+			"ports":    []map[string]interface{}{{"protocol": "TCP", "port": portNumber, "targetPort": portNumber}},
+		},
+	}
+	if _, err := e.do(ctx, "POST", "/api/v1/namespaces/"+ns+"/services", svc); err != nil {
+		return nil, err
+	}
+	return []byte(fmt.Sprintf("service \"%s\" exposed\n", svcName)), nil
+}
+
+// create posts the object or List of objects in file, the kind of every
+// object must be a registered resource
+func (e *APIExecutor) create(ctx context.Context, ns, file string) ([]byte, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	obj := map[string]interface{}{}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return nil, fmt.Errorf("error: unable to decode %q: %v", file, err)
+	}
+	objects := []interface{}{obj}
+	if obj["kind"] == "List" {
+		objects, _ = obj["items"].([]interface{})
+	}
+	out := []byte{}
+	for _, item := range objects {
+		o, _ := item.(map[string]interface{})
+		kind, _ := o["kind"].(string)
+		apiVersion, _ := o["apiVersion"].(string)
+		metadata, _ := o["metadata"].(map[string]interface{})
+		name, _ := metadata["name"].(string)
+		r, ok := apiResources[strings.ToLower(kind)]
+		if !ok {
+			return out, fmt.Errorf("api backend: unknown kind %q", kind)
+		}
+		path := "/apis/" + apiVersion
+		if !strings.Contains(apiVersion, "/") {
+			path = "/api/" + apiVersion
+		}
+		if r.namespaced {
+			path += "/namespaces/" + ns
+		}
+		if _, err := e.do(ctx, "POST", path+"/"+r.plural, o); err != nil {
+			return out, err
+		}
+		out = append(out, fmt.Sprintf("%s \"%s\" created\n", strings.ToLower(kind), name)...)
+	}
+	return out, nil
+}
+
+// startBuild instantiates the BuildConfig, the way oc start-build does
+func (e *APIExecutor) startBuild(ctx context.Context, ns, bcName string, nameOnly bool) ([]byte, error) {
+	request := map[string]interface{}{
+		"kind":       "BuildRequest",
+		"apiVersion": "build.openshift.io/v1",
+		"metadata":   map[string]string{"name": bcName},
+	}
+	body, err := e.do(ctx, "POST", "/apis/build.openshift.io/v1/namespaces/"+ns+"/buildconfigs/"+bcName+"/instantiate", request)
+	if err != nil {
+		return nil, err
+	}
+	build := objectMeta{}
+	json.Unmarshal(body, &build)
+	if nameOnly {
+		return []byte("build/" + build.Metadata.Name + "\n"), nil
+	}
+	return []byte(fmt.Sprintf("build \"%s\" started\n", build.Metadata.Name)), nil
+}
+
+func (e *APIExecutor) exec(ctx context.Context, ns, pod string, command []string) OCOutput {
+	result, err := websocketExec(ctx, e.config, ns, pod, command)
+	if err != nil {
+		return failedOutput(err)
+	}
+	out := formatExecOutput(result)
+	return OCOutput{
+		Success:     result.ExitCode == 0,
+		CombinedOut: out,
+		RawOut:      []byte(out),
+		ExitCode:    result.ExitCode,
+	}
+}
+
+func resourcePath(ns, resource, name string) (string, error) {
+	r, ok := apiResources[resource]
+	if !ok {
+		return "", fmt.Errorf("api backend: unknown resource type %q", resource)
+	}
+	path := r.prefix
+	if r.namespaced {
+		path += "/namespaces/" + ns
+	}
+	path += "/" + r.plural
+	if name != "" {
+		path += "/" + name
+	}
+	return path, nil
+}
+
+// do sends a request to the API server, non 2xx responses are returned as
+// errors formatted like oc reports them.
+func (e *APIExecutor) do(ctx context.Context, method, path string, obj interface{}) ([]byte, error) {
+	var body *bytes.Reader
+	if obj != nil {
+		data, err := json.Marshal(obj)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(data)
+	} else {
+		body = bytes.NewReader(nil)
+	}
+	req, err := http.NewRequest(method, e.config.Server+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/json")
+	if obj != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	setAuth(e.config, req)
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, apiError(resp.StatusCode, data)
+	}
+	return data, nil
+}
+
+func setAuth(cfg *APIConfig, req *http.Request) {
+	if cfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+cfg.Token)
+	} else if cfg.Username != "" {
+		req.SetBasicAuth(cfg.Username, cfg.Password)
+	}
+}
+
+type objectMeta struct {
+	Metadata struct {
+		Name string `json:"name"`
+	} `json:"metadata"`
+}
+
+// apiStatus is the Status object returned by the API server on errors
+type apiStatus struct {
+	Message string `json:"message"`
+	Reason  string `json:"reason"`
+}
+
+func apiError(code int, body []byte) error {
+	status := apiStatus{}
+	if err := json.Unmarshal(body, &status); err != nil || status.Message == "" {
+		return fmt.Errorf("Error from server: %s (%d)", strings.TrimSpace(string(body)), code)
+	}
+	if status.Reason == "" {
+		status.Reason = http.StatusText(code)
+	}
+	return fmt.Errorf("Error from server (%s): %s", status.Reason, status.Message)
+}
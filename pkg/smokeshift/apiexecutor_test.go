@@ -0,0 +1,437 @@
+package smokeshift
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeAPIServer is a minimal in-memory API server. Objects are stored by
+// their full path, collections are listed by path prefix.
+type fakeAPIServer struct {
+	mu       sync.Mutex
+	objects  map[string]map[string]interface{}
+	requests []string
+	exec     func(pod string, command []string) (output string, exitCode int)
+	// allowed answers access reviews by "verb resource"
+	allowed map[string]bool
+}
+
+func newFakeAPIServer() (*fakeAPIServer, *httptest.Server) {
+	f := &fakeAPIServer{objects: map[string]map[string]interface{}{}}
+	return f, httptest.NewServer(f)
+}
+
+func (f *fakeAPIServer) put(path, obj string) {
+	m := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(obj), &m); err != nil {
+		panic(err)
+	}
+	f.objects[path] = m
+}
+
+func (f *fakeAPIServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	f.requests = append(f.requests, r.Method+" "+r.URL.Path)
+	f.mu.Unlock()
+
+	if r.Header.Get("Authorization") != "Bearer secret" {
+		writeStatus(w, http.StatusUnauthorized, "Unauthorized", "Unauthorized")
+		return
+	}
+	if strings.HasSuffix(r.URL.Path, "/exec") {
+		f.serveExec(w, r)
+		return
+	}
+	if strings.HasSuffix(r.URL.Path, "/log") {
+		fmt.Fprintf(w, "log of %s?%s\n", r.URL.Path, r.URL.RawQuery)
+		return
+	}
+	if strings.HasSuffix(r.URL.Path, "/selfsubjectaccessreviews") {
+		review := struct {
+			Spec struct {
+				ResourceAttributes map[string]string `json:"resourceAttributes"`
+			} `json:"spec"`
+		}{}
+		json.NewDecoder(r.Body).Decode(&review)
+		attributes := review.Spec.ResourceAttributes
+		resource := attributes["resource"]
+		if attributes["subresource"] != "" {
+			resource += "/" + attributes["subresource"]
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": map[string]bool{"allowed": f.allowed[attributes["verb"]+" "+resource]}})
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch r.Method {
+	case "GET":
+		if obj, ok := f.objects[r.URL.Path]; ok {
+			json.NewEncoder(w).Encode(obj)
+			return
+		}
+		items := []interface{}{}
+		selector := r.URL.Query().Get("labelSelector")
+		for path, obj := range f.objects {
+			if strings.HasPrefix(path, r.URL.Path+"/") && !strings.Contains(path[len(r.URL.Path)+1:], "/") && matchesSelector(obj, selector) {
+				items = append(items, obj)
+			}
+		}
+		if len(items) == 0 && strings.Count(r.URL.Path, "/") > 4 {
+			writeStatus(w, http.StatusNotFound, "NotFound", r.URL.Path+" not found")
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"kind": "List", "items": items})
+	case "POST", "PUT":
+		obj := map[string]interface{}{}
+		json.NewDecoder(r.Body).Decode(&obj)
+		path := r.URL.Path
+		if r.Method == "POST" {
+			path += "/" + obj["metadata"].(map[string]interface{})["name"].(string)
+		}
+		f.objects[path] = obj
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(obj)
+	case "DELETE":
+		if _, ok := f.objects[r.URL.Path]; !ok {
+			writeStatus(w, http.StatusNotFound, "NotFound", r.URL.Path+" not found")
+			return
+		}
+		delete(f.objects, r.URL.Path)
+		writeStatus(w, http.StatusOK, "", "")
+	}
+}
+
+func (f *fakeAPIServer) serveExec(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(r.URL.Path, "/")
+	pod := parts[len(parts)-2]
+	conn, rw, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n")
+	rw.WriteString("Sec-WebSocket-Protocol: " + execProtocol + "\r\n")
+	rw.WriteString("Sec-WebSocket-Accept: " + websocketAccept(r.Header.Get("Sec-WebSocket-Key")) + "\r\n\r\n")
+	rw.Flush()
+
+	output, exitCode := f.exec(pod, r.URL.Query()["command"])
+	writeWebsocketFrame(conn, wsOpBinary, append([]byte{execStdoutChannel}, output...), false)
+	status := `{"metadata":{},"status":"Success"}`
+	if exitCode != 0 {
+		status = `{"metadata":{},"status":"Failure","message":"command terminated with non-zero exit code","reason":"NonZeroExitCode","details":{"causes":[{"reason":"ExitCode","message":"` + strconv.Itoa(exitCode) + `"}]}}`
+	}
+	writeWebsocketFrame(conn, wsOpBinary, append([]byte{execErrorChannel}, status...), false)
+	writeWebsocketFrame(conn, wsOpClose, nil, false)
+	readWebsocketFrame(bufio.NewReader(conn))
+}
+
+func matchesSelector(obj map[string]interface{}, selector string) bool {
+	if selector == "" {
+		return true
+	}
+	metadata, _ := obj["metadata"].(map[string]interface{})
+	labels, _ := metadata["labels"].(map[string]interface{})
+	for _, term := range strings.Split(selector, ",") {
+		kv := strings.SplitN(term, "=", 2)
+		if len(kv) != 2 || labels[kv[0]] != kv[1] {
+			return false
+		}
+	}
+	return true
+}
+
+func writeStatus(w http.ResponseWriter, code int, reason, message string) {
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{"kind": "Status", "status": "Failure", "reason": reason, "message": message, "code": code})
+}
+
+func newTestAPIExecutor(server *httptest.Server) *APIExecutor {
+	return NewAPIExecutorForConfig(&APIConfig{Server: server.URL, Token: "secret"})
+}
+
+func TestAPIExecutorGetPodsBySelector(t *testing.T) {
+	f, server := newFakeAPIServer()
+	defer server.Close()
+	f.put("/api/v1/namespaces/smokeshift/pods/nginx-1", `{"metadata": {"name": "nginx-1", "labels": {"run": "smokeshift-nginx"}}, "status": {"podIP": "10.1.0.5"}}`)
+	f.put("/api/v1/namespaces/smokeshift/pods/busybox-1", `{"metadata": {"name": "busybox-1", "labels": {"run": "smokeshift-busybox"}}, "status": {"podIP": "10.1.0.6"}}`)
+
+	ko := newTestAPIExecutor(server).Execute(context.Background(), "--namespace=smokeshift", "get", "pods", "-l", "run=smokeshift-nginx", "-o", "json")
+	if !ko.Success {
+		t.Fatalf("Expected get pods to succeed, got %q", ko.CombinedOut)
+	}
+	if ips := ko.PodIPs(); len(ips) != 1 || ips[0] != "10.1.0.5" {
+		t.Errorf("Expected only the nginx pod IP, got %v", ips)
+	}
+}
+
+func TestAPIExecutorGetOutputFormats(t *testing.T) {
+	f, server := newFakeAPIServer()
+	defer server.Close()
+	f.put("/api/v1/namespaces/smokeshift/services/smokeshift-nginx", `{"metadata": {"name": "smokeshift-nginx"}, "spec": {"clusterIP": "172.30.0.10"}}`)
+
+	tests := []struct {
+		args    []string
+		success bool
+	}{
+		{[]string{"-o", "json"}, true},
+		{[]string{"--output=json"}, true},
+		{[]string{"-o", "name"}, false},
+		{[]string{"-o", "wide"}, false},
+		{[]string{"-o", "jsonpath={.spec.clusterIP}"}, false},
+		{nil, false},
+	}
+	for _, test := range tests {
+		args := append([]string{"--namespace=smokeshift", "get", "service", "smokeshift-nginx"}, test.args...)
+		ko := newTestAPIExecutor(server).Execute(context.Background(), args...)
+		if ko.Success != test.success {
+			t.Errorf("%v: expected success=%v, got %q", test.args, test.success, ko.CombinedOut)
+		}
+		if ko.Success && ko.ServiceCluserIP() != "172.30.0.10" {
+			t.Errorf("%v: expected the service as JSON, got %q", test.args, ko.CombinedOut)
+		}
+		if !ko.Success && !strings.Contains(ko.CombinedOut, "unsupported output format") {
+			t.Errorf("%v: expected the output format to be rejected, got %q", test.args, ko.CombinedOut)
+		}
+	}
+}
+
+func TestAPIExecutorNotFound(t *testing.T) {
+	_, server := newFakeAPIServer()
+	defer server.Close()
+
+	ko := newTestAPIExecutor(server).Execute(context.Background(), "--namespace=smokeshift", "get", "project", "smokeshift", "-o", "json")
+	if ko.Success {
+		t.Fatal("Expected missing project to fail")
+	}
+	if !strings.HasPrefix(ko.CombinedOut, "Error from server (NotFound)") {
+		t.Errorf("Expected oc style error, got %q", ko.CombinedOut)
+	}
+}
+
+func TestAPIExecutorUnauthorized(t *testing.T) {
+	_, server := newFakeAPIServer()
+	defer server.Close()
+
+	e := NewAPIExecutorForConfig(&APIConfig{Server: server.URL, Token: "wrong"})
+	if ko := e.Execute(context.Background(), "whoami"); ko.Success {
+		t.Errorf("Expected wrong token to fail, got %q", ko.CombinedOut)
+	}
+}
+
+func TestAPIExecutorRunAndExpose(t *testing.T) {
+	f, server := newFakeAPIServer()
+	defer server.Close()
+	e := newTestAPIExecutor(server)
+
+	if ko := e.Execute(context.Background(), "--namespace=smokeshift", "run", "smokeshift-nginx", "--image=nginx:stable-alpine", "--replicas=3", "-o", "json"); !ko.Success {
+		t.Fatalf("Expected run to succeed, got %q", ko.CombinedOut)
+	}
+	if ko := e.Execute(context.Background(), "--namespace=smokeshift", "expose", "dc", "smokeshift-nginx", "--name=smokeshift-nginx", "--port=80"); !ko.Success {
+		t.Fatalf("Expected expose to succeed, got %q", ko.CombinedOut)
+	}
+	dc := f.objects["/apis/apps.openshift.io/v1/namespaces/smokeshift/deploymentconfigs/smokeshift-nginx"]
+	if replicas := dc["spec"].(map[string]interface{})["replicas"]; replicas != float64(3) {
+		t.Errorf("Expected 3 replicas, got %v", replicas)
+	}
+	svc := f.objects["/api/v1/namespaces/smokeshift/services/smokeshift-nginx"]
+	if selector := svc["spec"].(map[string]interface{})["selector"].(map[string]interface{}); selector["run"] != "smokeshift-nginx" {
+		t.Errorf("Expected service to select the deployment pods, got %v", selector)
+	}
+}
+
+func TestAPIExecutorCreate(t *testing.T) {
+	f, server := newFakeAPIServer()
+	defer server.Close()
+	e := newTestAPIExecutor(server)
+
+	file, err := ioutil.TempFile("", "smokeshift-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	json.NewEncoder(file).Encode(map[string]interface{}{"kind": "List", "items": []interface{}{
+		nginxDaemonSet("smokeshift-nginx", "nginx:stable-alpine", 80),
+		service("smokeshift-nginx", "smokeshift-nginx", 80, 80),
+	}})
+	file.Close()
+
+	ko := e.Execute(context.Background(), "--namespace=smokeshift", "create", "-f", file.Name())
+	if !ko.Success {
+		t.Fatalf("Expected create to succeed, got %q", ko.CombinedOut)
+	}
+	if ko.CombinedOut != "daemonset \"smokeshift-nginx\" created\nservice \"smokeshift-nginx\" created\n" {
+		t.Errorf("Unexpected output %q", ko.CombinedOut)
+	}
+	if _, ok := f.objects["/apis/apps/v1/namespaces/smokeshift/daemonsets/smokeshift-nginx"]; !ok {
+		t.Error("Expected the daemon set to be created")
+	}
+	if _, ok := f.objects["/api/v1/namespaces/smokeshift/services/smokeshift-nginx"]; !ok {
+		t.Error("Expected the service to be created")
+	}
+	if ko := e.Execute(context.Background(), "--namespace=smokeshift", "delete", "ds", "smokeshift-nginx"); !ko.Success {
+		t.Errorf("Expected delete to succeed, got %q", ko.CombinedOut)
+	}
+}
+
+func TestAPIExecutorStartBuild(t *testing.T) {
+	f, server := newFakeAPIServer()
+	defer server.Close()
+
+	ko := newTestAPIExecutor(server).Execute(context.Background(), "--namespace=smokeshift", "start-build", "smokeshift-build", "-o", "name")
+	if !ko.Success {
+		t.Fatalf("Expected start-build to succeed, got %q", ko.CombinedOut)
+	}
+	// The fake server echoes the build request, a real one returns the build
+	if ko.CombinedOut != "build/smokeshift-build\n" {
+		t.Errorf("Unexpected output %q", ko.CombinedOut)
+	}
+	if f.requests[0] != "POST /apis/build.openshift.io/v1/namespaces/smokeshift/buildconfigs/smokeshift-build/instantiate" {
+		t.Errorf("Unexpected request %q", f.requests[0])
+	}
+}
+
+func TestAPIExecutorAddSCCToUser(t *testing.T) {
+	f, server := newFakeAPIServer()
+	defer server.Close()
+	f.put("/apis/security.openshift.io/v1/securitycontextconstraints/anyuid", `{"metadata": {"name": "anyuid"}, "users": []}`)
+
+	user := "system:serviceaccount:smokeshift:default"
+	if ko := newTestAPIExecutor(server).Execute(context.Background(), "adm", "policy", "add-scc-to-user", "anyuid", user); !ko.Success {
+		t.Fatalf("Expected add-scc-to-user to succeed, got %q", ko.CombinedOut)
+	}
+	users := f.objects["/apis/security.openshift.io/v1/securitycontextconstraints/anyuid"]["users"].([]interface{})
+	if len(users) != 1 || users[0] != user {
+		t.Errorf("Expected %s to be added to the SCC, got %v", user, users)
+	}
+}
+
+func TestAPIExecutorCanI(t *testing.T) {
+	f, server := newFakeAPIServer()
+	defer server.Close()
+	f.allowed = map[string]bool{"create pods/exec": true}
+	e := newTestAPIExecutor(server)
+
+	if ko := e.Execute(context.Background(), "--namespace=smokeshift", "auth", "can-i", "create", "pods", "--subresource=exec"); !ko.Success || ko.CombinedOut != "yes\n" {
+		t.Errorf("Expected create pods/exec to be allowed, got %+v", ko)
+	}
+	if ko := e.Execute(context.Background(), "auth", "can-i", "update", "securitycontextconstraints"); ko.Success || ko.CombinedOut != "no\n" {
+		t.Errorf("Expected update securitycontextconstraints to be denied, got %+v", ko)
+	}
+}
+
+func TestAPIExecutorRawOnOtherServer(t *testing.T) {
+	_, server := newFakeAPIServer()
+	defer server.Close()
+	other, otherServer := newFakeAPIServer()
+	defer otherServer.Close()
+	other.put("/version", `{"gitVersion": "v1.11.0+d4cacc0"}`)
+
+	ko := newTestAPIExecutor(server).Execute(context.Background(), "get", "--raw=/version", "--server="+otherServer.URL)
+	if !ko.Success || ko.GitVersion() != "v1.11.0+d4cacc0" {
+		t.Fatalf("Expected the version of the other server, got %+v", ko)
+	}
+	if len(other.requests) != 1 || other.requests[0] != "GET /version" {
+		t.Errorf("Expected the request to go to the other server, got %v", other.requests)
+	}
+}
+
+func TestAPIExecutorLogs(t *testing.T) {
+	_, server := newFakeAPIServer()
+	defer server.Close()
+	e := newTestAPIExecutor(server)
+
+	ko := e.Execute(context.Background(), "--namespace=smokeshift", "logs", "smokeshift-nginx-abcde", "--container=smokeshift-nginx", "--tail=10", "--previous")
+	if expected := "log of /api/v1/namespaces/smokeshift/pods/smokeshift-nginx-abcde/log?container=smokeshift-nginx&previous=true&tailLines=10\n"; !ko.Success || ko.CombinedOut != expected {
+		t.Errorf("Expected %q, got %+v", expected, ko)
+	}
+	ko = e.Execute(context.Background(), "--namespace=smokeshift", "logs", "build/smokeshift-build-1", "--tail=20")
+	if expected := "log of /apis/build.openshift.io/v1/namespaces/smokeshift/builds/smokeshift-build-1/log?tailLines=20\n"; !ko.Success || ko.CombinedOut != expected {
+		t.Errorf("Expected %q, got %+v", expected, ko)
+	}
+}
+
+func TestAPIExecutorExec(t *testing.T) {
+	f, server := newFakeAPIServer()
+	defer server.Close()
+	f.exec = func(pod string, command []string) (string, int) {
+		if pod != "busybox-1" || strings.Join(command, " ") != "wget -qO- 10.1.0.5" {
+			return "unexpected command", 2
+		}
+		return "<h1>Welcome to nginx!</h1>\n", 0
+	}
+	e := newTestAPIExecutor(server)
+
+	ko := e.Execute(context.Background(), "--namespace=smokeshift", "exec", "busybox-1", "--", "wget", "-qO-", "10.1.0.5")
+	if !ko.Success || ko.CombinedOut != "<h1>Welcome to nginx!</h1>\n" {
+		t.Errorf("Expected exec to succeed, got %+v", ko)
+	}
+	ko = e.Execute(context.Background(), "--namespace=smokeshift", "exec", "busybox-1", "--", "wget", "-qO-", "Google.com")
+	if ko.Success || ko.ExitCode != 2 {
+		t.Errorf("Expected exec to fail with exit code 2, got %+v", ko)
+	}
+}
+
+func TestAPIExecutorUnsupportedCommand(t *testing.T) {
+	_, server := newFakeAPIServer()
+	defer server.Close()
+
+	if ko := newTestAPIExecutor(server).Execute(context.Background(), "rollout", "latest", "dc/smokeshift-nginx"); ko.Success {
+		t.Error("Expected unsupported command to fail")
+	}
+}
+
+func TestLoadKubeconfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "smokeshift")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config")
+	ioutil.WriteFile(path, []byte(`
+apiVersion: v1
+kind: Config
+current-context: smokeshift/master:8443/admin
+clusters:
+- name: other:8443
+  cluster:
+    server: https://other.example.com:8443
+- name: master:8443
+  cluster:
+    server: https://master.example.com:8443/
+    insecure-skip-tls-verify: true
+contexts:
+- name: smokeshift/master:8443/admin
+  context:
+    cluster: master:8443
+    namespace: smokeshift
+    user: admin/master:8443
+users:
+- name: admin/master:8443
+  user:
+    token: secret
+`), 0600)
+
+	kc, err := LoadKubeconfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := kc.CurrentConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server != "https://master.example.com:8443" || cfg.Namespace != "smokeshift" || cfg.Token != "secret" || !cfg.TLS.InsecureSkipVerify {
+		t.Errorf("Unexpected config resolved from kubeconfig: %+v", cfg)
+	}
+}
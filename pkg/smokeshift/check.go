@@ -0,0 +1,316 @@
+package smokeshift
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/opencredo/smokeshift/pkg/config"
+	"github.com/opencredo/smokeshift/pkg/report"
+)
+
+// Severity tells whether a failing check fails the run
+type Severity string
+
+const (
+	// Required checks fail the run
+	Required Severity = "required"
+	// Advisory checks are reported as [ERROR IGNORED] when they fail
+	Advisory Severity = "advisory"
+)
+
+// Check is a single verification run once the test workloads are deployed.
+// Checks are added to a Registry, usually from an init function next to
+// their implementation, and run in registration order.
+type Check interface {
+	// Name is a short unique identifier, e.g. "service-dns"
+	Name() string
+	Description() string
+	Severity() Severity
+	// Tags group related checks so they can be selected together, e.g.
+	// "network" or "egress"
+	Tags() []string
+	// Dependencies are the names of the checks that must pass before this
+	// check is run, it is skipped otherwise.
+	Dependencies() []string
+	// Run performs the check, returning a result for every target checked
+	Run(ctx context.Context, env *Environment) []Result
+}
+
+// ClusterScoped is implemented by checks that may need cluster-scoped
+// access, they are skipped in restricted mode when they do
+type ClusterScoped interface {
+	// ClusterAccess describes the cluster-scoped operations the check needs
+	// as configured, e.g. "list StorageClasses", nil if it can do without
+	ClusterAccess() []string
+}
+
+// Result is the outcome of a check against a single target
+type Result struct {
+	// Name describes what was verified, e.g. "Accessed Nginx pod at 10.1.0.5 from BusyBox"
+	Name     string
+	Passed   bool
+	TimedOut bool
+	Detail   string
+	Target   *report.Target
+	// Source is the pod the target was accessed from, if not BusyBox or
+	// this machine
+	Source *report.Target
+	// Info holds what the check measured or found, e.g. timings
+	Info     map[string]string
+	Duration time.Duration
+}
+
+// Environment is what the setup of a run found in the cluster and the
+// Executor it talks to the cluster with, it is shared by all checks.
+type Environment struct {
+	// Executor runs every oc command of the run
+	Executor Executor
+	// Nodes are the names of the schedulable nodes, in restricted mode the
+	// nodes the Nginx pods run on as nodes cannot be listed
+	Nodes []string
+	// NodeInventory has every node with its conditions, it is empty in
+	// restricted mode
+	NodeInventory []Node
+	Busybox       Pod
+	NginxPods     []Pod
+	// MeshClients has a client pod on every node in mesh mode
+	MeshClients []Pod
+	// Route is set by the route-admission check once a router admitted it
+	Route       *Route
+	ServiceName string
+	ServiceIP   string
+	// Server is the URL of the API server oc talks to
+	Server string
+	// HTTPClient is used for probes made from this machine
+	HTTPClient *http.Client
+	// SkipCleanup leaves what checks create in place, like the workloads
+	SkipCleanup bool
+}
+
+// Registry is an ordered set of checks
+type Registry struct {
+	checks []Check
+	byName map[string]Check
+}
+
+// NewRegistry creates an empty Registry
+func NewRegistry() *Registry {
+	return &Registry{byName: map[string]Check{}}
+}
+
+// DefaultRegistry holds the built-in checks
+var DefaultRegistry = NewRegistry()
+
+// Register adds a check to the DefaultRegistry
+func Register(c Check) {
+	if err := DefaultRegistry.Register(c); err != nil {
+		panic(err)
+	}
+}
+
+// Register adds a check, its dependencies must already be registered
+func (r *Registry) Register(c Check) error {
+	if _, exists := r.byName[c.Name()]; exists {
+		return fmt.Errorf("check %q registered twice", c.Name())
+	}
+	for _, dep := range c.Dependencies() {
+		if _, exists := r.byName[dep]; !exists {
+			return fmt.Errorf("check %q depends on unknown check %q", c.Name(), dep)
+		}
+	}
+	r.checks = append(r.checks, c)
+	r.byName[c.Name()] = c
+	return nil
+}
+
+// Checks returns all registered checks in registration order
+func (r *Registry) Checks() []Check {
+	checks := make([]Check, len(r.checks))
+	copy(checks, r.checks)
+	return checks
+}
+
+// Lookup returns the check registered under name
+func (r *Registry) Lookup(name string) (Check, bool) {
+	c, ok := r.byName[name]
+	return c, ok
+}
+
+// Select returns the checks matching any of only, or all checks if only is
+// empty, minus those matching any of skip. Both match check names and tags,
+// unknown ones are an error, as is a selection without any check.
+func (r *Registry) Select(only, skip []string) (*Registry, error) {
+	for _, selector := range append(append([]string{}, only...), skip...) {
+		if !r.known(selector) {
+			return nil, fmt.Errorf("unknown check or tag %q, see 'smokeshift list-checks'", selector)
+		}
+	}
+	selected := &Registry{byName: map[string]Check{}}
+	for _, c := range r.checks {
+		if len(only) > 0 && !matches(c, only) {
+			continue
+		}
+		if matches(c, skip) {
+			continue
+		}
+		selected.checks = append(selected.checks, c)
+		selected.byName[c.Name()] = c
+	}
+	if len(selected.checks) == 0 {
+		return nil, fmt.Errorf("no check selected, see 'smokeshift list-checks'")
+	}
+	return selected, nil
+}
+
+// SelectChecks returns the checks of the default registry selected by
+// --only and --skip. The mesh check is left out unless in mesh mode.
+func SelectChecks() (*Registry, error) {
+	skip := config.Skip
+	if !meshMode() {
+		skip = append([]string{"mesh"}, skip...)
+	}
+	return DefaultRegistry.Select(config.Only, skip)
+}
+
+func (r *Registry) known(selector string) bool {
+	for _, c := range r.checks {
+		if matches(c, []string{selector}) {
+			return true
+		}
+	}
+	return false
+}
+
+// matches reports whether the name or one of the tags of c is in selectors
+func matches(c Check, selectors []string) bool {
+	for _, selector := range selectors {
+		if c.Name() == selector {
+			return true
+		}
+		for _, tag := range c.Tags() {
+			if tag == selector {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// runChecks runs every check of the registry against env and records the
+// results. It returns false if a required check failed.
+func runChecks(ctx context.Context, rec *recorder, registry *Registry, env *Environment) bool {
+	success := true
+	passed := map[string]bool{}
+	for _, c := range registry.Checks() {
+		if missing := failedDependencies(c, passed); len(missing) > 0 {
+			s := rec.start(report.PhaseCheck, c.Description())
+			s.check = c.Name()
+			s.skipped("Skipped because " + strings.Join(missing, ", ") + " did not pass\n")
+			continue
+		}
+		if scoped, ok := c.(ClusterScoped); ok && config.Restricted && len(scoped.ClusterAccess()) > 0 {
+			s := rec.start(report.PhaseCheck, c.Description())
+			s.check = c.Name()
+			skipForPermissions(s, scoped.ClusterAccess())
+			continue
+		}
+		rec.info(c.Description())
+		passed[c.Name()] = true
+		for _, result := range c.Run(ctx, env) {
+			rec.result(c, result)
+			if !result.Passed {
+				passed[c.Name()] = false
+				if c.Severity() == Required {
+					success = false
+				}
+			}
+		}
+	}
+	return success
+}
+
+// skipForPermissions skips the step of a check needing the given
+// cluster-scoped operations and lists the check in the report
+func skipForPermissions(s *step, needs []string) {
+	s.rec.report.SkippedForPermissions = append(s.rec.report.SkippedForPermissions, s.check)
+	s.skipped("Skipped in restricted mode, needs to " + strings.Join(needs, ", ") + "\n")
+}
+
+// recordPermissionSkips prints the checks skipped for lack of permissions
+func recordPermissionSkips(rec *recorder) {
+	if skipped := rec.report.SkippedForPermissions; len(skipped) > 0 {
+		rec.info("Checks skipped for missing permissions: " + strings.Join(skipped, ", "))
+	}
+}
+
+// failedDependencies returns the dependencies of c that ran and did not
+// pass, dependencies that were not selected do not prevent c from running
+func failedDependencies(c Check, passed map[string]bool) []string {
+	missing := []string{}
+	for _, dep := range c.Dependencies() {
+		if ok, ran := passed[dep]; ran && !ok {
+			missing = append(missing, dep)
+		}
+	}
+	return missing
+}
+
+// timed runs f and sets the duration of the result it returns
+func timed(f func() Result) Result {
+	start := time.Now()
+	result := f()
+	result.Duration = time.Since(start)
+	return result
+}
+
+// ocResult turns the outcome of an oc call into a Result
+func ocResult(name string, target *report.Target, ko OCOutput) Result {
+	r := Result{Name: name, Passed: ko.Success, Target: target}
+	if !ko.Success {
+		r.TimedOut = ko.TimedOut
+		r.Detail = ko.CombinedOut
+	}
+	return r
+}
+
+// probeResult turns the outcome of an HTTP probe into a Result
+func probeResult(name string, target *report.Target, err error) Result {
+	r := Result{Name: name, Passed: err == nil, Target: target}
+	if err != nil {
+		r.TimedOut = isTimeout(err)
+		r.Detail = err.Error() + "\n"
+	}
+	return r
+}
+
+// waitUntil polls done until it returns true or timeout expires
+func waitUntil(ctx context.Context, name, what string, timeout time.Duration, done func() bool) Result {
+	start := time.Now()
+	for time.Since(start) < timeout {
+		if done() {
+			return Result{Name: name, Passed: true}
+		}
+		if !sleep(ctx, retryInterval) {
+			return Result{Name: name, TimedOut: true, Detail: "Run timed out while waiting for " + what + "\n"}
+		}
+	}
+	return Result{Name: name, Detail: fmt.Sprintf("Gave up waiting for %s after %s\n", what, timeout)}
+}
+
+// withInfo copies info and sets the given key value pairs, empty values are
+// left out
+func withInfo(info map[string]string, keyValues ...string) map[string]string {
+	copied := map[string]string{}
+	for k, v := range info {
+		copied[k] = v
+	}
+	for i := 0; i+1 < len(keyValues); i += 2 {
+		if keyValues[i+1] != "" {
+			copied[keyValues[i]] = keyValues[i+1]
+		}
+	}
+	return copied
+}
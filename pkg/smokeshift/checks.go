@@ -0,0 +1,117 @@
+package smokeshift
+
+import (
+	"context"
+
+	"github.com/opencredo/smokeshift/pkg/report"
+)
+
+// The built-in checks verify the pod network and the ability for pods to
+// talk to each other, then access from this machine.
+func init() {
+	Register(serviceIPCheck{})
+	Register(serviceDNSCheck{})
+	Register(podIPCheck{})
+	Register(podInternetCheck{})
+	Register(localPodIPCheck{})
+	Register(localInternetCheck{})
+}
+
+// 1. Access nginx service via service IP from another pod
+type serviceIPCheck struct{}
+
+func (serviceIPCheck) Name() string { return "service-ip" }
+func (serviceIPCheck) Description() string {
+	return "Access the Nginx service by its cluster IP from BusyBox"
+}
+func (serviceIPCheck) Severity() Severity     { return Required }
+func (serviceIPCheck) Tags() []string         { return []string{"network"} }
+func (serviceIPCheck) Dependencies() []string { return nil }
+
+func (serviceIPCheck) Run(ctx context.Context, env *Environment) []Result {
+	return []Result{timed(func() Result {
+		return busyboxFetch(ctx, env, "Accessed Nginx service at "+env.ServiceIP+" from BusyBox", &report.Target{IP: env.ServiceIP}, env.ServiceIP)
+	})}
+}
+
+// 2. Access nginx service via service name (DNS) from another pod
+type serviceDNSCheck struct{}
+
+func (serviceDNSCheck) Name() string { return "service-dns" }
+func (serviceDNSCheck) Description() string {
+	return "Access the Nginx service by its DNS name from BusyBox"
+}
+func (serviceDNSCheck) Severity() Severity     { return Required }
+func (serviceDNSCheck) Tags() []string         { return []string{"network", "dns"} }
+func (serviceDNSCheck) Dependencies() []string { return nil }
+
+func (serviceDNSCheck) Run(ctx context.Context, env *Environment) []Result {
+	return []Result{timed(func() Result {
+		return busyboxFetch(ctx, env, "Accessed Nginx service via DNS "+env.ServiceName+" from BusyBox", nil, env.ServiceName)
+	})}
+}
+
+// 3. Access all nginx pods by IP
+type podIPCheck struct{}
+
+func (podIPCheck) Name() string { return "pod-ip" }
+func (podIPCheck) Description() string {
+	return "Access every Nginx pod by its IP from BusyBox"
+}
+func (podIPCheck) Severity() Severity     { return Required }
+func (podIPCheck) Tags() []string         { return []string{"network"} }
+func (podIPCheck) Dependencies() []string { return nil }
+
+func (podIPCheck) Run(ctx context.Context, env *Environment) []Result {
+	results := []Result{}
+	for _, pod := range env.NginxPods {
+		results = append(results, timed(func() Result {
+			return busyboxFetch(ctx, env, "Accessed Nginx pod at "+pod.IP+" from BusyBox", pod.target(), nginxAddress(pod.IP))
+		}))
+	}
+	return results
+}
+
+// 4. Check internet connectivity from pod, see egress.go
+
+// 5. Check connectivity from current machine to all nginx pods
+type localPodIPCheck struct{}
+
+func (localPodIPCheck) Name() string { return "local-pod-ip" }
+func (localPodIPCheck) Description() string {
+	return "Access every Nginx pod by its IP from this machine"
+}
+func (localPodIPCheck) Severity() Severity     { return Advisory }
+func (localPodIPCheck) Tags() []string         { return []string{"network", "local"} }
+func (localPodIPCheck) Dependencies() []string { return nil }
+
+func (localPodIPCheck) Run(ctx context.Context, env *Environment) []Result {
+	results := []Result{}
+	for _, pod := range env.NginxPods {
+		results = append(results, timed(func() Result {
+			return probeResult("Accessed Nginx pod at "+pod.IP+" from this node", pod.target(), httpGet(ctx, env.HTTPClient, "http://"+nginxAddress(pod.IP)))
+		}))
+	}
+	return results
+}
+
+// 6. Check internet connectivity from current machine, see egress.go
+
+// busyboxFetch fetches address from the BusyBox pod, retrying on failure
+func busyboxFetch(ctx context.Context, env *Environment, name string, target *report.Target, address string) Result {
+	return podFetch(ctx, env, env.Busybox, name, target, address)
+}
+
+// podFetch fetches address from the given pod, retrying on failure
+func podFetch(ctx context.Context, env *Environment, from Pod, name string, target *report.Target, address string) Result {
+	var ko OCOutput
+	retry(ctx, 3, func() bool {
+		ko = env.RunOCinNamespace(ctx, "exec", from.Name, "--", "wget", "-qO-", address)
+		return ko.Success
+	})
+	return ocResult(name, target, ko)
+}
+
+func (p Pod) target() *report.Target {
+	return &report.Target{Pod: p.Name, IP: p.IP, Node: p.Node}
+}
@@ -0,0 +1,1010 @@
+package smokeshift
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/opencredo/smokeshift/pkg/config"
+	"github.com/opencredo/smokeshift/pkg/report"
+)
+
+// noRetryDelay lets retries go on straight away for the duration of a test
+func noRetryDelay() func() {
+	previousInterval := retryInterval
+	retryInterval = 0
+	return func() {
+		retryInterval = previousInterval
+	}
+}
+
+// fakeLookup resolves the host names of the API servers to hosts
+func fakeLookup(hosts map[string][]string) func() {
+	previousLookup := lookupHost
+	lookupHost = func(ctx context.Context, host string) ([]string, error) {
+		if addrs, ok := hosts[host]; ok {
+			return addrs, nil
+		}
+		return nil, &net.DNSError{Err: "no such host", Name: host}
+	}
+	return func() {
+		lookupHost = previousLookup
+	}
+}
+
+// testEnvironment runs oc commands with e
+func testEnvironment(e Executor) *Environment {
+	return &Environment{
+		Executor:    e,
+		Busybox:     Pod{Name: "busybox-1", IP: "10.1.0.2", Node: "node2"},
+		NginxPods:   []Pod{{Name: "nginx-1", IP: "10.1.0.5", Node: "node2"}, {Name: "nginx-2", IP: "10.1.1.5", Node: "node3"}},
+		ServiceName: "smokeshift-nginx",
+		ServiceIP:   "172.30.0.10",
+		HTTPClient:  newProbeClient(),
+	}
+}
+
+func TestPodIPCheck(t *testing.T) {
+	f := NewFakeExecutor().
+		On(`exec busybox-1 -- wget -qO- 10\.1\.1\.5$`, 1, "wget: can't connect to remote host (10.1.1.5): No route to host\n").
+		On(`exec busybox-1 -- wget -qO- `, 0, "<h1>Welcome to nginx!</h1>\n")
+	defer noRetryDelay()()
+
+	results := podIPCheck{}.Run(context.Background(), testEnvironment(f))
+	if len(results) != 2 {
+		t.Fatalf("Expected a result per nginx pod, got %d", len(results))
+	}
+	if !results[0].Passed || results[0].Target.Node != "node2" {
+		t.Errorf("Expected pod on node2 to be reachable, got %+v", results[0])
+	}
+	if results[1].Passed || !strings.Contains(results[1].Detail, "No route to host") || results[1].Target.Pod != "nginx-2" {
+		t.Errorf("Expected pod on node3 to be unreachable, got %+v", results[1])
+	}
+}
+
+func TestServiceDNSCheck(t *testing.T) {
+	f := NewFakeExecutor().On(`exec busybox-1 -- wget -qO- smokeshift-nginx$`, 1, "wget: bad address 'smokeshift-nginx'\n")
+	defer noRetryDelay()()
+
+	results := serviceDNSCheck{}.Run(context.Background(), testEnvironment(f))
+	if len(results) != 1 || results[0].Passed {
+		t.Fatalf("Expected DNS failure, got %+v", results)
+	}
+	if n := f.Called(`wget`); n != 3 {
+		t.Errorf("Expected 3 attempts, got %d", n)
+	}
+}
+
+func TestLocalPodIPCheck(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	env := testEnvironment(nil)
+	env.NginxPods = []Pod{{Name: "nginx-1", IP: strings.TrimPrefix(server.URL, "http://")}}
+
+	results := localPodIPCheck{}.Run(context.Background(), env)
+	if len(results) != 1 || !results[0].Passed {
+		t.Errorf("Expected local access to succeed, got %+v", results)
+	}
+}
+
+type stubCheck struct {
+	name     string
+	severity Severity
+	tags     []string
+	deps     []string
+	passed   bool
+	ran      *int
+}
+
+func (c stubCheck) Name() string           { return c.name }
+func (c stubCheck) Description() string    { return "Stub " + c.name }
+func (c stubCheck) Severity() Severity     { return c.severity }
+func (c stubCheck) Tags() []string         { return c.tags }
+func (c stubCheck) Dependencies() []string { return c.deps }
+func (c stubCheck) Run(ctx context.Context, env *Environment) []Result {
+	*c.ran++
+	return []Result{{Name: "Ran " + c.name, Passed: c.passed}}
+}
+
+func TestRunChecksDependencies(t *testing.T) {
+	ran := 0
+	registry := NewRegistry()
+	for _, c := range []Check{
+		stubCheck{name: "base", severity: Required, passed: false, ran: &ran},
+		stubCheck{name: "advisory", severity: Advisory, passed: false, ran: &ran},
+		stubCheck{name: "dependent", severity: Required, deps: []string{"base"}, passed: true, ran: &ran},
+		stubCheck{name: "independent", severity: Required, passed: true, ran: &ran},
+	} {
+		if err := registry.Register(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rep := report.New("smokeshift")
+	if runChecks(context.Background(), &recorder{out: ioutil.Discard, report: rep}, registry, testEnvironment(nil)) {
+		t.Error("Expected failed required check to fail the run")
+	}
+	if ran != 3 {
+		t.Errorf("Expected the dependent check not to run, %d checks ran", ran)
+	}
+	expected := []report.Status{report.Error, report.ErrorIgnored, report.Skipped, report.OK}
+	if len(rep.Checks) != len(expected) {
+		t.Fatalf("Expected %d results, got %+v", len(expected), rep.Checks)
+	}
+	for i, status := range expected {
+		if rep.Checks[i].Status != status {
+			t.Errorf("Expected %s to be %s, got %s", rep.Checks[i].Check, status, rep.Checks[i].Status)
+		}
+	}
+}
+
+func TestRegistryRejectsUnknownDependency(t *testing.T) {
+	ran := 0
+	registry := NewRegistry()
+	if err := registry.Register(stubCheck{name: "dependent", deps: []string{"missing"}, ran: &ran}); err == nil {
+		t.Error("Expected unknown dependency to be rejected")
+	}
+	registry.Register(stubCheck{name: "base", ran: &ran})
+	if err := registry.Register(stubCheck{name: "base", ran: &ran}); err == nil {
+		t.Error("Expected duplicate check to be rejected")
+	}
+}
+
+func TestRegistrySelect(t *testing.T) {
+	names := func(r *Registry) string {
+		selected := []string{}
+		for _, c := range r.Checks() {
+			selected = append(selected, c.Name())
+		}
+		return strings.Join(selected, ",")
+	}
+	tests := []struct {
+		only, skip []string
+		expected   string
+	}{
+		{nil, nil, "service-ip,service-dns,pod-ip,pod-internet,local-pod-ip,local-internet,dns-resolution,dns-external,build,project-isolation,api-health,control-plane,api-latency,pod-mesh,network-policy,node-health,route-admission,route-http,route-tls,storage"},
+		{[]string{"network"}, nil, "service-ip,service-dns,pod-ip,local-pod-ip,dns-resolution,project-isolation,pod-mesh,network-policy"},
+		{[]string{"network"}, []string{"local", "mesh"}, "service-ip,service-dns,pod-ip,dns-resolution,project-isolation,network-policy"},
+		{nil, []string{"egress", "router"}, "service-ip,service-dns,pod-ip,local-pod-ip,dns-resolution,build,project-isolation,api-health,control-plane,api-latency,pod-mesh,network-policy,node-health,storage"},
+		{[]string{"dns", "pod-ip"}, nil, "service-dns,pod-ip,dns-resolution,dns-external"},
+	}
+	for _, test := range tests {
+		selected, err := DefaultRegistry.Select(test.only, test.skip)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := names(selected); got != test.expected {
+			t.Errorf("Select(%v, %v): expected %s, got %s", test.only, test.skip, test.expected, got)
+		}
+	}
+	if _, err := DefaultRegistry.Select([]string{"netwrok"}, nil); err == nil {
+		t.Error("Expected unknown tag to be rejected")
+	}
+}
+
+func TestSelectChecksMesh(t *testing.T) {
+	defer func() { config.Only, config.Skip, config.Mesh = nil, nil, false }()
+	tests := []struct {
+		only     []string
+		mesh     bool
+		selected bool
+	}{
+		{nil, false, false},
+		{nil, true, true},
+		{[]string{"network"}, false, false},
+		{[]string{"mesh"}, false, true},
+		{[]string{"pod-mesh"}, false, true},
+	}
+	for _, test := range tests {
+		config.Only, config.Mesh = test.only, test.mesh
+		checks, err := SelectChecks()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, selected := checks.byName["pod-mesh"]; selected != test.selected {
+			t.Errorf("Only %v, mesh %v: expected pod-mesh selected=%v", test.only, test.mesh, test.selected)
+		}
+	}
+
+	config.Only, config.Skip = []string{"mesh"}, []string{"pod-mesh"}
+	if _, err := SelectChecks(); err == nil {
+		t.Error("Expected a selection without any check to be rejected")
+	}
+}
+
+func TestNeededPermissions(t *testing.T) {
+	config.Namespace = "smokeshift"
+	defer func() { config.Namespace = "" }()
+	selected, err := DefaultRegistry.Select([]string{"master", "nodes"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	needed := map[string]string{}
+	for _, n := range neededPermissions(selected) {
+		needed[n.Verb+" "+n.Resource+" "+n.scope()] = strings.Join(n.neededBy, ",")
+	}
+	for permission, by := range map[string]string{
+		"get endpoints default":                             "api-health",
+		"list clusteroperators.config.openshift.io cluster": "control-plane",
+		"list componentstatuses cluster":                    "control-plane",
+		"list nodes cluster":                                "setup,node-health",
+	} {
+		if needed[permission] != by {
+			t.Errorf("Expected %q to be needed by %s, got %v", permission, by, needed)
+		}
+	}
+}
+
+func TestRunChecksDeselectedDependency(t *testing.T) {
+	ran := 0
+	registry := NewRegistry()
+	registry.Register(stubCheck{name: "base", ran: &ran})
+	registry.Register(stubCheck{name: "dependent", deps: []string{"base"}, passed: true, ran: &ran})
+	selected, _ := registry.Select([]string{"dependent"}, nil)
+
+	rep := report.New("smokeshift")
+	if !runChecks(context.Background(), &recorder{out: ioutil.Discard, report: rep}, selected, testEnvironment(nil)) || ran != 1 {
+		t.Errorf("Expected dependent check to run when its dependency was not selected, %d checks ran", ran)
+	}
+}
+
+func TestMeshCheck(t *testing.T) {
+	f := NewFakeExecutor().
+		On(`exec mesh-node3 -- wget -qO- 10\.1\.0\.5$`, 1, "wget: can't connect to remote host (10.1.0.5): No route to host\n").
+		On(`exec mesh-node[23] -- wget -qO- `, 0, "<h1>Welcome to nginx!</h1>\n")
+	defer noRetryDelay()()
+	env := testEnvironment(f)
+	env.MeshClients = []Pod{{Name: "mesh-node2", IP: "10.1.0.3", Node: "node2"}, {Name: "mesh-node3", IP: "10.1.1.3", Node: "node3"}}
+
+	results := meshCheck{}.Run(context.Background(), env)
+	if len(results) != 4 {
+		t.Fatalf("Expected a result per client and nginx pod, got %d", len(results))
+	}
+	rep := report.New("smokeshift")
+	rec := &recorder{out: ioutil.Discard, report: rep}
+	for _, result := range results {
+		rec.result(meshCheck{}, result)
+	}
+	recordMesh(rec, env)
+	expected := map[string]map[string]bool{
+		"node2": {"node2": true, "node3": true},
+		"node3": {"node2": false, "node3": true},
+	}
+	if !reflect.DeepEqual(rep.Mesh, expected) {
+		t.Errorf("Expected matrix %v, got %v", expected, rep.Mesh)
+	}
+}
+
+func TestRouteChecks(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+	f := NewFakeExecutor(FakeResponse{Pattern: `get route smokeshift-nginx`, Output: `{"status": {}}`, Times: 1}).
+		On(`create -f `, 0, "route \"smokeshift-nginx\" created\n").
+		On(`get route smokeshift-nginx -o json$`, 0, `{"status": {"ingress": [{"host": "`+host+`", "routerName": "router-shard-b", "conditions": [{"type": "Admitted", "status": "True"}]}]}}`)
+	defer noRetryDelay()()
+	env := testEnvironment(f)
+
+	results := routeAdmissionCheck{}.Run(context.Background(), env)
+	if len(results) != 1 || !results[0].Passed || env.Route == nil {
+		t.Fatalf("Expected route to be admitted, got %+v", results)
+	}
+	if info := results[0].Info; info["router"] != "router-shard-b" || info["host"] != host || info["admission time"] == "" {
+		t.Errorf("Expected router shard, host and admission time, got %v", info)
+	}
+	if n := f.Called(`get route`); n != 2 {
+		t.Errorf("Expected to wait for admission, got %d calls", n)
+	}
+
+	results = routeHTTPCheck{}.Run(context.Background(), env)
+	if len(results) != 1 || !results[0].Passed || results[0].Info["status"] != "200 OK" {
+		t.Errorf("Expected route to be fetched, got %+v", results)
+	}
+}
+
+func TestRouteRejected(t *testing.T) {
+	f := NewFakeExecutor().
+		On(`create -f `, 0, "route \"smokeshift-nginx\" created\n").
+		On(`get route smokeshift-nginx -o json$`, 0, `{"status": {"ingress": [{"routerName": "router", "conditions": [{"type": "Admitted", "status": "False", "reason": "HostAlreadyClaimed", "message": "route b already exposes example.com"}]}]}}`)
+	defer noRetryDelay()()
+	env := testEnvironment(f)
+
+	results := routeAdmissionCheck{}.Run(context.Background(), env)
+	if len(results) != 1 || results[0].Passed || !strings.Contains(results[0].Detail, "HostAlreadyClaimed") || env.Route != nil {
+		t.Errorf("Expected rejected route to fail, got %+v", results)
+	}
+}
+
+func TestRouteTLSCheck(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "https://")
+	bundle, err := ioutil.TempFile("", "smokeshift-ca")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(bundle.Name())
+	pem.Encode(bundle, &pem.Block{Type: "CERTIFICATE", Bytes: server.TLS.Certificates[0].Certificate[0]})
+	bundle.Close()
+	config.RouterCA = bundle.Name()
+	defer func() { config.RouterCA = "" }()
+
+	f := NewFakeExecutor().
+		On(`create -f `, 0, "created\n").
+		On(`get dc smokeshift-nginx-tls -o json$`, 0, `{"status": {"availableReplicas": 1}}`).
+		On(`get route `, 0, `{"status": {"ingress": [{"host": "`+host+`", "routerName": "router", "conditions": [{"type": "Admitted", "status": "True"}]}]}}`)
+	defer noRetryDelay()()
+
+	results := routeTLSCheck{}.Run(context.Background(), testEnvironment(f))
+	if len(results) != 4 {
+		t.Fatalf("Expected edge, backend, passthrough and re-encrypt results, got %+v", results)
+	}
+	edge, backend, passthrough, reencrypt := results[0], results[1], results[2], results[3]
+	if !edge.Passed || edge.Info["chain"] != "valid" || edge.Info["status"] != "200 OK" || edge.Info["expires"] == "" {
+		t.Errorf("Expected edge route to verify against the CA bundle, got %+v", edge)
+	}
+	if !backend.Passed {
+		t.Errorf("Expected TLS backend to be deployed, got %+v", backend)
+	}
+	// The test server does not present the certificate smokeshift made for the backend
+	if passthrough.Passed || !strings.Contains(passthrough.Detail, "does not verify") {
+		t.Errorf("Expected passthrough route to fail verification, got %+v", passthrough)
+	}
+	if !reencrypt.Passed || reencrypt.Info["termination"] != "re-encrypt" {
+		t.Errorf("Expected re-encrypt route to verify, got %+v", reencrypt)
+	}
+}
+
+func TestSelfSignedCert(t *testing.T) {
+	certPEM, keyPEM, err := selfSignedCert("smokeshift-nginx-tls", []string{"smokeshift-nginx-tls.smokeshift.svc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatalf("Expected a usable key pair, got %v", err)
+	}
+	cert, _ := x509.ParseCertificate(pair.Certificate[0])
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(certPEM)
+	if err := verifyChain([]*x509.Certificate{cert}, roots, "smokeshift-nginx-tls.smokeshift.svc"); err != nil {
+		t.Errorf("Expected certificate to verify against itself, got %v", err)
+	}
+	if name := formatName(cert.Subject); name != "CN=smokeshift-nginx-tls, O=smokeshift" {
+		t.Errorf("Unexpected subject %q", name)
+	}
+}
+
+func TestParseEgressTarget(t *testing.T) {
+	tests := map[string]EgressTarget{
+		"http://google.com/":                   {URL: "http://google.com/"},
+		"https://registry.example.com/v2/=401": {URL: "https://registry.example.com/v2/", Status: 401},
+		"http://example.com/?q=a":              {URL: "http://example.com/?q=a"},
+	}
+	for s, expected := range tests {
+		if target, err := ParseEgressTarget(s); err != nil || target != expected {
+			t.Errorf("ParseEgressTarget(%q): expected %+v, got %+v (%v)", s, expected, target, err)
+		}
+	}
+	for _, s := range []string{"google.com", "ftp://example.com/", "http://example.com/=999"} {
+		if _, err := ParseEgressTarget(s); err == nil {
+			t.Errorf("Expected %q to be rejected", s)
+		}
+	}
+}
+
+func TestPodEgressFailures(t *testing.T) {
+	config.HTTPProxy = "http://proxy.example.com:3128"
+	config.NoProxy = ".internal.example.com"
+	defer func() { config.HTTPProxy, config.NoProxy = "", "" }()
+	f := NewFakeExecutor().
+		On(`env http_proxy=http://proxy\.example\.com:3128 no_proxy=\.internal\.example\.com wget -S -O /dev/null http://dns\.example\.com/$`, 1, "wget: bad address 'dns.example.com'\n").
+		On(`wget -S -O /dev/null http://refused\.example\.com/$`, 1, "wget: can't connect to remote host (10.0.0.1): Connection refused\n").
+		On(`wget -S -O /dev/null http://missing\.example\.com/$`, 1, "Connecting to missing.example.com\n  HTTP/1.1 404 Not Found\nwget: server returned error: HTTP/1.1 404 Not Found\n").
+		On(`wget -S -O /dev/null http://registry\.example\.com/v2/$`, 1, "  HTTP/1.1 401 Unauthorized\nwget: server returned error: HTTP/1.1 401 Unauthorized\n")
+	defer noRetryDelay()()
+	env := testEnvironment(f)
+
+	tests := []struct {
+		target  EgressTarget
+		passed  bool
+		failure string
+	}{
+		{EgressTarget{URL: "http://dns.example.com/"}, false, egressDNS},
+		{EgressTarget{URL: "http://refused.example.com/"}, false, egressConnection},
+		{EgressTarget{URL: "http://missing.example.com/"}, false, egressStatus},
+		{EgressTarget{URL: "http://registry.example.com/v2/", Status: 401}, true, ""},
+	}
+	for _, test := range tests {
+		result := podEgress(context.Background(), env, env.Busybox, test.target)
+		if result.Passed != test.passed || result.Info["failure"] != test.failure {
+			t.Errorf("%s: expected passed=%v failure=%q, got %+v", test.target.URL, test.passed, test.failure, result)
+		}
+		if result.Info["proxy"] != "http://proxy.example.com:3128" {
+			t.Errorf("%s: expected the proxy to be reported, got %v", test.target.URL, result.Info)
+		}
+	}
+	if result := podEgress(context.Background(), env, Pod{}, EgressTarget{URL: "http://google.com/"}); result.Passed || result.Detail != "No BusyBox pod was found\n" {
+		t.Errorf("Expected egress without a BusyBox pod to fail, got %+v", result)
+	}
+	if proxy := proxyFor("http://registry.internal.example.com/"); proxy != "" {
+		t.Errorf("Expected no proxy for an internal host, got %q", proxy)
+	}
+}
+
+func TestWgetStatus(t *testing.T) {
+	for out, expected := range map[string]string{
+		"  HTTP/1.1 404 Not Found\nwget: server returned error: HTTP/1.1 404 Not Found\n": "404 Not Found",
+		"  HTTP/1.0 302 Found\r\n  HTTP/1.1 200 OK\r\n":                                   "302 Found",
+	} {
+		if _, line := wgetStatus(out); line != expected {
+			t.Errorf("Expected %q, got %q", expected, line)
+		}
+	}
+}
+
+func TestLocalEgress(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		http.Redirect(w, r, "/missing", http.StatusFound)
+	}))
+	defer server.Close()
+	config.EgressTargets = []string{server.URL + "/", server.URL + "/missing", server.URL + "/missing=404", "http://127.0.0.1:1/"}
+	defer func() { config.EgressTargets = nil }()
+
+	results := localInternetCheck{}.Run(context.Background(), testEnvironment(nil))
+	expected := []struct {
+		passed  bool
+		failure string
+	}{{true, ""}, {false, egressStatus}, {true, ""}, {false, egressConnection}}
+	if len(results) != len(expected) {
+		t.Fatalf("Expected a result per target, got %+v", results)
+	}
+	for i, e := range expected {
+		if results[i].Passed != e.passed || results[i].Info["failure"] != e.failure {
+			t.Errorf("%s: expected passed=%v failure=%q, got %+v", results[i].Name, e.passed, e.failure, results[i])
+		}
+	}
+	if status := results[0].Info["status"]; status != "302 Found" {
+		t.Errorf("Expected redirect not to be followed, got %q", status)
+	}
+}
+
+func TestParseNslookup(t *testing.T) {
+	tests := []struct {
+		out       string
+		addresses []string
+		names     []string
+		cnames    []string
+	}{
+		{fakeNslookup("smokeshift-nginx", "172.30.0.10 smokeshift-nginx.smokeshift.svc.cluster.local"),
+			[]string{"172.30.0.10"}, []string{"smokeshift-nginx.smokeshift.svc.cluster.local"}, nil},
+		{"Server:\t\t172.30.0.1\nAddress:\t172.30.0.1:53\n\nName:\tgoogle.com\nAddress: 216.58.204.46\n\nName:\tgoogle.com\nAddress: 2a00:1450:4009:80b::200e\n",
+			[]string{"216.58.204.46", "2a00:1450:4009:80b::200e"}, nil, nil},
+		{"Server:\t\t172.30.0.1\nAddress:\t172.30.0.1:53\n\n10.0.30.172.in-addr.arpa\tname = smokeshift-nginx.smokeshift.svc.cluster.local.\n",
+			nil, []string{"smokeshift-nginx.smokeshift.svc.cluster.local"}, nil},
+		{"Server:\t\t172.30.0.1\nAddress:\t172.30.0.1:53\n\nsmokeshift-external.smokeshift.svc.cluster.local\tcanonical name = kubernetes.default.svc.cluster.local\nName:\tkubernetes.default.svc.cluster.local\nAddress: 172.30.0.1\n",
+			[]string{"172.30.0.1"}, nil, []string{"kubernetes.default.svc.cluster.local"}},
+	}
+	for _, test := range tests {
+		answer := parseNslookup(test.out)
+		if !reflect.DeepEqual(answer.Addresses, test.addresses) || !reflect.DeepEqual(answer.Names, test.names) || !reflect.DeepEqual(answer.CNAMEs, test.cnames) {
+			t.Errorf("Expected %v %v %v, got %+v from\n%s", test.addresses, test.names, test.cnames, answer, test.out)
+		}
+	}
+}
+
+func TestParseResolvConf(t *testing.T) {
+	conf := parseResolvConf(fakeResolvConf)
+	if conf.Ndots != "5" || conf.clusterDomain() != "cluster.local" || !reflect.DeepEqual(conf.Nameservers, []string{"172.30.0.1"}) {
+		t.Errorf("Unexpected %+v", conf)
+	}
+	conf = parseResolvConf("nameserver 10.0.0.1\nsearch demo.svc.example.internal svc.example.internal\n")
+	if conf.Ndots != "1" || conf.clusterDomain() != "example.internal" {
+		t.Errorf("Unexpected %+v", conf)
+	}
+}
+
+func TestDNSResolutionCheck(t *testing.T) {
+	f := fakeCluster(FakeResponse{
+		Pattern: `nslookup smokeshift-nginx-headless\.`,
+		Output:  fakeNslookup("smokeshift-nginx-headless.smokeshift.svc.cluster.local", "127.0.0.11", "127.0.0.12"),
+	})
+	defer noRetryDelay()()
+	config.Namespace = "smokeshift"
+	defer func() { config.Namespace = "" }()
+	env := testEnvironment(f)
+	env.Busybox = Pod{Name: "smokeshift-busybox-1-abcde"}
+	env.NginxPods = []Pod{
+		{Name: "smokeshift-nginx-1-aaaaa", IP: "127.0.0.11", Ready: true},
+		{Name: "smokeshift-nginx-1-bbbbb", IP: "127.0.0.12", Ready: true},
+		{Name: "smokeshift-nginx-1-ccccc", IP: "127.0.0.13", Ready: true},
+	}
+
+	results := dnsResolutionCheck{}.Run(context.Background(), env)
+	if len(results) != 8 {
+		t.Fatalf("Expected resolv.conf and seven lookups, got %+v", results)
+	}
+	if info := results[0].Info; info["ndots"] != "5" || info["search"] != "smokeshift.svc.cluster.local svc.cluster.local cluster.local" {
+		t.Errorf("Expected resolver settings in the report, got %v", info)
+	}
+	for _, r := range results {
+		headless := strings.Contains(r.Name, "headless")
+		if r.Passed == headless {
+			t.Errorf("%s: unexpected result %+v", r.Name, r)
+		}
+		if r.Name != results[0].Name && r.Info["latency"] == "" {
+			t.Errorf("%s: expected the lookup latency", r.Name)
+		}
+	}
+	if n := f.Called(`nslookup smokeshift-nginx-headless`); n != 3 {
+		t.Errorf("Expected the headless lookup to be retried, got %d", n)
+	}
+	if detail := results[5].Detail; !strings.Contains(detail, "missing 127.0.0.13") {
+		t.Errorf("Expected the missing pod in the detail, got %q", detail)
+	}
+	if n := f.Called(`create -f `); n != 2 {
+		t.Errorf("Expected the headless and ExternalName services to be created, got %d", n)
+	}
+}
+
+func TestDNSLookupFailures(t *testing.T) {
+	f := fakeCluster(FakeResponse{
+		Pattern: `nslookup smokeshift-external\.`,
+		Output:  fakeNslookup("smokeshift-external.smokeshift.svc.cluster.local", "172.30.0.10 smokeshift-nginx.smokeshift.svc.cluster.local"),
+	})
+	defer noRetryDelay()()
+	config.Namespace = "smokeshift"
+	defer func() { config.Namespace = "" }()
+	env := testEnvironment(f)
+	env.Busybox = Pod{Name: "smokeshift-busybox-1-abcde"}
+	env.NginxPods = []Pod{{Name: "smokeshift-nginx-1-aaaaa", IP: "127.0.0.11"}}
+
+	if r := headlessLookup(context.Background(), env, "smokeshift-nginx-headless.smokeshift.svc.cluster.local"); r.Passed || !strings.Contains(r.Detail, "No ready Nginx pod") {
+		t.Errorf("Expected the headless lookup to fail without a ready pod, got %+v", r)
+	}
+	if r := externalNameLookup(context.Background(), env, "smokeshift-external.smokeshift.svc.cluster.local", "kubernetes.default.svc.cluster.local"); r.Passed || !strings.Contains(r.Detail, "Expected an alias of kubernetes.default.svc.cluster.local") {
+		t.Errorf("Expected the ExternalName lookup to fail when it does not resolve to its CNAME, got %+v", r)
+	}
+	if n := f.Called(`nslookup smokeshift-nginx-headless`); n != 0 {
+		t.Errorf("Expected no headless lookup without a ready pod, got %d", n)
+	}
+}
+
+func TestStorageCheck(t *testing.T) {
+	config.Namespace = "smokeshift"
+	config.StorageClasses = []string{"all"}
+	config.StorageRemount = true
+	defer func() { config.Namespace, config.StorageClasses, config.StorageRemount = "", nil, false }()
+	f := fakeCluster()
+	defer noRetryDelay()()
+	env := testEnvironment(f)
+	env.Nodes = []string{"node2", "node3"}
+
+	results := storageCheck{}.Run(context.Background(), env)
+	names := []string{}
+	for _, r := range results {
+		names = append(names, r.Name)
+		if !r.Passed {
+			t.Errorf("%s: unexpected failure %+v", r.Name, r)
+		}
+	}
+	expected := []string{
+		"Bound claim smokeshift-data-standard",
+		"Mounted claim smokeshift-data-standard in pod smokeshift-data-standard-writer",
+		"Wrote and read back a payload on claim smokeshift-data-standard",
+		"Remounted claim smokeshift-data-standard on another node and read back the payload",
+		"Deleted claim smokeshift-data-standard and its pods",
+		"Bound claim smokeshift-data-fast",
+		"Mounted claim smokeshift-data-fast in pod smokeshift-data-fast-writer",
+		"Wrote and read back a payload on claim smokeshift-data-fast",
+		"Remounted claim smokeshift-data-fast on another node and read back the payload",
+		"Deleted claim smokeshift-data-fast and its pods",
+	}
+	if !reflect.DeepEqual(names, expected) {
+		t.Fatalf("Expected %v, got %v", expected, names)
+	}
+	if info := results[0].Info; info["volume"] != "pvc-0001" || info["storage class"] != "standard" || info["bind time"] == "" {
+		t.Errorf("Expected the bound volume and bind time, got %v", info)
+	}
+	if info := results[3].Info; info["node"] != "node3" || info["attach time"] == "" {
+		t.Errorf("Expected the remount node and attach time, got %v", info)
+	}
+	if n := f.Called(`exec smokeshift-data-reader -- grep -x smokeshift-\d+ /data/smokeshift$`); n != 2 {
+		t.Errorf("Expected the payload to be read back on the other node, got %d", n)
+	}
+	if n := f.Called(`delete pvc smokeshift-data-(standard|fast)$`); n != 2 {
+		t.Errorf("Expected the claims to be deleted, got %d", n)
+	}
+}
+
+func TestStorageCheckFailure(t *testing.T) {
+	config.Namespace = "smokeshift"
+	defer func() { config.Namespace = "" }()
+	f := fakeCluster(FakeResponse{Pattern: `exec smokeshift-data-writer -- grep`, ExitCode: 1})
+	defer noRetryDelay()()
+
+	results := storageCheck{}.Run(context.Background(), testEnvironment(f))
+	if len(results) != 4 || results[2].Passed || !strings.Contains(results[2].Detail, "not found in /data/smokeshift") {
+		t.Fatalf("Expected the missing payload to fail the check, got %+v", results)
+	}
+	if !results[3].Passed || f.Called(`delete pvc smokeshift-data$`) != 1 {
+		t.Errorf("Expected the claim to be deleted after a failure, got %+v", results[3])
+	}
+
+	f = NewFakeExecutor().On(`get storageclass`, 0, `{"items": [{"metadata": {"name": "fast"}}]}`)
+	defer noRetryDelay()()
+	results = storageCheck{}.Run(context.Background(), testEnvironment(f))
+	if len(results) != 1 || results[0].Passed || !strings.Contains(results[0].Detail, "No default StorageClass") {
+		t.Errorf("Expected a missing default StorageClass to be reported, got %+v", results)
+	}
+}
+
+func TestBuildCheck(t *testing.T) {
+	config.Namespace = "smokeshift"
+	defer func() { config.Namespace = "" }()
+	f := fakeCluster()
+	defer noRetryDelay()()
+	env := testEnvironment(f)
+	env.Busybox = Pod{Name: "smokeshift-busybox-1-abcde"}
+
+	results := buildCheck{}.Run(context.Background(), env)
+	if len(results) != 4 {
+		t.Fatalf("Expected build, image stream, deployment and access results, got %+v", results)
+	}
+	for _, r := range results {
+		if !r.Passed {
+			t.Errorf("%s: unexpected failure %+v", r.Name, r)
+		}
+	}
+	if info := results[0].Info; info["build time"] != "42s" || info["push time"] != "8s" || info["image"] != "sha256:0123" {
+		t.Errorf("Expected build and push durations, got %v", info)
+	}
+	if repository := results[1].Info["repository"]; repository != "docker-registry.default.svc:5000/smokeshift/smokeshift-build" {
+		t.Errorf("Expected the internal registry repository, got %q", repository)
+	}
+}
+
+func TestBuildCheckFailures(t *testing.T) {
+	config.Namespace = "smokeshift"
+	defer func() { config.Namespace = "" }()
+	tests := []struct {
+		override FakeResponse
+		failed   int
+		detail   string
+	}{
+		{FakeResponse{Pattern: `get build smokeshift-build-1 `, Output: `{"status": {"phase": "Failed", "reason": "PushImageToRegistryFailed", "message": "Failed to push the image to the registry."}}`},
+			0, "Build smokeshift-build-1 failed: PushImageToRegistryFailed"},
+		{FakeResponse{Pattern: `get is smokeshift-build `, Output: `{"status": {"dockerImageRepository": "172.30.1.1:5000/smokeshift/smokeshift-build", "tags": [{"tag": "latest", "items": [{"image": "sha256:4567"}]}]}}`},
+			1, "rather than sha256:0123"},
+		{FakeResponse{Pattern: `wget -qO- 127\.0\.0\.30$`, Output: "<h1>Welcome to nginx!</h1>\n"},
+			3, "not the one built"},
+	}
+	for _, test := range tests {
+		f := fakeCluster(test.override)
+		restore := noRetryDelay()
+		env := testEnvironment(f)
+		env.Busybox = Pod{Name: "smokeshift-busybox-1-abcde"}
+		results := buildCheck{}.Run(context.Background(), env)
+		restore()
+		if len(results) != test.failed+1 || results[test.failed].Passed || !strings.Contains(results[test.failed].Detail, test.detail) {
+			t.Errorf("Expected step %d to fail with %q, got %+v", test.failed, test.detail, results)
+		}
+	}
+}
+
+func TestNetworkPolicyCheck(t *testing.T) {
+	f := NewFakeExecutor().
+		On(`create -f `, 0, "created\n").
+		// The first pod stays reachable for one more attempt
+		Add(FakeResponse{Pattern: `exec busybox-1 -- wget -qO- -T 2 10\.1\.0\.5$`, Times: 1}).
+		Add(FakeResponse{Pattern: `exec busybox-1 -- wget -qO- -T 2 `, ExitCode: 1, Output: "wget: download timed out\n", Times: 3}).
+		On(`exec busybox-1 -- wget -qO- -T 2 `, 0, "<h1>Welcome to nginx!</h1>\n").
+		On(`delete networkpolicy smokeshift-allow-busybox$`, 1, "Error from server (NotFound): networkpolicies \"smokeshift-allow-busybox\" not found\n").
+		On(`delete networkpolicy `, 0, "deleted\n")
+	defer noRetryDelay()()
+
+	results := networkPolicyCheck{}.Run(context.Background(), testEnvironment(f))
+	if len(results) != 3 {
+		t.Fatalf("Expected deny, allow and cleanup results, got %+v", results)
+	}
+	for _, r := range results {
+		if !r.Passed {
+			t.Errorf("%s: unexpected failure %+v", r.Name, r)
+		}
+	}
+	if results[0].Info["convergence time"] == "" || results[1].Info["convergence time"] == "" {
+		t.Errorf("Expected convergence times, got %v and %v", results[0].Info, results[1].Info)
+	}
+	if n := f.Called(`wget -qO- -T 2 `); n != 6 {
+		t.Errorf("Expected two attempts to block and one to allow, got %d probes", n)
+	}
+	if n := f.Called(`create -f `); n != 2 {
+		t.Errorf("Expected both policies to be created, got %d", n)
+	}
+}
+
+func TestNetworkPolicyProbeFailures(t *testing.T) {
+	f := NewFakeExecutor().
+		On(`create -f `, 0, "created\n").
+		On(`exec busybox-1 -- wget -qO- -T 2 `, 1, "Error from server (NotFound): pods \"busybox-1\" not found\n").
+		On(`delete networkpolicy `, 0, "deleted\n")
+	defer noRetryDelay()()
+
+	results := networkPolicyCheck{}.Run(context.Background(), testEnvironment(f))
+	if len(results) != 2 || results[0].Passed || !strings.Contains(results[0].Detail, "Could not probe") {
+		t.Errorf("Expected an exec failure to fail the deny-all step, got %+v", results)
+	}
+
+	env := testEnvironment(f)
+	env.NginxPods = nil
+	if results := (networkPolicyCheck{}).Run(context.Background(), env); results[0].Passed {
+		t.Errorf("Expected the deny-all step to fail without Nginx pods, got %+v", results[0])
+	}
+}
+
+func TestWgetUnreachable(t *testing.T) {
+	tests := []struct {
+		ko          OCOutput
+		unreachable bool
+	}{
+		{OCOutput{ExitCode: 1, CombinedOut: "wget: download timed out\ncommand terminated with exit code 1\n"}, true},
+		{OCOutput{ExitCode: 1, CombinedOut: "wget: can't connect to remote host (10.1.0.5): Connection refused\n"}, true},
+		{OCOutput{ExitCode: 1, CombinedOut: "Error from server (NotFound): pods \"busybox-1\" not found\n"}, false},
+		{OCOutput{ExitCode: 1, CombinedOut: "Unable to connect to the server: dial tcp 10.0.0.1:8443: connect: connection timed out\n"}, false},
+		{OCOutput{ExitCode: 1, TimedOut: true, CombinedOut: "wget: download timed out\n"}, false},
+		{OCOutput{ExitCode: 127, CombinedOut: "exec: \"wget\": executable file not found\n"}, false},
+		{OCOutput{Success: true}, false},
+	}
+	for _, test := range tests {
+		if unreachable := wgetUnreachable(test.ko); unreachable != test.unreachable {
+			t.Errorf("%q: expected unreachable=%v", test.ko.CombinedOut, test.unreachable)
+		}
+	}
+}
+
+func TestIsolationCheck(t *testing.T) {
+	config.Namespace = "smokeshift"
+	defer func() { config.Namespace = "" }()
+	tests := []struct {
+		name         string
+		sdnMode      string
+		expectations []string
+		join         bool
+		reachable    bool
+		// probeError is what a failed probe prints when not a wget timeout
+		probeError string
+		failed     []string
+	}{
+		{name: "multitenant isolates", sdnMode: "multitenant"},
+		{name: "multitenant leaks", sdnMode: "multitenant", reachable: true, failed: []string{
+			"Nginx service at 172.30.0.10 unreachable from project smokeshift-isolated",
+			"Nginx pod at 10.1.0.5 unreachable from project smokeshift-isolated",
+			"Nginx pod at 10.1.1.5 unreachable from project smokeshift-isolated",
+		}},
+		{name: "subnet is open", sdnMode: "subnet", reachable: true},
+		{name: "networkpolicy expected isolated", sdnMode: "networkpolicy", expectations: []string{"networkpolicy=isolated"}},
+		{name: "join outside multitenant", sdnMode: "subnet", join: true, reachable: true, failed: []string{
+			"Joined the pod network of project smokeshift-isolated to smokeshift",
+		}},
+		{name: "exec fails", sdnMode: "multitenant", probeError: "Error from server (NotFound): pods \"smokeshift-isolated-client\" not found\n", failed: []string{
+			"Nginx service at 172.30.0.10 unreachable from project smokeshift-isolated",
+			"Nginx pod at 10.1.0.5 unreachable from project smokeshift-isolated",
+			"Nginx pod at 10.1.1.5 unreachable from project smokeshift-isolated",
+		}},
+	}
+	for _, test := range tests {
+		config.SDNMode, config.IsolationExpectations, config.JoinProjects = test.sdnMode, test.expectations, test.join
+		exitCode, out := 1, "wget: download timed out\n"
+		if test.reachable {
+			exitCode, out = 0, ""
+		}
+		if test.probeError != "" {
+			out = test.probeError
+		}
+		f := NewFakeExecutor().
+			On(`^new-project smokeshift-isolated `, 0, "").
+			On(`^--namespace=smokeshift-isolated create -f `, 0, "").
+			On(`^--namespace=smokeshift-isolated get pods `, 0, fakeClaimPod("smokeshift-isolated-client", "node4")).
+			On(`^--namespace=smokeshift-isolated exec smokeshift-isolated-client -- wget -qO- -T 2 `, exitCode, out).
+			On(`^delete project smokeshift-isolated$`, 0, "")
+		restore := noRetryDelay()
+		results := isolationCheck{}.Run(context.Background(), testEnvironment(f))
+		restore()
+
+		failed := []string{}
+		for _, r := range results {
+			if !r.Passed {
+				failed = append(failed, r.Name)
+			}
+		}
+		if len(failed) != len(test.failed) || (len(failed) > 0 && !reflect.DeepEqual(failed, test.failed)) {
+			t.Errorf("%s: expected %v to fail, got %v", test.name, test.failed, failed)
+		}
+		if results[len(results)-1].Name != "Deleted project smokeshift-isolated" {
+			t.Errorf("%s: expected the second project to be deleted", test.name)
+		}
+	}
+	config.SDNMode, config.IsolationExpectations, config.JoinProjects = "", nil, false
+}
+
+func TestIsolationJoinProjects(t *testing.T) {
+	config.Namespace = "smokeshift"
+	config.JoinProjects = true
+	defer func() { config.Namespace, config.JoinProjects = "", false }()
+	f := fakeCluster(
+		FakeResponse{Pattern: `^adm pod-network join-projects --to=smokeshift smokeshift-isolated$`},
+		// Isolated at first, reachable once joined
+		FakeResponse{Pattern: `exec smokeshift-isolated-client -- wget `, ExitCode: 1, Output: "wget: download timed out\n", Times: 3},
+		FakeResponse{Pattern: `exec smokeshift-isolated-client -- wget `},
+	)
+	defer noRetryDelay()()
+
+	results := isolationCheck{}.Run(context.Background(), testEnvironment(f))
+	names := []string{}
+	for _, r := range results {
+		names = append(names, r.Name)
+		if !r.Passed {
+			t.Errorf("%s: unexpected failure %+v", r.Name, r)
+		}
+	}
+	if info := results[0].Info; info["sdn mode"] != "multitenant" || info["projects"] != "isolated" {
+		t.Errorf("Expected the detected SDN mode, got %v", info)
+	}
+	if len(results) != 11 || names[6] != "Joined the pod network of project smokeshift-isolated to smokeshift" ||
+		names[7] != "Accessed Nginx service at 172.30.0.10 from project smokeshift-isolated once joined" {
+		t.Errorf("Unexpected results %v", names)
+	}
+}
+
+func TestAPIHealthCheck(t *testing.T) {
+	f := NewFakeExecutor().
+		On(`^--namespace=default get endpoints kubernetes -o json$`, 0, fakeAPIEndpoints).
+		On(`^get --raw=/healthz --server=https://10\.0\.0\.2:8443$`, 1, "Error from server (InternalError): [-]etcd failed: reason withheld\n").
+		On(`^get --raw=/healthz `, 0, "ok").
+		// /readyz predates the servers of OpenShift 3
+		On(`^get --raw=/readyz `, 1, "Error from server (NotFound): the server could not find the requested resource\n").
+		On(`^get --raw=/version --server=https://10\.0\.0\.2:8443$`, 0, `{"gitVersion": "v1.10.0+b81c8f8"}`).
+		On(`^get --raw=/version `, 0, `{"gitVersion": "v1.11.0+d4cacc0"}`)
+	defer noRetryDelay()()
+	defer fakeLookup(map[string][]string{"master.example.com": {"10.0.0.1"}})()
+	env := testEnvironment(f)
+	env.Server = "https://master.example.com:8443"
+
+	results := apiHealthCheck{}.Run(context.Background(), env)
+	if len(results) != 7 {
+		t.Fatalf("Expected 3 results for each of the 2 masters and the version mismatch, got %+v", results)
+	}
+	if n := f.Called(`--server=https://10\.0\.0\.1:8443$`); n != 0 {
+		t.Errorf("Expected the server to be probed rather than its endpoint address, got %d calls", n)
+	}
+	if results[0].Name != "API server https://master.example.com:8443 (https://10.0.0.1:8443) answered ok on /healthz" {
+		t.Errorf("Expected the server to be named by both of its addresses, got %q", results[0].Name)
+	}
+	failed := []string{}
+	for _, r := range results {
+		if !r.Passed {
+			failed = append(failed, r.Name)
+		}
+	}
+	expected := []string{"API server https://10.0.0.2:8443 answered ok on /healthz", "API server endpoints run the same version"}
+	if !reflect.DeepEqual(failed, expected) {
+		t.Errorf("Expected %v to fail, got %v", expected, failed)
+	}
+	if results[1].Info["status"] != "not served" || results[2].Info["version"] != "v1.11.0+d4cacc0" {
+		t.Errorf("Unexpected info %v and %v", results[1].Info, results[2].Info)
+	}
+}
+
+func TestMergeEndpoints(t *testing.T) {
+	defer fakeLookup(map[string][]string{"master.example.com": {"10.0.0.1"}, "lb.example.com": {"10.0.0.9"}})()
+	urls := []string{
+		"https://master.example.com",
+		"https://lb.example.com:8443",
+		"https://10.0.0.1:443",
+		"https://10.0.0.1:8443",
+		"https://lb.example.com:8443",
+		"https://unknown.example.com:8443",
+	}
+	expected := []apiEndpoint{
+		{URL: "https://master.example.com", Addresses: []string{"https://master.example.com", "https://10.0.0.1:443"}},
+		{URL: "https://lb.example.com:8443", Addresses: []string{"https://lb.example.com:8443"}},
+		{URL: "https://10.0.0.1:8443", Addresses: []string{"https://10.0.0.1:8443"}},
+		{URL: "https://unknown.example.com:8443", Addresses: []string{"https://unknown.example.com:8443"}},
+	}
+	if endpoints := mergeEndpoints(context.Background(), urls); !reflect.DeepEqual(endpoints, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, endpoints)
+	}
+}
+
+func TestControlPlaneCheck(t *testing.T) {
+	operators := `{"items": [
+	{"metadata": {"name": "dns"}, "status": {"conditions": [{"type": "Available", "status": "True"}, {"type": "Degraded", "status": "False"}], "versions": [{"name": "operator", "version": "4.1.0"}]}},
+	{"metadata": {"name": "ingress"}, "status": {"conditions": [{"type": "Available", "status": "True"}, {"type": "Degraded", "status": "True", "message": "1 of 2 routers unavailable"}]}}
+]}`
+	f := NewFakeExecutor().On(`^get clusteroperators -o json$`, 0, operators)
+	defer noRetryDelay()()
+
+	results := controlPlaneCheck{}.Run(context.Background(), testEnvironment(f))
+	if len(results) != 3 || !results[0].Passed || !results[1].Passed || results[1].Info["version"] != "4.1.0" {
+		t.Fatalf("Expected the operators to be listed and dns to be healthy, got %+v", results)
+	}
+	if results[2].Passed || !strings.Contains(results[2].Detail, "1 of 2 routers unavailable") {
+		t.Errorf("Expected the degraded ingress operator to fail, got %+v", results[2])
+	}
+
+	f = NewFakeExecutor().
+		On(`^get clusteroperators -o json$`, 1, "error: the server doesn't have a resource type \"clusteroperators\"\n").
+		On(`^get componentstatuses -o json$`, 0, `{"items": [{"metadata": {"name": "scheduler"}, "conditions": [{"type": "Healthy", "status": "False", "error": "Get http://127.0.0.1:10251/healthz: connection refused"}]}]}`)
+	defer noRetryDelay()()
+	results = controlPlaneCheck{}.Run(context.Background(), testEnvironment(f))
+	if len(results) != 2 || results[1].Passed || !strings.Contains(results[1].Detail, "connection refused") {
+		t.Errorf("Expected the unhealthy scheduler to fail, got %+v", results)
+	}
+}
+
+func TestAPILatencyCheck(t *testing.T) {
+	config.APILatencyRequests = 5
+	defer func() { config.APILatencyRequests = 0 }()
+	f := NewFakeExecutor().On(`get pods -o json$`, 0, `{"items": []}`)
+	defer noRetryDelay()()
+
+	results := apiLatencyCheck{}.Run(context.Background(), testEnvironment(f))
+	if len(results) != 1 || !results[0].Passed {
+		t.Fatalf("Expected the reads to pass, got %+v", results)
+	}
+	for _, key := range []string{"p50", "p90", "p99", "max"} {
+		if results[0].Info[key] == "" {
+			t.Errorf("Expected %s latency, got %v", key, results[0].Info)
+		}
+	}
+	if n := f.Called(`get pods -o json$`); n != 5 {
+		t.Errorf("Expected 5 reads, got %d", n)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	sorted := []time.Duration{}
+	for i := 1; i <= 10; i++ {
+		sorted = append(sorted, time.Duration(i)*time.Millisecond)
+	}
+	for p, expected := range map[float64]time.Duration{50: 5 * time.Millisecond, 90: 9 * time.Millisecond, 99: 10 * time.Millisecond} {
+		if got := percentile(sorted, p); got != expected {
+			t.Errorf("p%v: expected %v, got %v", p, expected, got)
+		}
+	}
+}
+
+func TestNodeHealthCheck(t *testing.T) {
+	env := testEnvironment(nil)
+	env.NodeInventory = OCOutput{RawOut: []byte(SampleNodeConditionsResponse)}.Nodes()
+
+	results := nodeHealthCheck{}.Run(context.Background(), env)
+	if len(results) != 5 {
+		t.Fatalf("Expected a result for every node, got %+v", results)
+	}
+	failed := []string{}
+	for _, r := range results {
+		if !r.Passed {
+			failed = append(failed, r.Target.Node)
+		}
+	}
+	if !reflect.DeepEqual(failed, []string{"node3", "node4"}) {
+		t.Errorf("Expected the NotReady node3 and node4 under disk pressure to fail, got %v", failed)
+	}
+	if !strings.Contains(results[3].Detail, "DiskPressure: kubelet has disk pressure") {
+		t.Errorf("Expected the pressure to be detailed, got %q", results[3].Detail)
+	}
+}
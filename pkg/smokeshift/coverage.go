@@ -0,0 +1,98 @@
+package smokeshift
+
+import (
+	"strings"
+
+	"github.com/opencredo/smokeshift/pkg/config"
+	"github.com/opencredo/smokeshift/pkg/report"
+	"github.com/opencredo/smokeshift/pkg/util"
+)
+
+// recordCoverage adds the coverage of every schedulable node to the report
+// and prints it as a table. Nodes without a ready, reachable Nginx pod are
+// flagged with an advisory failure.
+func recordCoverage(rec *recorder, env *Environment) {
+	if config.Restricted {
+		s := rec.start(report.PhaseCheck, "Every schedulable node runs a reachable Nginx pod")
+		s.check = "node-coverage"
+		skipForPermissions(s, []string{"list the nodes"})
+		return
+	}
+	coverage := nodeCoverage(env, rec.report.Checks)
+	rec.report.Coverage = coverage
+
+	rows := [][]string{}
+	uncovered := []string{}
+	for _, c := range coverage {
+		reachable := "-"
+		if c.Reachable != nil {
+			reachable = yesNo(*c.Reachable)
+		}
+		rows = append(rows, []string{c.Node, c.Pod, yesNo(c.Scheduled), yesNo(c.Ready), reachable})
+		if !c.Covered {
+			uncovered = append(uncovered, c.Node)
+		}
+	}
+	rec.info("Node coverage")
+	util.PrintTable(rec.out, []string{"node", "pod", "scheduled", "ready", "reachable"}, rows)
+
+	s := rec.start(report.PhaseCheck, "Every schedulable node runs a reachable Nginx pod")
+	s.check = "node-coverage"
+	if len(uncovered) > 0 {
+		s.ignored("Nodes not covered: "+strings.Join(uncovered, ", ")+"\n", false)
+		return
+	}
+	s.ok()
+}
+
+// nodeCoverage matches the Nginx pods to the schedulable nodes, a pod is
+// reachable if the pod-ip check reached it
+func nodeCoverage(env *Environment, results []report.CheckResult) []report.NodeCoverage {
+	coverage := []report.NodeCoverage{}
+	for _, node := range env.Nodes {
+		c := report.NodeCoverage{Node: node}
+		for _, pod := range env.NginxPods {
+			if pod.Node != node {
+				continue
+			}
+			c.Pod = pod.Name
+			c.Scheduled = true
+			c.Ready = pod.Ready
+			c.Reachable = reachable(pod, results)
+			break
+		}
+		c.Covered = c.Scheduled && c.Ready && (c.Reachable == nil || *c.Reachable)
+		coverage = append(coverage, c)
+	}
+	return coverage
+}
+
+// podNodes returns the nodes the pods run on
+func podNodes(pods []Pod) []string {
+	nodes := []string{}
+	seen := map[string]bool{}
+	for _, pod := range pods {
+		if pod.Node != "" && !seen[pod.Node] {
+			seen[pod.Node] = true
+			nodes = append(nodes, pod.Node)
+		}
+	}
+	return nodes
+}
+
+func reachable(pod Pod, results []report.CheckResult) *bool {
+	for _, result := range results {
+		if result.Check == "pod-ip" && result.Target != nil && result.Target.Pod == pod.Name {
+			ok := result.Status == report.OK
+			return &ok
+		}
+	}
+	return nil
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
@@ -0,0 +1,114 @@
+package smokeshift
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// diagnosisEvents is how many of the most recent warning events are shown
+	diagnosisEvents = 8
+	// diagnosisLogPods is how many pods have their containers' logs shown
+	diagnosisLogPods = 3
+	// diagnosisLogLines is how many of the last lines are shown per container
+	diagnosisLogLines = 10
+)
+
+// diagnosePods tells why the pods of the project are not ready: what keeps
+// them from being scheduled or their containers waiting, the most recent
+// warning events and the last lines their containers logged. Whatever cannot
+// be read is left out, the diagnosis is best effort.
+func diagnosePods(ctx context.Context, env *Environment) string {
+	var b bytes.Buffer
+	ko := env.RunOCinNamespace(ctx, "get", "pods", "-o", "json")
+	unhealthy := []PodState{}
+	if ko.Success {
+		for _, pod := range ko.PodStates() {
+			if len(pod.Problems) > 0 {
+				unhealthy = append(unhealthy, pod)
+			}
+		}
+		if len(unhealthy) == 0 {
+			b.WriteString("Every pod is ready\n")
+		}
+	} else {
+		b.WriteString("Could not list the pods: " + ko.CombinedOut)
+	}
+	for _, pod := range unhealthy {
+		b.WriteString("Pod " + pod.Name)
+		if pod.Node != "" {
+			b.WriteString(" on " + pod.Node)
+		}
+		if pod.Phase != "" {
+			b.WriteString(" is " + pod.Phase)
+		}
+		b.WriteString("\n")
+		for _, problem := range pod.Problems {
+			b.WriteString("  " + firstLine(problem) + "\n")
+		}
+	}
+
+	if events := warningEvents(env.RunOCinNamespace(ctx, "get", "events", "-o", "json").Events()); len(events) > 0 {
+		b.WriteString("Recent warning events\n")
+		for _, e := range events {
+			count := ""
+			if e.Count > 1 {
+				count = fmt.Sprintf(" (x%d)", e.Count)
+			}
+			fmt.Fprintf(&b, "  %s %s%s: %s\n", e.Reason, e.Object, count, firstLine(e.Message))
+		}
+	}
+
+	for i, pod := range unhealthy {
+		if i == diagnosisLogPods {
+			break
+		}
+		restarted := map[string]bool{}
+		for _, container := range pod.Restarted {
+			restarted[container] = true
+		}
+		for _, container := range pod.Logged {
+			b.WriteString(containerLogs(ctx, env, pod.Name, container, restarted[container]))
+		}
+	}
+	return b.String()
+}
+
+// warningEvents returns the most recent warning events
+func warningEvents(events []Event) []Event {
+	warnings := []Event{}
+	for _, e := range events {
+		if e.Type == "Warning" {
+			warnings = append(warnings, e)
+		}
+	}
+	if len(warnings) > diagnosisEvents {
+		warnings = warnings[len(warnings)-diagnosisEvents:]
+	}
+	return warnings
+}
+
+// containerLogs returns the last lines a container logged, from its previous
+// run if it restarted as that run tells why it stopped
+func containerLogs(ctx context.Context, env *Environment, pod, container string, previous bool) string {
+	args := []string{"logs", pod, "--container=" + container, "--tail=" + strconv.Itoa(diagnosisLogLines)}
+	title := "Last logs of " + pod + "/" + container
+	if previous {
+		args = append(args, "--previous")
+		title += " before it restarted"
+	}
+	ko := env.RunOCinNamespace(ctx, args...)
+	out := strings.TrimRight(ko.CombinedOut, "\n")
+	if !ko.Success || out == "" {
+		return ""
+	}
+	return title + "\n  " + strings.Replace(out, "\n", "\n  ", -1) + "\n"
+}
+
+// firstLine returns s up to its first line break
+func firstLine(s string) string {
+	return strings.SplitN(strings.TrimSpace(s), "\n", 2)[0]
+}
@@ -0,0 +1,357 @@
+package smokeshift
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/opencredo/smokeshift/pkg/config"
+)
+
+// The DNS checks resolve names from BusyBox with nslookup, the way
+// applications resolve them through the pod's resolv.conf, and report how
+// long every lookup took.
+func init() {
+	Register(dnsResolutionCheck{})
+	Register(dnsExternalCheck{})
+}
+
+const (
+	headlessServiceName     = runPrefix + "nginx-headless"
+	externalNameServiceName = runPrefix + "external"
+	defaultClusterDomain    = "cluster.local"
+)
+
+// 1. Resolve the cluster names of the Nginx service and its pods
+type dnsResolutionCheck struct{}
+
+func (dnsResolutionCheck) Name() string { return "dns-resolution" }
+func (dnsResolutionCheck) Description() string {
+	return "Resolve short, namespace qualified, fully qualified, cross-namespace, headless, ExternalName and reverse names from BusyBox"
+}
+func (dnsResolutionCheck) Severity() Severity     { return Advisory }
+func (dnsResolutionCheck) Tags() []string         { return []string{"network", "dns"} }
+func (dnsResolutionCheck) Dependencies() []string { return nil }
+
+func (dnsResolutionCheck) Run(ctx context.Context, env *Environment) []Result {
+	pod := env.Busybox
+	var conf resolvConf
+	results := []Result{timed(func() Result {
+		var r Result
+		conf, r = readResolvConf(ctx, env, pod)
+		return r
+	})}
+
+	domain := conf.clusterDomain()
+	service := env.ServiceName
+	fqdn := service + "." + config.Namespace + ".svc." + domain
+	serviceIP := []string{env.ServiceIP}
+	queries := []struct {
+		kind, query string
+		expected    []string
+	}{
+		{"short name", service, serviceIP},
+		{"namespace qualified name", service + "." + config.Namespace, serviceIP},
+		{"fully qualified name", fqdn, serviceIP},
+		// Every project can resolve the API service in the default namespace
+		{"cross-namespace name", "kubernetes.default.svc." + domain, nil},
+	}
+	for _, q := range queries {
+		results = append(results, timed(func() Result {
+			return lookup(ctx, env, pod, "Resolved "+q.kind+" "+q.query+" from BusyBox", q.query, q.expected)
+		}))
+	}
+
+	results = append(results, timed(func() Result {
+		return headlessLookup(ctx, env, headlessServiceName+"."+config.Namespace+".svc."+domain)
+	}))
+	results = append(results, timed(func() Result {
+		return externalNameLookup(ctx, env, externalNameServiceName+"."+config.Namespace+".svc."+domain, "kubernetes.default.svc."+domain)
+	}))
+	results = append(results, timed(func() Result {
+		return reverseLookup(ctx, env, pod, env.ServiceIP, fqdn)
+	}))
+	return results
+}
+
+// 2. Resolve names outside the cluster
+type dnsExternalCheck struct{}
+
+func (dnsExternalCheck) Name() string { return "dns-external" }
+func (dnsExternalCheck) Description() string {
+	return "Resolve the host names of the egress targets from BusyBox"
+}
+func (dnsExternalCheck) Severity() Severity     { return Advisory }
+func (dnsExternalCheck) Tags() []string         { return []string{"dns", "egress"} }
+func (dnsExternalCheck) Dependencies() []string { return nil }
+
+func (dnsExternalCheck) Run(ctx context.Context, env *Environment) []Result {
+	targets, err := egressTargets()
+	if err != nil {
+		return []Result{{Name: "Parsed egress targets", Detail: err.Error() + "\n"}}
+	}
+	results := []Result{}
+	seen := map[string]bool{}
+	for _, target := range targets {
+		u, err := url.Parse(target.URL)
+		if err != nil || seen[u.Hostname()] || net.ParseIP(u.Hostname()) != nil {
+			continue
+		}
+		host := u.Hostname()
+		seen[host] = true
+		results = append(results, timed(func() Result {
+			return lookup(ctx, env, env.Busybox, "Resolved external name "+host+" from BusyBox", host, nil)
+		}))
+	}
+	return results
+}
+
+// resolvConf holds the settings of a pod's /etc/resolv.conf
+type resolvConf struct {
+	Nameservers []string
+	Search      []string
+	Ndots       string
+}
+
+// clusterDomain is taken from the svc.<domain> search entry every pod gets
+func (c resolvConf) clusterDomain() string {
+	for _, search := range c.Search {
+		if strings.HasPrefix(search, "svc.") {
+			return strings.TrimPrefix(search, "svc.")
+		}
+	}
+	return defaultClusterDomain
+}
+
+func parseResolvConf(s string) resolvConf {
+	conf := resolvConf{Ndots: "1"}
+	for _, line := range strings.Split(s, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		switch fields[0] {
+		case "nameserver":
+			conf.Nameservers = append(conf.Nameservers, fields[1])
+		case "search":
+			conf.Search = fields[1:]
+		case "options":
+			for _, option := range fields[1:] {
+				if strings.HasPrefix(option, "ndots:") {
+					conf.Ndots = strings.TrimPrefix(option, "ndots:")
+				}
+			}
+		}
+	}
+	return conf
+}
+
+// readResolvConf reads the resolver settings of pod, they decide how short
+// names are expanded and how many queries a lookup of an external name takes
+func readResolvConf(ctx context.Context, env *Environment, pod Pod) (resolvConf, Result) {
+	name := "Read resolv.conf of BusyBox"
+	ko := env.RunOCinNamespace(ctx, "exec", pod.Name, "--", "cat", "/etc/resolv.conf")
+	if !ko.Success {
+		return resolvConf{}, ocResult(name, pod.target(), ko)
+	}
+	conf := parseResolvConf(ko.CombinedOut)
+	result := Result{Name: name, Passed: len(conf.Nameservers) > 0, Target: pod.target(), Info: map[string]string{
+		"nameservers": strings.Join(conf.Nameservers, " "),
+		"search":      strings.Join(conf.Search, " "),
+		"ndots":       conf.Ndots,
+	}}
+	if !result.Passed {
+		result.Detail = "No nameserver in resolv.conf\n"
+	}
+	return conf, result
+}
+
+// nslookupAnswer is what nslookup printed after the server it asked
+type nslookupAnswer struct {
+	Addresses []string
+	Names     []string
+	// CNAMEs are the canonical names the query is an alias of
+	CNAMEs []string
+}
+
+var (
+	nslookupName    = regexp.MustCompile(`^Name:\s`)
+	nslookupAddress = regexp.MustCompile(`^Address(?: \d+)?:\s+(\S+)(?:\s+(\S+))?`)
+	nslookupPTR     = regexp.MustCompile(`\sname = (\S+)`)
+	nslookupCNAME   = regexp.MustCompile(`\scanonical name = (\S+)`)
+)
+
+// parseNslookup reads the answer of busybox nslookup, both the older format
+//
+//	Name:      smokeshift-nginx
+//	Address 1: 172.30.0.10 smokeshift-nginx.smokeshift.svc.cluster.local
+//
+// and the newer one, which prints reverse lookups as "<arpa> name = <name>"
+// and aliases as "<name> canonical name = <name>"
+func parseNslookup(out string) nslookupAnswer {
+	answer := nslookupAnswer{}
+	inAnswer := false
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		if m := nslookupCNAME.FindStringSubmatch(line); m != nil {
+			answer.CNAMEs = append(answer.CNAMEs, strings.TrimSuffix(m[1], "."))
+			continue
+		}
+		if m := nslookupPTR.FindStringSubmatch(line); m != nil {
+			answer.Names = append(answer.Names, strings.TrimSuffix(m[1], "."))
+			continue
+		}
+		if nslookupName.MatchString(line) {
+			inAnswer = true
+			continue
+		}
+		if m := nslookupAddress.FindStringSubmatch(line); m != nil && inAnswer {
+			answer.Addresses = append(answer.Addresses, m[1])
+			if m[2] != "" {
+				answer.Names = append(answer.Names, strings.TrimSuffix(m[2], "."))
+			}
+		}
+	}
+	return answer
+}
+
+// nslookup resolves query from pod, the time taken includes the round trip
+// of oc exec
+func nslookup(ctx context.Context, env *Environment, pod Pod, query string) (nslookupAnswer, time.Duration, OCOutput) {
+	start := time.Now()
+	ko := env.RunOCinNamespace(ctx, "exec", pod.Name, "--", "nslookup", query)
+	return parseNslookup(ko.CombinedOut), time.Since(start), ko
+}
+
+// lookup resolves query and expects its addresses to include expected,
+// any address will do if expected is empty
+func lookup(ctx context.Context, env *Environment, pod Pod, name, query string, expected []string) Result {
+	answer, latency, ko := nslookup(ctx, env, pod, query)
+	if !ko.Success {
+		result := ocResult(name, pod.target(), ko)
+		result.Info = map[string]string{"latency": latency.String()}
+		return result
+	}
+	return answerResult(name, pod, answer, latency, expected)
+}
+
+func answerResult(name string, pod Pod, answer nslookupAnswer, latency time.Duration, expected []string) Result {
+	result := Result{Name: name, Target: pod.target(), Info: map[string]string{
+		"addresses": strings.Join(answer.Addresses, " "),
+		"latency":   latency.String(),
+	}}
+	missing := missingFrom(answer.Addresses, expected)
+	switch {
+	case len(answer.Addresses) == 0:
+		result.Detail = "No address returned\n"
+	case len(missing) > 0:
+		result.Detail = fmt.Sprintf("Expected %s, missing %s\n", strings.Join(expected, " "), strings.Join(missing, " "))
+	default:
+		result.Passed = true
+	}
+	return result
+}
+
+// headlessLookup creates a headless service for the Nginx pods and expects
+// its name to resolve to every ready pod, retrying while the endpoints are
+// populated. Without a ready pod there is nothing to expect, which fails.
+func headlessLookup(ctx context.Context, env *Environment, query string) Result {
+	name := "Resolved headless service " + query + " from BusyBox"
+	expected := []string{}
+	for _, pod := range env.NginxPods {
+		if pod.Ready && pod.IP != "" {
+			expected = append(expected, pod.IP)
+		}
+	}
+	if len(expected) == 0 {
+		return Result{Name: name, Detail: "No ready Nginx pod for the headless service to resolve to\n"}
+	}
+	sort.Strings(expected)
+	if ko := env.RunCreate(ctx, headlessService(headlessServiceName, ngDeploymentName, nginxPort())); !ko.Success {
+		return ocResult(name, nil, ko)
+	}
+
+	var result Result
+	retry(ctx, 3, func() bool {
+		answer, latency, ko := nslookup(ctx, env, env.Busybox, query)
+		if !ko.Success {
+			result = ocResult(name, env.Busybox.target(), ko)
+			result.Info = map[string]string{"latency": latency.String()}
+			return false
+		}
+		result = answerResult(name, env.Busybox, answer, latency, expected)
+		return result.Passed
+	})
+	return result
+}
+
+// externalNameLookup creates an ExternalName service aliasing cname and
+// expects its name to resolve to cname. The alias is the API service, which
+// resolves in disconnected clusters as well.
+func externalNameLookup(ctx context.Context, env *Environment, query, cname string) Result {
+	name := "Resolved ExternalName service " + query + " to " + cname + " from BusyBox"
+	if ko := env.RunCreate(ctx, externalNameService(externalNameServiceName, cname)); !ko.Success {
+		return ocResult(name, nil, ko)
+	}
+	pod := env.Busybox
+	var result Result
+	retry(ctx, 3, func() bool {
+		answer, latency, ko := nslookup(ctx, env, pod, query)
+		if !ko.Success {
+			result = ocResult(name, pod.target(), ko)
+			result.Info = map[string]string{"latency": latency.String()}
+			return false
+		}
+		result = answerResult(name, pod, answer, latency, nil)
+		result.Info["cnames"] = strings.Join(answer.CNAMEs, " ")
+		// Older BusyBox prints the name the address resolves back to
+		// rather than the CNAME
+		if result.Passed && len(missingFrom(append(answer.CNAMEs, answer.Names...), []string{cname})) > 0 {
+			result.Passed = false
+			result.Detail = "Expected an alias of " + cname + ", got " + strings.Join(append(answer.CNAMEs, answer.Names...), " ") + "\n"
+		}
+		return result.Passed
+	})
+	return result
+}
+
+// reverseLookup expects ip to resolve back to name
+func reverseLookup(ctx context.Context, env *Environment, pod Pod, ip, expected string) Result {
+	name := "Resolved " + ip + " back to " + expected + " from BusyBox"
+	answer, latency, ko := nslookup(ctx, env, pod, ip)
+	if !ko.Success {
+		result := ocResult(name, pod.target(), ko)
+		result.Info = map[string]string{"latency": latency.String()}
+		return result
+	}
+	result := Result{Name: name, Target: pod.target(), Info: map[string]string{
+		"names":   strings.Join(answer.Names, " "),
+		"latency": latency.String(),
+	}}
+	if len(missingFrom(answer.Names, []string{expected})) == 0 {
+		result.Passed = true
+	} else {
+		result.Detail = "Expected " + expected + ", got " + strings.Join(answer.Names, " ") + "\n"
+	}
+	return result
+}
+
+// missingFrom returns the elements of expected that are not in found
+func missingFrom(found, expected []string) []string {
+	set := map[string]bool{}
+	for _, f := range found {
+		set[f] = true
+	}
+	missing := []string{}
+	for _, e := range expected {
+		if !set[e] {
+			missing = append(missing, e)
+		}
+	}
+	return missing
+}
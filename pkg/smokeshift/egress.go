@@ -0,0 +1,315 @@
+package smokeshift
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/opencredo/smokeshift/pkg/config"
+)
+
+// The egress checks access targets outside the cluster, from BusyBox and
+// from this machine, through the configured proxies. Failures tell whether
+// the name did not resolve, the connection failed or the status was not the
+// expected one.
+
+// EgressTarget is a URL that should be reachable and the status expected
+// from it, zero meaning any status below 400. Redirects are not followed.
+type EgressTarget struct {
+	URL    string
+	Status int
+}
+
+var defaultEgressTargets = []EgressTarget{{URL: "http://google.com/"}}
+
+// ParseEgressTarget parses URL[=STATUS], e.g.
+// https://registry.example.com/v2/=401
+func ParseEgressTarget(s string) (EgressTarget, error) {
+	target := EgressTarget{URL: s}
+	if eq := strings.LastIndex(s, "="); eq > 0 {
+		if status, err := strconv.Atoi(s[eq+1:]); err == nil {
+			target = EgressTarget{URL: s[:eq], Status: status}
+		}
+	}
+	u, err := url.Parse(target.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return target, fmt.Errorf("invalid egress target %q, expected an http or https URL optionally followed by =STATUS", s)
+	}
+	if target.Status != 0 && (target.Status < 100 || target.Status > 599) {
+		return target, fmt.Errorf("invalid status in egress target %q", s)
+	}
+	return target, nil
+}
+
+// egressTargets returns the targets of config.EgressTargets, or the default
+// ones if none are set
+func egressTargets() ([]EgressTarget, error) {
+	if len(config.EgressTargets) == 0 {
+		return defaultEgressTargets, nil
+	}
+	targets := []EgressTarget{}
+	for _, s := range config.EgressTargets {
+		target, err := ParseEgressTarget(s)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, target)
+	}
+	return targets, nil
+}
+
+func (t EgressTarget) expects(status int) bool {
+	if t.Status == 0 {
+		return status < 400
+	}
+	return status == t.Status
+}
+
+func (t EgressTarget) expected() string {
+	if t.Status == 0 {
+		return "below 400"
+	}
+	return strconv.Itoa(t.Status)
+}
+
+// Kinds of egress failures
+const (
+	egressDNS        = "dns"
+	egressConnection = "connection"
+	egressTimeout    = "timeout"
+	egressStatus     = "status"
+)
+
+// 4. Check internet connectivity from pod
+type podInternetCheck struct{}
+
+func (podInternetCheck) Name() string { return "pod-internet" }
+func (podInternetCheck) Description() string {
+	return "Access the egress targets from BusyBox"
+}
+func (podInternetCheck) Severity() Severity     { return Advisory }
+func (podInternetCheck) Tags() []string         { return []string{"egress"} }
+func (podInternetCheck) Dependencies() []string { return nil }
+
+func (podInternetCheck) Run(ctx context.Context, env *Environment) []Result {
+	targets, err := egressTargets()
+	if err != nil {
+		return []Result{{Name: "Parsed egress targets", Detail: err.Error() + "\n"}}
+	}
+	results := []Result{}
+	for _, target := range targets {
+		results = append(results, timed(func() Result {
+			return podEgress(ctx, env, env.Busybox, target)
+		}))
+	}
+	return results
+}
+
+// podEgress fetches target with wget in the pod, the server responses are
+// printed so the status is known even when wget fails
+func podEgress(ctx context.Context, env *Environment, pod Pod, target EgressTarget) Result {
+	name := "Accessed " + target.URL + " from BusyBox"
+	if pod.Name == "" {
+		return Result{Name: name, Detail: "No BusyBox pod was found\n"}
+	}
+	args := []string{"exec", pod.Name, "--"}
+	if env := proxyEnv(); len(env) > 0 {
+		args = append(append(args, "env"), env...)
+	}
+	args = append(args, "wget", "-S", "-O", "/dev/null", target.URL)
+	ko := env.RunOCinNamespace(ctx, args...)
+
+	info := map[string]string{"expected status": target.expected()}
+	if proxy := proxyFor(target.URL); proxy != "" {
+		info["proxy"] = proxy
+	}
+	result := Result{Name: name, Target: pod.target(), Info: info}
+	status, statusLine := wgetStatus(ko.CombinedOut)
+	switch {
+	case status != 0:
+		info["status"] = statusLine
+		result.Passed = target.expects(status)
+		if !result.Passed {
+			info["failure"] = egressStatus
+			result.Detail = fmt.Sprintf("Unexpected status %s, expected %s\n", statusLine, target.expected())
+		}
+	case ko.Success:
+		result.Passed = true
+	default:
+		info["failure"] = wgetFailure(ko.CombinedOut)
+		result.TimedOut = ko.TimedOut
+		result.Detail = ko.CombinedOut
+	}
+	return result
+}
+
+var wgetStatusLine = regexp.MustCompile(`HTTP/\d\.\d ((\d{3})[^\r\n]*)`)
+
+// wgetStatus returns the first status printed by wget -S, it is the
+// response to the request itself rather than to a redirect
+func wgetStatus(out string) (int, string) {
+	match := wgetStatusLine.FindStringSubmatch(out)
+	if match == nil {
+		return 0, ""
+	}
+	status, _ := strconv.Atoi(match[2])
+	return status, strings.TrimSpace(match[1])
+}
+
+// wgetFailure tells why busybox wget could not get a response
+func wgetFailure(out string) string {
+	switch {
+	case strings.Contains(out, "bad address"):
+		return egressDNS
+	case strings.Contains(out, "timed out"):
+		return egressTimeout
+	default:
+		return egressConnection
+	}
+}
+
+// 6. Check internet connectivity from current machine
+type localInternetCheck struct{}
+
+func (localInternetCheck) Name() string { return "local-internet" }
+func (localInternetCheck) Description() string {
+	return "Access the egress targets from this machine"
+}
+func (localInternetCheck) Severity() Severity     { return Advisory }
+func (localInternetCheck) Tags() []string         { return []string{"egress", "local"} }
+func (localInternetCheck) Dependencies() []string { return nil }
+
+func (localInternetCheck) Run(ctx context.Context, env *Environment) []Result {
+	targets, err := egressTargets()
+	if err != nil {
+		return []Result{{Name: "Parsed egress targets", Detail: err.Error() + "\n"}}
+	}
+	client := &http.Client{
+		Timeout: env.HTTPClient.Timeout,
+		Transport: &http.Transport{
+			Proxy: func(req *http.Request) (*url.URL, error) {
+				if proxy := proxyFor(req.URL.String()); proxy != "" {
+					return url.Parse(proxy)
+				}
+				return nil, nil
+			},
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	results := []Result{}
+	for _, target := range targets {
+		results = append(results, timed(func() Result {
+			return localEgress(ctx, client, target)
+		}))
+	}
+	return results
+}
+
+func localEgress(ctx context.Context, client *http.Client, target EgressTarget) Result {
+	name := "Accessed " + target.URL + " from this node"
+	info := map[string]string{"expected status": target.expected()}
+	if proxy := proxyFor(target.URL); proxy != "" {
+		info["proxy"] = proxy
+	}
+	result := Result{Name: name, Info: info}
+
+	req, err := http.NewRequest("GET", target.URL, nil)
+	if err != nil {
+		result.Detail = err.Error() + "\n"
+		return result
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		info["failure"] = localFailure(err)
+		result.TimedOut = info["failure"] == egressTimeout
+		result.Detail = err.Error() + "\n"
+		return result
+	}
+	resp.Body.Close()
+	info["status"] = resp.Status
+	result.Passed = target.expects(resp.StatusCode)
+	if !result.Passed {
+		info["failure"] = egressStatus
+		result.Detail = fmt.Sprintf("Unexpected status %s, expected %s\n", resp.Status, target.expected())
+	}
+	return result
+}
+
+// localFailure tells why a request from this machine got no response
+func localFailure(err error) string {
+	if isTimeout(err) {
+		return egressTimeout
+	}
+	if urlErr, ok := err.(*url.Error); ok {
+		err = urlErr.Err
+	}
+	if opErr, ok := err.(*net.OpError); ok {
+		err = opErr.Err
+	}
+	if _, ok := err.(*net.DNSError); ok {
+		return egressDNS
+	}
+	return egressConnection
+}
+
+// proxy returns the flag value if set, the first environment variable set
+// otherwise
+func proxy(flag string, envs ...string) string {
+	if flag != "" {
+		return flag
+	}
+	for _, env := range envs {
+		if value := os.Getenv(env); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+func httpProxy() string  { return proxy(config.HTTPProxy, "HTTP_PROXY", "http_proxy") }
+func httpsProxy() string { return proxy(config.HTTPSProxy, "HTTPS_PROXY", "https_proxy") }
+func noProxy() string    { return proxy(config.NoProxy, "NO_PROXY", "no_proxy") }
+
+// proxyEnv is the environment that makes wget in a pod use the proxies
+func proxyEnv() []string {
+	env := []string{}
+	if p := httpProxy(); p != "" {
+		env = append(env, "http_proxy="+p)
+	}
+	if p := httpsProxy(); p != "" {
+		env = append(env, "https_proxy="+p)
+	}
+	if p := noProxy(); p != "" && len(env) > 0 {
+		env = append(env, "no_proxy="+p)
+	}
+	return env
+}
+
+// proxyFor returns the proxy rawurl is fetched through, empty for none.
+// Hosts matching an entry of the no proxy list, or a subdomain of one, are
+// fetched directly.
+func proxyFor(rawurl string) string {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return ""
+	}
+	host := u.Hostname()
+	for _, entry := range strings.Split(noProxy(), ",") {
+		entry = strings.TrimPrefix(strings.TrimSpace(entry), ".")
+		if entry == "*" || (entry != "" && (host == entry || strings.HasSuffix(host, "."+entry))) {
+			return ""
+		}
+	}
+	if u.Scheme == "https" {
+		return httpsProxy()
+	}
+	return httpProxy()
+}
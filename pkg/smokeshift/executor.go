@@ -0,0 +1,105 @@
+package smokeshift
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Executor runs an oc command line and returns its combined output.
+// The workflow never shells out directly, every oc call goes through the
+// Executor of its Environment, so it can run against something other than
+// the oc binary on the path.
+type Executor interface {
+	// Execute runs the command, giving up when ctx is done.
+	Execute(ctx context.Context, args ...string) OCOutput
+}
+
+// OCExecutor is the default Executor, it runs the oc binary found on the path.
+type OCExecutor struct {
+	// Binary overrides the name or path of the oc binary. Defaults to "oc".
+	Binary string
+}
+
+// Execute runs oc with the given arguments, the process is killed when
+// ctx is done.
+func (e OCExecutor) Execute(ctx context.Context, args ...string) OCOutput {
+	binary := e.Binary
+	if binary == "" {
+		binary = "oc"
+	}
+	OCCmd := exec.CommandContext(ctx, binary, args...)
+	bytes, err := OCCmd.CombinedOutput()
+	if err != nil {
+		return OCOutput{
+			Success:     false,
+			CombinedOut: string(bytes),
+			RawOut:      bytes,
+			ExitCode:    exitCode(err),
+		}
+	}
+	return OCOutput{
+		Success:     true,
+		CombinedOut: string(bytes),
+		RawOut:      bytes,
+	}
+}
+
+// exitCode extracts the process exit code from the error returned by
+// CombinedOutput, -1 is returned when the process could not be started.
+func exitCode(err error) int {
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+			return status.ExitStatus()
+		}
+		return 1
+	}
+	return -1
+}
+
+// commandLogOutputLines is how many lines of the output of a failed command
+// the command log keeps
+const commandLogOutputLines = 5
+
+// commandLog records every oc invocation of a run, when it started, how long
+// it took and how it exited, for the diagnostics tarball
+type commandLog struct {
+	mu      sync.Mutex
+	entries []string
+}
+
+var commands = &commandLog{}
+
+func (l *commandLog) record(start time.Time, args []string, ko OCOutput) {
+	status := fmt.Sprintf("exit=%d", ko.ExitCode)
+	if ko.TimedOut {
+		status += " timed out"
+	}
+	entry := fmt.Sprintf("%s %.3fs %s oc %s\n", start.UTC().Format(time.RFC3339), time.Since(start).Seconds(), status, strings.Join(args, " "))
+	if !ko.Success {
+		lines := strings.Split(strings.TrimRight(ko.CombinedOut, "\n"), "\n")
+		if len(lines) > commandLogOutputLines {
+			lines = append(lines[:commandLogOutputLines], "...")
+		}
+		entry += "    " + strings.Join(lines, "\n    ") + "\n"
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, entry)
+}
+
+func (l *commandLog) reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = nil
+}
+
+func (l *commandLog) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return strings.Join(l.entries, "")
+}
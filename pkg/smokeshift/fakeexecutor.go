@@ -0,0 +1,133 @@
+package smokeshift
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FakeResponse is a canned reply of a FakeExecutor. Pattern is a regular
+// expression matched against the space separated oc arguments.
+type FakeResponse struct {
+	Pattern  string
+	Output   string
+	ExitCode int
+	// Times limits how often the response is returned before the next
+	// matching response is used. Zero means the response never runs out.
+	Times int
+	// Delay simulates a slow command, the response is only returned after
+	// the delay unless the context is done first.
+	Delay time.Duration
+
+	re   *regexp.Regexp
+	used int
+}
+
+// FakeExecutor is a scripted, in-memory Executor. Responses are tried in the
+// order they were added and the first matching one that has not run out is
+// returned. Commands without a matching response fail with exit code 1.
+type FakeExecutor struct {
+	mu        sync.Mutex
+	responses []*FakeResponse
+	calls     [][]string
+}
+
+// NewFakeExecutor creates a FakeExecutor with the given responses
+func NewFakeExecutor(responses ...FakeResponse) *FakeExecutor {
+	f := &FakeExecutor{}
+	for _, r := range responses {
+		f.Add(r)
+	}
+	return f
+}
+
+// Add appends a response to the script, panics on an invalid pattern.
+func (f *FakeExecutor) Add(r FakeResponse) *FakeExecutor {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	r.re = regexp.MustCompile(r.Pattern)
+	f.responses = append(f.responses, &r)
+	return f
+}
+
+// On is shorthand for adding a response that never runs out.
+func (f *FakeExecutor) On(pattern string, exitCode int, output string) *FakeExecutor {
+	return f.Add(FakeResponse{Pattern: pattern, ExitCode: exitCode, Output: output})
+}
+
+// Execute returns the first matching canned response and records the call.
+func (f *FakeExecutor) Execute(ctx context.Context, args ...string) OCOutput {
+	r := f.match(args)
+	if r == nil {
+		out := fmt.Sprintf("fake executor: no response for \"oc %s\"\n", strings.Join(args, " "))
+		return OCOutput{
+			Success:     false,
+			CombinedOut: out,
+			RawOut:      []byte(out),
+			ExitCode:    1,
+		}
+	}
+	if r.Delay > 0 {
+		select {
+		case <-time.After(r.Delay):
+		case <-ctx.Done():
+		}
+	}
+	if ctx.Err() != nil {
+		out := "signal: killed\n"
+		return OCOutput{
+			Success:     false,
+			CombinedOut: out,
+			RawOut:      []byte(out),
+			ExitCode:    -1,
+		}
+	}
+	return OCOutput{
+		Success:     r.ExitCode == 0,
+		CombinedOut: r.Output,
+		RawOut:      []byte(r.Output),
+		ExitCode:    r.ExitCode,
+	}
+}
+
+func (f *FakeExecutor) match(args []string) *FakeResponse {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, args)
+	cmdline := strings.Join(args, " ")
+	for _, r := range f.responses {
+		if r.Times > 0 && r.used >= r.Times {
+			continue
+		}
+		if !r.re.MatchString(cmdline) {
+			continue
+		}
+		r.used++
+		return r
+	}
+	return nil
+}
+
+// Calls returns the arguments of every command executed so far.
+func (f *FakeExecutor) Calls() [][]string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	calls := make([][]string, len(f.calls))
+	copy(calls, f.calls)
+	return calls
+}
+
+// Called reports how many executed commands match the pattern.
+func (f *FakeExecutor) Called(pattern string) int {
+	re := regexp.MustCompile(pattern)
+	count := 0
+	for _, args := range f.Calls() {
+		if re.MatchString(strings.Join(args, " ")) {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,259 @@
+package smokeshift
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/opencredo/smokeshift/pkg/config"
+	"github.com/opencredo/smokeshift/pkg/report"
+	"gopkg.in/yaml.v2"
+)
+
+// gatherKinds are the kinds of objects runs create in their project
+var gatherKinds = []string{
+	"pods", "services", "endpoints", "replicationcontrollers", "deploymentconfigs", "daemonsets", "routes",
+	"buildconfigs", "builds", "imagestreams", "persistentvolumeclaims", "networkpolicies", "events",
+}
+
+// gatherLogLines is how many of the last lines are kept per container log
+const gatherLogLines = 1000
+
+// diagnostics are the files of a diagnostics tarball, in the order they
+// were collected, and what could not be read
+type diagnostics struct {
+	names  []string
+	files  map[string][]byte
+	errors []string
+}
+
+func (d *diagnostics) add(name string, data []byte) {
+	d.names = append(d.names, name)
+	d.files[name] = data
+}
+
+func (d *diagnostics) failed(what string, ko OCOutput) {
+	d.errors = append(d.errors, what+": "+firstLine(ko.CombinedOut))
+}
+
+// collectDiagnostics reads what tells what happened in the project of the
+// run: every object as YAML and described, the logs of every container that
+// started, from before the last restart as well, and a summary of the nodes.
+// The second project of the isolation check is read as well when it was left
+// behind. What cannot be read is listed in errors.txt.
+func collectDiagnostics(ctx context.Context, env *Environment) *diagnostics {
+	d := &diagnostics{files: map[string][]byte{}}
+	d.addProject(ctx, env, config.Namespace, "")
+	if ko := env.RunGetProject(ctx, isolationNamespace()); ko.Success {
+		d.addProject(ctx, env, isolationNamespace(), "isolated/")
+	}
+
+	if !config.Restricted {
+		if ko := env.RunGetNodes(ctx); ko.Success {
+			var summary bytes.Buffer
+			printNodes(&summary, nodeInventory(ko.Nodes()))
+			d.add("nodes.txt", summary.Bytes())
+			if data, err := jsonToYAML(ko.RawOut); err == nil {
+				d.add("nodes.yaml", data)
+			}
+		} else {
+			d.failed("get nodes", ko)
+		}
+	}
+	return d
+}
+
+// addProject adds the objects and container logs of namespace under dir
+func (d *diagnostics) addProject(ctx context.Context, env *Environment, namespace, dir string) {
+	in := ""
+	if dir != "" {
+		in = " in project " + namespace
+	}
+	lists := map[string]OCOutput{}
+	for _, kind := range gatherKinds {
+		ko := env.RunOC(ctx, "--namespace="+namespace, "get", kind, "-o", "json")
+		if !ko.Success {
+			d.failed("get "+kind+in, ko)
+			continue
+		}
+		lists[kind] = ko
+		data, err := jsonToYAML(ko.RawOut)
+		if err != nil {
+			d.errors = append(d.errors, "get "+kind+in+": "+err.Error())
+			continue
+		}
+		d.add(dir+"project/"+kind+".yaml", data)
+	}
+	d.add(dir+"project/describe.txt", describeObjects(lists))
+
+	for _, pod := range lists["pods"].PodStates() {
+		restarted := map[string]bool{}
+		for _, container := range pod.Restarted {
+			restarted[container] = true
+		}
+		for _, container := range pod.Logged {
+			d.addLogs(ctx, env, namespace, dir, pod.Name, container, false)
+			if restarted[container] {
+				d.addLogs(ctx, env, namespace, dir, pod.Name, container, true)
+			}
+		}
+	}
+}
+
+// describeObjects tells the phase and conditions of every object listed and
+// the events about it, like oc describe but from the lists already read so
+// that both backends produce it
+func describeObjects(lists map[string]OCOutput) []byte {
+	events := map[string][]Event{}
+	for _, e := range lists["events"].Events() {
+		events[e.Object] = append(events[e.Object], e)
+	}
+	var b bytes.Buffer
+	for _, kind := range gatherKinds {
+		if kind == "events" {
+			continue
+		}
+		for _, obj := range lists[kind].ObjectStatuses() {
+			object := objectKind(kind) + "/" + obj.Name
+			b.WriteString(object + "\n")
+			if obj.Created != "" {
+				b.WriteString("  Created:   " + obj.Created + "\n")
+			}
+			if obj.Phase != "" {
+				b.WriteString("  Phase:     " + obj.Phase + "\n")
+			}
+			for _, condition := range obj.Conditions {
+				b.WriteString("  Condition: " + condition + "\n")
+			}
+			for _, e := range events[object] {
+				count := ""
+				if e.Count > 1 {
+					count = fmt.Sprintf(" (x%d)", e.Count)
+				}
+				fmt.Fprintf(&b, "  Event:     %s %s%s: %s\n", e.Type, e.Reason, count, firstLine(e.Message))
+			}
+		}
+	}
+	return b.Bytes()
+}
+
+// objectKind is how events name the objects of a kind gathered, e.g. pod
+// for pods
+func objectKind(kind string) string {
+	switch {
+	case kind == "endpoints":
+		return kind
+	case strings.HasSuffix(kind, "ies"):
+		return strings.TrimSuffix(kind, "ies") + "y"
+	}
+	return strings.TrimSuffix(kind, "s")
+}
+
+// addLogs adds the log of a container, or of its previous run
+func (d *diagnostics) addLogs(ctx context.Context, env *Environment, namespace, dir, pod, container string, previous bool) {
+	args := []string{"logs", pod, "--container=" + container, "--tail=" + strconv.Itoa(gatherLogLines)}
+	name := dir + "logs/" + pod + "/" + container + ".log"
+	if previous {
+		args = append(args, "--previous")
+		name = dir + "logs/" + pod + "/" + container + ".previous.log"
+	}
+	if ko := env.RunOC(ctx, append([]string{"--namespace=" + namespace}, args...)...); ko.Success {
+		d.add(name, ko.RawOut)
+	} else {
+		d.failed(strings.Join(args, " "), ko)
+	}
+}
+
+// write writes the tarball to path with the oc commands run so far and rep,
+// if not nil, everything under a directory named after the file
+func (d *diagnostics) write(path string, rep *report.Report) (err error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+
+	names := append([]string{}, d.names...)
+	files := map[string][]byte{"commands.log": []byte(commands.String())}
+	names = append(names, "commands.log")
+	if rep != nil {
+		var buf bytes.Buffer
+		if err := report.WriteJSON(&buf, rep); err != nil {
+			return err
+		}
+		files["report.json"] = buf.Bytes()
+		names = append(names, "report.json")
+	}
+	if len(d.errors) > 0 {
+		files["errors.txt"] = []byte(strings.Join(d.errors, "\n") + "\n")
+		names = append(names, "errors.txt")
+	}
+
+	dir := strings.TrimSuffix(strings.TrimSuffix(filepath.Base(path), ".tgz"), ".tar.gz")
+	now := time.Now()
+	for _, name := range names {
+		data, ok := files[name]
+		if !ok {
+			data = d.files[name]
+		}
+		header := &tar.Header{Name: dir + "/" + name, Mode: 0644, Size: int64(len(data)), ModTime: now}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := tw.Write(data); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// diagnosticsPath is --diagnostics-file, or a name with the time of the run
+// in the current directory
+func diagnosticsPath(start time.Time) string {
+	if config.DiagnosticsFile != "" {
+		return config.DiagnosticsFile
+	}
+	return "smokeshift-diagnostics-" + start.Format("20060102-150405") + ".tar.gz"
+}
+
+// jsonToYAML converts what oc printed with -o json to YAML
+func jsonToYAML(data []byte) ([]byte, error) {
+	var obj interface{}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(obj)
+}
+
+// Gather writes the diagnostics tarball of a project left behind by a run,
+// e.g. with --skip-cleanup, and returns its path. Every oc call goes through
+// e, what is not read before ctx is done is listed in errors.txt.
+func Gather(ctx context.Context, e Executor) (string, error) {
+	commands.reset()
+	env := &Environment{Executor: e}
+	if ko := env.RunGetProject(ctx, config.Namespace); !ko.Success {
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		return "", fmt.Errorf("Project %s not found: %s", config.Namespace, firstLine(ko.CombinedOut))
+	}
+	path := diagnosticsPath(time.Now())
+	return path, collectDiagnostics(ctx, env).write(path, nil)
+}
@@ -0,0 +1,169 @@
+package smokeshift
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/opencredo/smokeshift/pkg/config"
+)
+
+// The build check runs a Docker build in the smokeshift project, the image is
+// pushed to an image stream in the internal registry and a pod deployed from
+// it must serve the page the build wrote.
+func init() {
+	Register(buildCheck{})
+}
+
+const (
+	buildName    = runPrefix + "build"
+	buildTimeout = 600 * time.Second
+	// builtPage is served by the image the build produces
+	builtPage = "Built by smokeshift"
+)
+
+type buildCheck struct{}
+
+func (buildCheck) Name() string { return "build" }
+func (buildCheck) Description() string {
+	return "Build an image, push it to the internal registry, deploy it from its image stream and access it from BusyBox"
+}
+func (buildCheck) Severity() Severity     { return Advisory }
+func (buildCheck) Tags() []string         { return []string{"build", "registry"} }
+func (buildCheck) Dependencies() []string { return nil }
+func (buildCheck) Permissions() []Permission {
+	return []Permission{
+		{Verb: "create", Resource: "imagestreams"},
+		{Verb: "create", Resource: "buildconfigs"},
+		{Verb: "create", Resource: "buildconfigs/instantiate"},
+	}
+}
+
+// Run stops at the first step that fails, the later ones need its outcome
+func (buildCheck) Run(ctx context.Context, env *Environment) []Result {
+	var digest string
+	var pod Pod
+	steps := []func() Result{
+		func() Result {
+			var r Result
+			digest, r = runBuild(ctx, env)
+			return r
+		},
+		func() Result { return checkImageStream(ctx, env, digest) },
+		func() Result {
+			var r Result
+			pod, r = deployBuiltImage(ctx, env)
+			return r
+		},
+		func() Result {
+			name := "Accessed pod built by smokeshift at " + pod.IP + " from BusyBox"
+			ko := env.RunOCinNamespace(ctx, "exec", env.Busybox.Name, "--", "wget", "-qO-", nginxAddress(pod.IP))
+			r := ocResult(name, pod.target(), ko)
+			if ko.Success && !strings.Contains(ko.CombinedOut, builtPage) {
+				r.Passed = false
+				r.Detail = "The page served is not the one built:\n" + ko.CombinedOut
+			}
+			return r
+		},
+	}
+	results := []Result{}
+	for _, step := range steps {
+		result := timed(step)
+		results = append(results, result)
+		if !result.Passed {
+			break
+		}
+	}
+	return results
+}
+
+// runBuild creates the image stream and the build config, starts a build and
+// waits for it to complete, returning the digest of the image pushed
+func runBuild(ctx context.Context, env *Environment) (string, Result) {
+	name := "Built and pushed image " + buildName
+	page := "RUN echo '" + builtPage + "' > /usr/share/nginx/html/index.html\n"
+	if config.Restricted {
+		// The unprivileged image runs as the nginx user, which cannot write
+		// the page
+		page = "USER root\n" + page + "USER nginx\n"
+	}
+	dockerfile := "FROM " + nginxImage() + "\n" + page
+	if ko := env.RunCreate(ctx, imageStream(buildName), dockerBuildConfig(buildName, dockerfile)); !ko.Success {
+		return "", ocResult(name, nil, ko)
+	}
+	ko := env.RunOCinNamespace(ctx, "start-build", buildName, "-o", "name")
+	if !ko.Success {
+		return "", ocResult(name, nil, ko)
+	}
+	build := strings.TrimPrefix(strings.TrimSpace(ko.CombinedOut), "build/")
+
+	var status BuildStatus
+	r := waitUntil(ctx, name, "build "+build+" to finish", buildTimeout, func() bool {
+		status = env.RunOCinNamespace(ctx, "get", "build", build, "-o", "json").BuildStatus()
+		return status.Done()
+	})
+	r.Info = withInfo(nil, "build", build, "phase", status.Phase, "image", status.ImageDigest)
+	if status.Duration > 0 {
+		r.Info["build time"] = status.Duration.String()
+	}
+	if status.PushDuration > 0 {
+		r.Info["push time"] = status.PushDuration.String()
+	}
+	if r.Passed && status.Phase != "Complete" {
+		r.Passed = false
+		r.Detail = "Build " + build + " " + strings.ToLower(status.Phase) + ": " + status.Reason + " " + status.Message + "\n"
+		if logs := env.RunOCinNamespace(ctx, "logs", "build/"+build, "--tail=20"); logs.Success {
+			r.Detail += logs.CombinedOut
+		}
+	}
+	return status.ImageDigest, r
+}
+
+// checkImageStream expects the latest tag of the image stream to point to
+// the image built
+func checkImageStream(ctx context.Context, env *Environment, digest string) Result {
+	name := "Image stream " + buildName + " tagged the image in the internal registry"
+	ko := env.RunOCinNamespace(ctx, "get", "is", buildName, "-o", "json")
+	if !ko.Success {
+		return ocResult(name, nil, ko)
+	}
+	repository, images := ko.ImageStreamTag("latest")
+	r := Result{Name: name, Info: withInfo(nil, "repository", repository)}
+	switch {
+	case repository == "":
+		r.Detail = "The image stream has no repository in the internal registry\n"
+	case len(images) == 0:
+		r.Detail = "The latest tag has no image\n"
+	case digest != "" && images[0] != digest:
+		r.Detail = "The latest tag points to " + images[0] + " rather than " + digest + "\n"
+	default:
+		r.Passed = true
+	}
+	return r
+}
+
+// deployBuiltImage deploys the latest tag of the image stream and waits for
+// the pod to be ready, which needs the image to be pulled from the internal
+// registry
+func deployBuiltImage(ctx context.Context, env *Environment) (Pod, Result) {
+	name := "Deployed image stream tag " + buildName + ":latest"
+	start := time.Now()
+	if ko := env.RunCreate(ctx, imageStreamDeploymentConfig(buildName, nginxPort())); !ko.Success {
+		return Pod{}, ocResult(name, nil, ko)
+	}
+	r := waitUntil(ctx, name, "the deployment", deploymentTimeout, func() bool {
+		return env.RunGetDeployment(ctx, buildName).ObservedReplicaCount() == 1
+	})
+	r.Info = withInfo(nil, "deploy time", time.Since(start).String())
+	if !r.Passed {
+		return Pod{}, r
+	}
+	pods := env.RunOCinNamespace(ctx, "get", "pods", "-l", "run="+buildName, "-o", "json").Pods()
+	if len(pods) == 0 {
+		r.Passed = false
+		r.Detail = "No pod found for the deployment\n"
+		return Pod{}, r
+	}
+	r.Target = pods[0].target()
+	return pods[0], r
+}
@@ -0,0 +1,229 @@
+package smokeshift
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/opencredo/smokeshift/pkg/config"
+	"github.com/opencredo/smokeshift/pkg/report"
+)
+
+// The isolation check accesses the Nginx pods and service from a client pod
+// in a second project. Whether it should get through depends on the SDN
+// mode: ovs-multitenant isolates projects unless their networks are joined,
+// the other modes do not unless policies say so.
+func init() {
+	Register(isolationCheck{})
+}
+
+const isolationClientName = runPrefix + "isolated-client"
+
+// defaultIsolation tells, by SDN mode, whether projects are isolated, modes
+// not listed are open
+var defaultIsolation = map[string]bool{"multitenant": true}
+
+// ParseIsolationExpectations parses MODE=isolated or MODE=open entries into
+// whether each SDN mode isolates projects
+func ParseIsolationExpectations(entries []string) (map[string]bool, error) {
+	expectations := map[string]bool{}
+	for _, entry := range entries {
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || (parts[1] != "isolated" && parts[1] != "open") {
+			return nil, fmt.Errorf("invalid isolation expectation %q, expected MODE=isolated or MODE=open", entry)
+		}
+		expectations[parts[0]] = parts[1] == "isolated"
+	}
+	return expectations, nil
+}
+
+func isolationNamespace() string {
+	return config.Namespace + "-isolated"
+}
+
+type isolationCheck struct{}
+
+func (isolationCheck) Name() string { return "project-isolation" }
+func (isolationCheck) Description() string {
+	return "Access the Nginx pods and service from a second project, expecting isolation as per the SDN mode"
+}
+func (isolationCheck) Severity() Severity     { return Advisory }
+func (isolationCheck) Tags() []string         { return []string{"network", "isolation"} }
+func (isolationCheck) Dependencies() []string { return []string{"service-ip", "pod-ip"} }
+
+// ClusterAccess is needed to read the cluster network unless the SDN mode is
+// given, and to join the projects
+func (isolationCheck) ClusterAccess() []string {
+	needs := []string{}
+	if config.SDNMode == "" {
+		needs = append(needs, "read the cluster network, set --sdn-mode")
+	}
+	if config.JoinProjects {
+		needs = append(needs, "join project networks")
+	}
+	return needs
+}
+
+func (isolationCheck) Permissions() []Permission {
+	permissions := []Permission{}
+	if config.SDNMode == "" {
+		permissions = append(permissions, Permission{Verb: "get", Resource: "clusternetworks", Cluster: true})
+	}
+	if config.JoinProjects {
+		permissions = append(permissions, Permission{Verb: "update", Resource: "netnamespaces", Cluster: true})
+	}
+	return permissions
+}
+
+func (isolationCheck) Run(ctx context.Context, env *Environment) []Result {
+	var mode string
+	var isolated bool
+	detected := timed(func() Result {
+		var r Result
+		mode, isolated, r = isolationExpectation(ctx, env)
+		return r
+	})
+	if !detected.Passed {
+		return []Result{detected}
+	}
+	results := []Result{detected}
+
+	namespace := isolationNamespace()
+	created := timed(func() Result {
+		name := "Created project " + namespace
+		ko := env.RunCreateProject(ctx, namespace)
+		return ocResult(name, nil, ko)
+	})
+	results = append(results, created)
+	if !created.Passed {
+		return results
+	}
+
+	var client Pod
+	started := timed(func() Result {
+		var r Result
+		client, r = startIsolatedClient(ctx, env, namespace)
+		return r
+	})
+	results = append(results, started)
+	if started.Passed {
+		results = append(results, isolationProbes(ctx, env, client, !isolated, "")...)
+		if config.JoinProjects {
+			joined := timed(func() Result {
+				name := "Joined the pod network of project " + namespace + " to " + config.Namespace
+				if mode != "multitenant" {
+					return Result{Name: name, Detail: "Joining projects needs the ovs-multitenant plugin, the SDN mode is " + mode + "\n"}
+				}
+				return ocResult(name, nil, env.RunJoinProjects(ctx, config.Namespace, namespace))
+			})
+			results = append(results, joined)
+			if joined.Passed {
+				results = append(results, isolationProbes(ctx, env, client, true, " once joined")...)
+			}
+		}
+	}
+
+	if !env.SkipCleanup {
+		results = append(results, timed(func() Result {
+			// The project outlives the run unless deleted after a timeout
+			// or an interrupt as well
+			cleanupCtx, cancel := cleanupContext()
+			defer cancel()
+			return ocResult("Deleted project "+namespace, nil, env.RunDeleteProject(cleanupCtx, namespace))
+		}))
+	}
+	return results
+}
+
+// isolationExpectation returns the SDN mode, from --sdn-mode or the cluster
+// network, and whether it isolates projects
+func isolationExpectation(ctx context.Context, env *Environment) (string, bool, Result) {
+	name := "Found the SDN mode"
+	expectations, err := ParseIsolationExpectations(config.IsolationExpectations)
+	if err != nil {
+		return "", false, Result{Name: name, Detail: err.Error() + "\n"}
+	}
+	mode := config.SDNMode
+	if mode == "" {
+		ko := env.RunOC(ctx, "get", "clusternetwork", "default", "-o", "json")
+		if !ko.Success {
+			r := ocResult(name, nil, ko)
+			r.Detail += "Set --sdn-mode if the cluster network cannot be read\n"
+			return "", false, r
+		}
+		mode = ko.SDNMode()
+	}
+	isolated, ok := expectations[mode]
+	if !ok {
+		isolated = defaultIsolation[mode]
+	}
+	expected := "open"
+	if isolated {
+		expected = "isolated"
+	}
+	return mode, isolated, Result{Name: name, Passed: mode != "", Info: map[string]string{"sdn mode": mode, "projects": expected}}
+}
+
+// startIsolatedClient runs the client pod in namespace and waits for it
+func startIsolatedClient(ctx context.Context, env *Environment, namespace string) (Pod, Result) {
+	name := "Started client pod in project " + namespace
+	if ko := env.RunCreateInNamespace(ctx, namespace, idlePod(isolationClientName, registryImage("alpine:3.5"))); !ko.Success {
+		return Pod{}, ocResult(name, nil, ko)
+	}
+	var client Pod
+	r := waitUntil(ctx, name, "the client pod", deploymentTimeout, func() bool {
+		pods := env.RunOC(ctx, "--namespace="+namespace, "get", "pods", "-l", "run="+isolationClientName, "-o", "json").Pods()
+		if len(pods) == 0 || !pods[0].Ready {
+			return false
+		}
+		client = pods[0]
+		return true
+	})
+	return client, r
+}
+
+// isolationProbes accesses every Nginx pod and the service from the client
+// in the second project, expecting them to be reachable or not
+func isolationProbes(ctx context.Context, env *Environment, client Pod, reachable bool, suffix string) []Result {
+	targets := []*report.Target{{IP: env.ServiceIP}}
+	for _, pod := range env.NginxPods {
+		targets = append(targets, pod.target())
+	}
+	namespace := isolationNamespace()
+	results := []Result{}
+	for _, target := range targets {
+		what, address := "Nginx service at "+target.IP, target.IP
+		if target.Pod != "" {
+			what, address = "Nginx pod at "+target.IP, nginxAddress(target.IP)
+		}
+		result := timed(func() Result {
+			var ko OCOutput
+			attempts := 1
+			if reachable {
+				// Reachable targets get retried like every other probe,
+				// a single refusal is enough for isolated ones
+				attempts = 3
+			}
+			retry(ctx, attempts, func() bool {
+				ko = env.RunOC(ctx, "--namespace="+namespace, "exec", client.Name, "--", "wget", "-qO-", "-T", "2", address)
+				return ko.Success
+			})
+			if reachable {
+				return ocResult("Accessed "+what+" from project "+namespace+suffix, target, ko)
+			}
+			// Only wget failing to connect shows isolation, oc exec or the
+			// API server failing shows nothing
+			r := Result{Name: what + " unreachable from project " + namespace + suffix, Passed: wgetUnreachable(ko), Target: target, TimedOut: ko.TimedOut}
+			switch {
+			case ko.Success:
+				r.Detail = "Reached " + target.IP + " across projects, they are not isolated\n"
+			case !r.Passed:
+				r.Detail = "Could not probe " + target.IP + " from project " + namespace + ":\n" + ko.CombinedOut
+			}
+			return r
+		})
+		result.Source = client.target()
+		results = append(results, result)
+	}
+	return results
+}
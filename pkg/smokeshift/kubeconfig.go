@@ -0,0 +1,176 @@
+package smokeshift
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Kubeconfig is the subset of a kubeconfig file needed to reach the API server
+type Kubeconfig struct {
+	CurrentContext string `yaml:"current-context"`
+	Clusters       []struct {
+		Name    string `yaml:"name"`
+		Cluster struct {
+			Server                   string `yaml:"server"`
+			CertificateAuthority     string `yaml:"certificate-authority"`
+			CertificateAuthorityData string `yaml:"certificate-authority-data"`
+			InsecureSkipTLSVerify    bool   `yaml:"insecure-skip-tls-verify"`
+		} `yaml:"cluster"`
+	} `yaml:"clusters"`
+	Contexts []struct {
+		Name    string `yaml:"name"`
+		Context struct {
+			Cluster   string `yaml:"cluster"`
+			User      string `yaml:"user"`
+			Namespace string `yaml:"namespace"`
+		} `yaml:"context"`
+	} `yaml:"contexts"`
+	Users []struct {
+		Name string `yaml:"name"`
+		User struct {
+			Token                 string `yaml:"token"`
+			ClientCertificate     string `yaml:"client-certificate"`
+			ClientCertificateData string `yaml:"client-certificate-data"`
+			ClientKey             string `yaml:"client-key"`
+			ClientKeyData         string `yaml:"client-key-data"`
+			Username              string `yaml:"username"`
+			Password              string `yaml:"password"`
+		} `yaml:"user"`
+	} `yaml:"users"`
+
+	dir string
+}
+
+// APIConfig is the resolved current context of a kubeconfig
+type APIConfig struct {
+	Server    string
+	Namespace string
+	Token     string
+	Username  string
+	Password  string
+	TLS       *tls.Config
+}
+
+// KubeconfigPath returns the kubeconfig file to use when none is given:
+// the first entry of $KUBECONFIG or ~/.kube/config.
+func KubeconfigPath() string {
+	if env := os.Getenv("KUBECONFIG"); env != "" {
+		return filepath.SplitList(env)[0]
+	}
+	home := os.Getenv("HOME")
+	if home == "" {
+		home = os.Getenv("USERPROFILE")
+	}
+	return filepath.Join(home, ".kube", "config")
+}
+
+// LoadKubeconfig reads and parses a kubeconfig file
+func LoadKubeconfig(path string) (*Kubeconfig, error) {
+	if path == "" {
+		path = KubeconfigPath()
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading kubeconfig: %v", err)
+	}
+	kc := &Kubeconfig{dir: filepath.Dir(path)}
+	if err := yaml.Unmarshal(data, kc); err != nil {
+		return nil, fmt.Errorf("parsing kubeconfig %s: %v", path, err)
+	}
+	return kc, nil
+}
+
+// CurrentConfig resolves the current context into an APIConfig
+func (kc *Kubeconfig) CurrentConfig() (*APIConfig, error) {
+	if kc.CurrentContext == "" {
+		return nil, errors.New("kubeconfig has no current-context")
+	}
+	var clusterName, userName, namespace string
+	found := false
+	for _, c := range kc.Contexts {
+		if c.Name == kc.CurrentContext {
+			clusterName, userName, namespace = c.Context.Cluster, c.Context.User, c.Context.Namespace
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("context %q not found in kubeconfig", kc.CurrentContext)
+	}
+
+	cfg := &APIConfig{Namespace: namespace, TLS: &tls.Config{}}
+	found = false
+	for _, c := range kc.Clusters {
+		if c.Name != clusterName {
+			continue
+		}
+		found = true
+		cfg.Server = strings.TrimSuffix(c.Cluster.Server, "/")
+		cfg.TLS.InsecureSkipVerify = c.Cluster.InsecureSkipTLSVerify
+		ca, err := kc.readData(c.Cluster.CertificateAuthorityData, c.Cluster.CertificateAuthority)
+		if err != nil {
+			return nil, fmt.Errorf("reading certificate authority: %v", err)
+		}
+		if len(ca) > 0 {
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(ca) {
+				return nil, fmt.Errorf("no certificates found in certificate authority of cluster %q", clusterName)
+			}
+			cfg.TLS.RootCAs = pool
+		}
+		break
+	}
+	if !found {
+		return nil, fmt.Errorf("cluster %q not found in kubeconfig", clusterName)
+	}
+
+	for _, u := range kc.Users {
+		if u.Name != userName {
+			continue
+		}
+		cfg.Token = u.User.Token
+		cfg.Username = u.User.Username
+		cfg.Password = u.User.Password
+		cert, err := kc.readData(u.User.ClientCertificateData, u.User.ClientCertificate)
+		if err != nil {
+			return nil, fmt.Errorf("reading client certificate: %v", err)
+		}
+		key, err := kc.readData(u.User.ClientKeyData, u.User.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("reading client key: %v", err)
+		}
+		if len(cert) > 0 {
+			pair, err := tls.X509KeyPair(cert, key)
+			if err != nil {
+				return nil, fmt.Errorf("loading client certificate: %v", err)
+			}
+			cfg.TLS.Certificates = []tls.Certificate{pair}
+		}
+		break
+	}
+	return cfg, nil
+}
+
+// readData returns the base64 decoded inline data or the contents of the
+// file, relative paths are resolved against the kubeconfig directory.
+func (kc *Kubeconfig) readData(data, file string) ([]byte, error) {
+	if data != "" {
+		return base64.StdEncoding.DecodeString(data)
+	}
+	if file == "" {
+		return nil, nil
+	}
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(kc.dir, file)
+	}
+	return ioutil.ReadFile(file)
+}
@@ -1,15 +1,19 @@
 package smokeshift
 
 import (
+	"context"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
-	"os"
+	"net/url"
+	"strconv"
 	"time"
 
 	"errors"
 
 	"github.com/opencredo/smokeshift/pkg/config"
+	"github.com/opencredo/smokeshift/pkg/report"
 	"github.com/opencredo/smokeshift/pkg/util"
 	"strings"
 )
@@ -18,333 +22,504 @@ const (
 	runPrefix         = "smokeshift-"
 	bbDeploymentName  = runPrefix + "busybox"
 	ngDeploymentName  = runPrefix + "nginx"
+	meshDaemonSetName = runPrefix + "mesh"
 	deploymentTimeout = 300 * time.Second
 	httpTimeout       = 1000 * time.Millisecond
 )
 
-// CheckOpenshift runs checks against a cluster. It expects to find
-// a configured `oc` binary in the path.
-func CheckOpenshift(skipCleanup bool) error {
-	out := os.Stdout
+// CheckOpenshift runs checks against a cluster, every oc call goes through
+// e, e.g. an OCExecutor with a configured `oc` binary in the path. Every oc
+// call and HTTP probe is bound to ctx, cleanup runs even when ctx has
+// already expired or was cancelled by an interrupt, bounded by
+// --cleanup-timeout. Progress is printed to out as it happens, the returned
+// report holds the outcome of every step.
+func CheckOpenshift(ctx context.Context, e Executor, out io.Writer, skipCleanup bool) (rep *report.Report, err error) {
+	rep = report.New(config.Namespace)
+	rec := &recorder{out: out, report: rep}
+	commands.reset()
+	var collected *diagnostics
+	defer func() {
+		rep.Interrupted = ctx.Err() == context.Canceled
+		rep.Finish(err)
+		if collected != nil {
+			writeDiagnostics(rec, collected)
+		}
+	}()
+
 	ngServiceName := nginxServiceName()
-	success := true
-	registryURL := ""
-	if config.RegistryURL != "" {
-		registryURL = config.RegistryURL + "/"
+	env := &Environment{
+		Executor:    e,
+		ServiceName: ngServiceName,
+		HTTPClient:  newProbeClient(),
+		SkipCleanup: skipCleanup,
 	}
 
-	// Make sure we have all we need
-	if !checkPreconditions(out) {
-		return errors.New("Pre-conditions failed")
+	s := rec.start(report.PhasePrecondition, "Selected checks are known")
+	checks, err := SelectChecks()
+	if err != nil {
+		s.errored(err.Error() + "\n")
+		return rep, err
 	}
+	s.ok()
 
-	if !skipCleanup {
-		defer powerDown(ngServiceName)
+	// Make sure we have all we need
+	if !checkPreconditions(ctx, env, rec) {
+		return rep, errors.New("Pre-conditions failed")
+	}
+	if !preflightPermissions(ctx, env, rec, checks) {
+		return rep, errors.New("Missing permissions")
 	}
 
-	printUserDetail(out)
+	if skipCleanup {
+		rep.Cleanup = report.CleanupSkipped
+	} else {
+		defer func() {
+			cleanupCtx, cancel := cleanupContext()
+			defer cancel()
+			cleaned := powerDown(cleanupCtx, env, rec, ngServiceName)
+			recordCleanup(rec, cleaned, cleanupCtx.Err() == context.DeadlineExceeded)
+			if !cleaned && err == nil {
+				err = errors.New("Failed to clean up test workloads")
+			}
+		}()
+	}
+	if config.CollectDiagnostics {
+		// Deferred last to run first, while what cleanup deletes is there
+		defer func() {
+			collectCtx, cancel := cleanupContext()
+			defer cancel()
+			collected = collectDiagnostics(collectCtx, env)
+		}()
+	}
+
+	printUserDetail(ctx, env, rec)
 
 	//Create a project in which to deploy the workloads for running the checks
-	if !initProject(out) {
-		return errors.New("Failed to create Project: "+config.Namespace)
+	if !initProject(ctx, env, rec) {
+		return rep, errors.New("Failed to create Project: " + config.Namespace)
 	}
 
 	// Deploy the workloads required for running checks
-	if !deployTestWorkloads(registryURL, out, ngServiceName) {
-		return errors.New("Failed to deploy test workloads")
+	if !deployTestWorkloads(ctx, env, rec, ngServiceName) {
+		return rep, errors.New("Failed to deploy test workloads")
 	}
 
-	// Get IPs of all nginx pods
-	podIPs := []string{}
-	if ko := RunOCinNamespace("get", "pods", "-l", "run=smokeshift-nginx", "-o", "json"); ko.Success {
-		podIPs = ko.PodIPs()
-		util.PrettyPrintOk(out, "Grab nginx pod ip addresses")
-	} else {
-		util.PrettyPrintErr(out, "Grab nginx pod ip addresses")
-		printFailureDetail(out, ko.CombinedOut)
-		success = false
+	// Gate on successful acquisition of all the required names / IPs
+	if !gatherEnvironment(ctx, env, rec) {
+		return rep, errors.New("Failed to get required information from cluster")
 	}
 
-	// Get the service IP of the nginx service
-	var serviceIP string
-	if ko := RunGetService(ngServiceName); ko.Success {
-		serviceIP = ko.ServiceCluserIP()
-		util.PrettyPrintOk(out, "Grab nginx service ip address")
-	} else {
-		util.PrettyPrintErr(out, "Grab nginx service ip address")
-		printFailureDetail(out, ko.CombinedOut)
-		success = false
+	success := runChecks(ctx, rec, checks, env)
+	recordNodes(rec)
+	recordCoverage(rec, env)
+	recordMesh(rec, env)
+	recordPermissionSkips(rec)
+
+	switch ctx.Err() {
+	case context.DeadlineExceeded:
+		return rep, errors.New("Timed out before all checks completed")
+	case context.Canceled:
+		return rep, errors.New("Interrupted before all checks completed")
 	}
+	if !success {
+		return rep, errors.New("One or more required steps failed")
+	}
+	if config.Strict && rep.IgnoredFailures() {
+		return rep, errors.New("One or more advisory steps failed")
+	}
+	return rep, nil
+}
 
-	// Get the name of the busybox pod
-	var busyboxPodName string
-	if ko := RunOCinNamespace("get", "pods", "-l", "run=smokeshift-busybox", "-o", "json"); ko.Success {
-		busyboxPodName = ko.FirstPodName()
-		util.PrettyPrintOk(out, "Grab BusyBox pod name")
+// cleanupContext bounds cleanup by --cleanup-timeout, independently of the
+// run's context which may have expired or been cancelled by then
+func cleanupContext() (context.Context, context.CancelFunc) {
+	if config.CleanupTimeout > 0 {
+		return context.WithTimeout(context.Background(), config.CleanupTimeout)
+	}
+	return context.WithCancel(context.Background())
+}
+
+// recordCleanup prints how cleanup ended and what may be left behind
+func recordCleanup(rec *recorder, cleaned, timedOut bool) {
+	leftBehind := "project " + config.Namespace + " may be left behind, delete it with 'oc delete project " + config.Namespace + "'"
+	switch {
+	case cleaned:
+		rec.report.Cleanup = report.CleanupDone
+		rec.info("Cleanup done, project " + config.Namespace + " deleted")
+	case timedOut:
+		rec.report.Cleanup = report.CleanupTimedOut
+		util.PrettyPrintErr(rec.out, "Cleanup timed out after %s, %s", config.CleanupTimeout, leftBehind)
+	default:
+		rec.report.Cleanup = report.CleanupFailed
+		util.PrettyPrintErr(rec.out, "Cleanup failed, %s", leftBehind)
+	}
+}
+
+// writeDiagnostics writes the tarball once the report is final
+func writeDiagnostics(rec *recorder, collected *diagnostics) {
+	path := diagnosticsPath(rec.report.StartTime)
+	if err := collected.write(path, rec.report); err != nil {
+		util.PrettyPrintErr(rec.out, "Could not write diagnostics to %s: %v", path, err)
+		return
+	}
+	rec.report.Diagnostics = path
+	rec.info("Diagnostics written to " + path)
+}
+
+// gatherEnvironment looks up the pods and service deployed for the checks
+// and adds them to env
+func gatherEnvironment(ctx context.Context, env *Environment, rec *recorder) bool {
+	success := true
+	env.Server = rec.report.Server
+
+	// Get the nodes every nginx pod should run on, nodes cannot be listed
+	// in restricted mode
+	if !config.Restricted {
+		s := rec.start(report.PhaseSetup, "Grab schedulable node names")
+		if ko := env.RunGetNodes(ctx); ko.Success {
+			env.NodeInventory = ko.Nodes()
+			env.Nodes = ko.SchedulableNodes()
+			rec.report.Nodes = nodeInventory(env.NodeInventory)
+			s.ok()
+		} else {
+			s.failed(ko)
+			success = false
+		}
+	}
+
+	// Get IPs of all nginx pods
+	s := rec.start(report.PhaseSetup, "Grab nginx pod ip addresses")
+	if ko := env.RunOCinNamespace(ctx, "get", "pods", "-l", "run=smokeshift-nginx", "-o", "json"); ko.Success {
+		env.NginxPods = ko.Pods()
+		s.ok()
 	} else {
-		util.PrettyPrintErr(out, "Grab BusyBox pod name")
-		printFailureDetail(out, ko.CombinedOut)
+		s.failed(ko)
 		success = false
 	}
+	if config.Restricted {
+		env.Nodes = podNodes(env.NginxPods)
+	}
 
-	// Gate on successful acquisition of all the required names / IPs
-	if !success {
-		return errors.New("Failed to get required information from cluster")
-	}
-
-	// The following checks verify the pod network and the ability for
-	// pods to talk to each other.
-	// 1. Access nginx service via service IP from another pod
-	var kubeOut OCOutput
-	util.PrettyPrintInfo(out,"Trying to access Nginx service at "+serviceIP+" from BusyBox")
-	ok := retry(3, func() bool {
-		kubeOut = RunOCinNamespace("exec", busyboxPodName, "--", "wget", "-qO-", serviceIP)
-		return kubeOut.Success
-	})
-	if ok {
-		util.PrettyPrintOk(out, "Accessed Nginx service at "+serviceIP+" from BusyBox")
+	// Get the service IP of the nginx service
+	s = rec.start(report.PhaseSetup, "Grab nginx service ip address")
+	if ko := env.RunGetService(ctx, env.ServiceName); ko.Success {
+		env.ServiceIP = ko.ServiceCluserIP()
+		s.ok()
 	} else {
-		printFailureDetail(out, kubeOut.CombinedOut)
-		util.PrettyPrintErr(out, "Accessed Nginx service at "+serviceIP+" from BusyBox")
+		s.failed(ko)
 		success = false
 	}
 
-	// 2. Access nginx service via service name (DNS) from another pod
-
-	nginxSvc := ngServiceName
-	util.PrettyPrintInfo(out, "Trying to access Nginx service via DNS "+nginxSvc+" from BusyBox")
-	ok = retry(3, func() bool {
-		kubeOut = RunOCinNamespace("exec", busyboxPodName, "--", "wget", "-qO-", nginxSvc)
-		return kubeOut.Success
-	})
-	if ok {
-		util.PrettyPrintOk(out, "Accessed Nginx service via DNS "+nginxSvc+" from BusyBox")
+	// Get the name of the busybox pod
+	s = rec.start(report.PhaseSetup, "Grab BusyBox pod name")
+	if ko := env.RunOCinNamespace(ctx, "get", "pods", "-l", "run=smokeshift-busybox", "-o", "json"); ko.Success {
+		if pods := ko.Pods(); len(pods) > 0 {
+			env.Busybox = pods[0]
+		}
+		s.ok()
 	} else {
-		util.PrettyPrintErr(out, "Accessed Nginx service via DNS "+nginxSvc+" from BusyBox")
-		printFailureDetail(out, kubeOut.CombinedOut)
+		s.failed(ko)
 		success = false
 	}
 
-	// 3. Access all nginx pods by IP
-	util.PrettyPrintInfo(out, "Trying to access all nginx pods by IP")
-	for _, podIP := range podIPs {
-		ok = retry(3, func() bool {
-			kubeOut = RunOCinNamespace("exec", busyboxPodName, "--", "wget", "-qO-", podIP)
-			return kubeOut.Success
-		})
-		if ok {
-			util.PrettyPrintOk(out, "Accessed Nginx pod at "+podIP+" from BusyBox")
+	// Get the names of the mesh clients
+	if meshMode() {
+		s = rec.start(report.PhaseSetup, "Grab mesh client pod names")
+		if ko := env.RunOCinNamespace(ctx, "get", "pods", "-l", "run="+meshDaemonSetName, "-o", "json"); ko.Success {
+			env.MeshClients = ko.Pods()
+			s.ok()
 		} else {
-			util.PrettyPrintErr(out, "Accessed Nginx pod at "+podIP+" from BusyBox")
-			printFailureDetail(out, kubeOut.CombinedOut)
+			s.failed(ko)
 			success = false
 		}
 	}
 
-	// 4. Check internet connectivity from pod
-	if ko := RunOCinNamespace("exec", busyboxPodName, "--", "wget", "-qO-", "Google.com"); busyboxPodName == "" || ko.Success {
-		util.PrettyPrintOk(out, "Accessed Google.com from BusyBox")
-	} else {
-		util.PrettyPrintErrorIgnored(out, "Accessed Google.com from BusyBox")
-	}
+	return success
+}
 
-	client := http.Client{
-		Timeout: httpTimeout,
+// newProbeClient creates the client used for HTTP probes from this machine
+func newProbeClient() *http.Client {
+	timeout := config.HTTPTimeout
+	if timeout <= 0 {
+		timeout = httpTimeout
 	}
-	// 5. Check connectivity from current machine to all nginx pods
-	for _, podIP := range podIPs {
-		if _, err := client.Get("http://" + podIP); err == nil {
-			util.PrettyPrintOk(out, "Accessed Nginx pod at "+podIP+" from this node")
-		} else {
-			util.PrettyPrintErrorIgnored(out, "Accessed Nginx pod at "+podIP+" from this node")
-		}
+	return &http.Client{
+		Timeout: timeout,
 	}
+}
 
-	// 6. Check internet connectivity from current machine
-	if _, err := client.Get("http://google.com/"); err == nil {
-		util.PrettyPrintOk(out, "Accessed Google.com from this node")
-	} else {
-		util.PrettyPrintErrorIgnored(out, "Accessed Google.com from this node")
+// httpGet fetches url from this machine, giving up when ctx is done
+func httpGet(ctx context.Context, client *http.Client, url string) error {
+	_, err := httpStatus(ctx, client, url)
+	return err
+}
+
+// httpStatus fetches url from this machine and returns the response status,
+// e.g. "200 OK"
+func httpStatus(ctx context.Context, client *http.Client, url string) (string, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return "", err
 	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	return resp.Status, nil
+}
 
-	if !success {
-		return errors.New("One or more required steps failed")
+// isTimeout reports whether err was caused by a deadline rather than a
+// failure to connect
+func isTimeout(err error) bool {
+	if err == context.DeadlineExceeded || err == context.Canceled {
+		return true
+	}
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		return true
+	}
+	if urlErr, ok := err.(*url.Error); ok {
+		return isTimeout(urlErr.Err)
 	}
-	return nil
+	return false
 }
 
-func deployTestWorkloads(registryURL string, out io.Writer, ngServiceName string) bool {
+func deployTestWorkloads(ctx context.Context, env *Environment, rec *recorder, ngServiceName string) bool {
 	// Scale out busybox
 	busyboxCount := int64(1)
-	if ko := RunOCinNamespace("run", bbDeploymentName, fmt.Sprintf("--image=%salpine:3.5", registryURL), "--", "sleep", "3600"); !ko.Success {
-		util.PrettyPrintErr(out, "Issued BusyBox start request")
-		printFailureDetail(out, ko.CombinedOut)
+	s := rec.start(report.PhaseSetup, "Issued BusyBox start request")
+	if ko := env.RunOCinNamespace(ctx, "run", bbDeploymentName, "--image="+registryImage("alpine:3.5"), "--", "sleep", "3600"); !ko.Success {
+		s.failed(ko)
 		return false
 
 	}
-	util.PrettyPrintOk(out, "Issued BusyBox start request")
+	s.ok()
 
 	// Scale out nginx
-	// Try to run a Pod on each Node,
-	// This scheduling is not guaranteed but it gets close
-	nginxCount := int64(RunGetNodes().NodeCount())
-	if ko := RunPod(ngDeploymentName, fmt.Sprintf("%snginx:stable-alpine", registryURL), nginxCount); !ko.Success {
-		util.PrettyPrintErr(out, "Issued Nginx start request")
-		printFailureDetail(out, ko.CombinedOut)
+	// A DaemonSet runs a Pod on each Node the scheduler allows
+	s = rec.start(report.PhaseSetup, "Issued Nginx start request")
+	if ko := env.RunCreate(ctx, nginxDaemonSet(ngDeploymentName, nginxImage(), nginxPort())); !ko.Success {
+		s.failed(ko)
 		return false
 	}
-	util.PrettyPrintOk(out, "Issued Nginx start request")
+	s.ok()
 
 	// Add service
-	if ko := RunOCinNamespace("expose", "dc", ngDeploymentName, "--name="+ngServiceName, "--port=80"); !ko.Success {
-		util.PrettyPrintErr(out, "Issued expose Nginx service request")
-		printFailureDetail(out, ko.CombinedOut)
+	s = rec.start(report.PhaseSetup, "Issued expose Nginx service request")
+	if ko := env.RunCreate(ctx, service(ngServiceName, ngDeploymentName, 80, nginxPort())); !ko.Success {
+		s.failed(ko)
 		return false
 	}
-	util.PrettyPrintOk(out, "Issued expose Nginx service request")
+	s.ok()
+
+	// Run a client on each Node to probe the Nginx pods from
+	if meshMode() {
+		s = rec.start(report.PhaseSetup, "Issued mesh client start request")
+		if ko := env.RunCreate(ctx, clientDaemonSet(meshDaemonSetName, registryImage("alpine:3.5"))); !ko.Success {
+			s.failed(ko)
+			return false
+		}
+		s.ok()
+	}
 
 	// Wait until deployments are ready
-	return waitForDeployments(busyboxCount, nginxCount)
+	return waitForDeployments(ctx, env, rec, busyboxCount)
 }
 
-func initProject(out io.Writer) bool {
-	ocOut := RunGetProject(config.Namespace)
-	progressMsg := "Issued delete "+config.Namespace + " project request"
+func initProject(ctx context.Context, env *Environment, rec *recorder) bool {
+	ocOut := env.RunGetProject(ctx, config.Namespace)
 	if ocOut.Success {
 		//smokeshift project exists so delete it
-		if ocDelOut := RunDeleteProject(config.Namespace); !ocDelOut.Success {
-			util.PrettyPrintErr(out, progressMsg)
-			printFailureDetail(out, ocDelOut.CombinedOut)
+		s := rec.start(report.PhaseSetup, "Issued delete "+config.Namespace+" project request")
+		if ocDelOut := env.RunDeleteProject(ctx, config.Namespace); !ocDelOut.Success {
+			s.failed(ocDelOut)
 			return false
 		}
-		util.PrettyPrintOk(out, progressMsg)
+		s.ok()
 	}
 
-	return createProject(out)
+	return createProject(ctx, env, rec)
 }
 
-func createProject(out io.Writer) bool {
-	progressMsg := "Issued create "+config.Namespace + " project request"
-	if ocOut := RunCreateProject(config.Namespace); !ocOut.Success {
-		util.PrettyPrintErr(out, progressMsg)
-		printFailureDetail(out, ocOut.CombinedOut)
+func createProject(ctx context.Context, env *Environment, rec *recorder) bool {
+	s := rec.start(report.PhaseSetup, "Issued create "+config.Namespace+" project request")
+	if ocOut := env.RunCreateProject(ctx, config.Namespace); !ocOut.Success {
+		s.failed(ocOut)
 		return false
 	}
-	util.PrettyPrintOk(out, progressMsg)
+	s.ok()
 
-	user := "system:serviceaccount:"+config.Namespace+":default"
-	progressMsg = "Enable containers with any user id to be launched in project "+config.Namespace
-	if ocOut := RunEnablePolicy("add-scc-to-user", "anyuid", user); !ocOut.Success {
-		util.PrettyPrintErr(out, progressMsg)
-		printFailureDetail(out, ocOut.CombinedOut)
+	// Granting an SCC is cluster-scoped, restricted mode makes do with the
+	// restricted SCC
+	if config.Restricted {
+		return true
+	}
+
+	user := "system:serviceaccount:" + config.Namespace + ":default"
+	s = rec.start(report.PhaseSetup, "Enable containers with any user id to be launched in project "+config.Namespace)
+	if ocOut := env.RunEnablePolicy(ctx, "add-scc-to-user", "anyuid", user); !ocOut.Success {
+		s.failed(ocOut)
 		return false
 	}
-	util.PrettyPrintOk(out, progressMsg)
+	s.ok()
 
 	return true
 }
 
-func checkPreconditions(out io.Writer) bool {
+func checkPreconditions(ctx context.Context, env *Environment, rec *recorder) bool {
 	ok := true
-	if !precheckOC(out) {
+	if !precheckOC(ctx, env, rec) {
 		return false // don't bother doing anything if oc isn't configured
 	}
 
-	if !precheckAuthenticated(out) {
+	if !precheckAuthenticated(ctx, env, rec) {
 		return false
 	}
 
 	return ok
 }
 
-func precheckOC(out io.Writer) bool {
-	progressMsg := "Configured OC CLI exists"
-	if ko := RunOCinNamespace("version"); !ko.Success {
-		util.PrettyPrintErr(os.Stdout, progressMsg)
-		printFailureDetail(os.Stdout, ko.CombinedOut)
+func precheckOC(ctx context.Context, env *Environment, rec *recorder) bool {
+	s := rec.start(report.PhasePrecondition, "Configured OC CLI exists")
+	if ko := env.RunOCinNamespace(ctx, "version"); !ko.Success {
+		s.failed(ko)
 		return false
 	}
-	util.PrettyPrintOk(out, progressMsg)
+	s.ok()
 	return true
 }
 
-func precheckAuthenticated(out io.Writer) bool {
-	progressMsg := "User authenticated to cluster"
-	ocOut := RunOCinNamespace("whoami")
+func precheckAuthenticated(ctx context.Context, env *Environment, rec *recorder) bool {
+	s := rec.start(report.PhasePrecondition, "User authenticated to cluster")
+	ocOut := env.RunOCinNamespace(ctx, "whoami")
 	if !ocOut.Success {
-		util.PrettyPrintErr(os.Stdout, progressMsg)
-		printFailureDetail(os.Stdout, ocOut.CombinedOut)
+		s.failed(ocOut)
 		return false
 	}
-	util.PrettyPrintOk(out, progressMsg)
+	s.ok()
 	return true
 }
 
-func checkDeployments(busyboxCount, nginxCount int64) bool {
+func checkDeployments(ctx context.Context, env *Environment, busyboxCount int64) bool {
 	ret := true
-	ko := RunGetDeployment(bbDeploymentName)
+	ko := env.RunGetDeployment(ctx, bbDeploymentName)
 	if !ko.Success {
 		ret = false
 	} else if ko.ObservedReplicaCount() != busyboxCount {
 		ret = false
 	}
-	ko = RunGetDeployment(ngDeploymentName)
+	ko = env.RunGetDaemonSet(ctx, ngDeploymentName)
 	if !ko.Success {
 		ret = false
-	} else if ko.ObservedReplicaCount() != nginxCount {
+	} else if !ko.DaemonSetReady() {
 		ret = false
 	}
+	if meshMode() {
+		if ko = env.RunGetDaemonSet(ctx, meshDaemonSetName); !ko.Success || !ko.DaemonSetReady() {
+			ret = false
+		}
+	}
 	return ret
 }
 
-func waitForDeployments(busyboxCount, nginxCount int64) bool {
+func waitForDeployments(ctx context.Context, env *Environment, rec *recorder, busyboxCount int64) bool {
+	s := rec.start(report.PhaseSetup, "Both deployments completed successfully within timeout")
 	start := time.Now()
 	for time.Since(start) < deploymentTimeout {
-		if checkDeployments(busyboxCount, nginxCount) {
-			util.PrettyPrintOk(os.Stdout, "Both deployments completed successfully within timeout")
+		if checkDeployments(ctx, env, busyboxCount) {
+			s.ok()
 			return true
 		}
-		time.Sleep(1 * time.Second)
+		if !sleep(ctx, retryInterval) {
+			if ctx.Err() == context.Canceled {
+				s.failed(OCOutput{TimedOut: true, CombinedOut: "Run interrupted while waiting for deployments\n"})
+				return false
+			}
+			// The run is over but the pods can still tell why they were late
+			diagnoseCtx, cancel := cleanupContext()
+			defer cancel()
+			s.failed(OCOutput{TimedOut: true, CombinedOut: "Run timed out while waiting for deployments\n" + diagnosePods(diagnoseCtx, env)})
+			return false
+		}
 	}
-	util.PrettyPrintErr(os.Stdout, "Both deployments completed successfully within timeout")
+	s.errored(fmt.Sprintf("Deployments not available after %s\n", deploymentTimeout) + diagnosePods(ctx, env))
 	return false
 }
 
-func powerDown(nginxServiceName string) {
+// powerDown removes everything deployed for the checks, it returns false
+// if anything could not be removed
+func powerDown(ctx context.Context, env *Environment, rec *recorder, nginxServiceName string) bool {
 	// Power down service
-	powerDownResource("Nginx service ("+nginxServiceName+")", "delete", "service", nginxServiceName)
+	ok := powerDownResource(ctx, env, rec, "Nginx service ("+nginxServiceName+")", "delete", "service", nginxServiceName)
 
 	// Power down bb
-	powerDownResource("Busybox deployment ("+bbDeploymentName+")", "delete", "dc", bbDeploymentName)
+	ok = powerDownResource(ctx, env, rec, "Busybox deployment ("+bbDeploymentName+")", "delete", "dc", bbDeploymentName) && ok
 
 	// Power down nginx
-	powerDownResource("Nginx deployment ("+ ngDeploymentName + ")", "delete", "dc", ngDeploymentName)
+	ok = powerDownResource(ctx, env, rec, "Nginx daemon set ("+ngDeploymentName+")", "delete", "ds", ngDeploymentName) && ok
+
+	// Power down mesh clients
+	if meshMode() {
+		ok = powerDownResource(ctx, env, rec, "mesh client daemon set ("+meshDaemonSetName+")", "delete", "ds", meshDaemonSetName) && ok
+	}
 
 	//Remove Project
-	progressMsg := "Deleted "+config.Namespace + " project"
-	if ocOut := RunDeleteProject(config.Namespace); ocOut.Success {
-		util.PrettyPrintOk(os.Stdout, progressMsg)
+	s := rec.start(report.PhaseCleanup, "Deleted "+config.Namespace+" project")
+	if ocOut := env.RunDeleteProject(ctx, config.Namespace); ocOut.Success {
+		s.ok()
 	} else {
-		util.PrettyPrintErr(os.Stdout, progressMsg)
-		printFailureDetail(os.Stdout, ocOut.CombinedOut)
+		s.failed(ocOut)
+		ok = false
 	}
+	return ok
 }
 
-func powerDownResource (resourceName string, args ...string) {
-	progressMsg := "Powered down " + resourceName
-	if ocOut := RunOCinNamespace(args...); ocOut.Success {
-		util.PrettyPrintOk(os.Stdout, progressMsg)
-	} else {
-		util.PrettyPrintErr(os.Stdout, progressMsg)
-		printFailureDetail(os.Stdout, ocOut.CombinedOut)
+func powerDownResource(ctx context.Context, env *Environment, rec *recorder, resourceName string, args ...string) bool {
+	s := rec.start(report.PhaseCleanup, "Powered down "+resourceName)
+	if ocOut := env.RunOCinNamespace(ctx, args...); !ocOut.Success {
+		s.failed(ocOut)
+		return false
 	}
+	s.ok()
+	return true
 }
 
-func nginxServiceName() string {
-	return runPrefix+"nginx"
+// registryImage prefixes image with --registry-url, if set
+func registryImage(image string) string {
+	if config.RegistryURL != "" {
+		return config.RegistryURL + "/" + image
+	}
+	return image
+}
+
+// nginxImage is the image of the Nginx pods, an unprivileged build in
+// restricted mode as the restricted SCC does not let pods run as root
+func nginxImage() string {
+	if config.Restricted {
+		return registryImage("nginxinc/nginx-unprivileged:stable-alpine")
+	}
+	return registryImage("nginx:stable-alpine")
+}
 
+// nginxPort is the port the Nginx pods listen on, ports below 1024 need
+// root
+func nginxPort() int {
+	if config.Restricted {
+		return 8080
+	}
+	return 80
+}
 
+// nginxAddress is the address to access the Nginx pod with the given IP on
+func nginxAddress(ip string) string {
+	if port := nginxPort(); port != 80 {
+		return ip + ":" + strconv.Itoa(port)
+	}
+	return ip
+}
 
+func nginxServiceName() string {
+	return runPrefix + "nginx"
 
 }
 
@@ -355,10 +530,12 @@ func printFailureDetail(out io.Writer, detail string) {
 	fmt.Fprintln(out)
 }
 
-func printUserDetail(out io.Writer) {
-	ocOut := RunOCinNamespace("whoami")
+func printUserDetail(ctx context.Context, env *Environment, rec *recorder) {
+	ocOut := env.RunOCinNamespace(ctx, "whoami")
 	user := strings.Replace(ocOut.CombinedOut, "\n", "", -1)
-	ocOut = RunOCinNamespace("whoami", "--show-server")
+	ocOut = env.RunOCinNamespace(ctx, "whoami", "--show-server")
 	server := strings.Replace(ocOut.CombinedOut, "\n", "", -1)
-	util.PrettyPrintInfo(out, "Accessing "+ server + " as user "+user)
+	rec.report.User = user
+	rec.report.Server = server
+	rec.info("Accessing " + server + " as user " + user)
 }
@@ -1,22 +1,798 @@
 package smokeshift
 
 import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/opencredo/smokeshift/pkg/config"
+	"github.com/opencredo/smokeshift/pkg/report"
 )
 
 func TestTimeout(t *testing.T) {
-	client := http.Client{
-		Timeout: httpTimeout,
-	}
-	// Simulate a timeout using httpbin.org
-	if _, err := client.Get("http://httpbin.org/delay/2"); err == nil {
+	client := newProbeClient()
+	// Simulate a slow endpoint, httpTimeout is one second
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		delay, _ := time.ParseDuration(r.URL.Query().Get("delay"))
+		time.Sleep(delay)
+	}))
+	defer server.Close()
+	if err := httpGet(context.Background(), client, server.URL+"?delay=2s"); err == nil || !isTimeout(err) {
 		t.Log(err)
 		t.Errorf("Expected to timeout")
 	}
-	if _, err := client.Get("http://httpbin.org/delay/.1"); err != nil {
+	if err := httpGet(context.Background(), client, server.URL+"?delay=100ms"); err != nil {
 		t.Log(err)
 		t.Errorf("Expected not to timeout and recieve a response")
 	}
 
 }
+
+const fakeBusyboxPods = `{"items": [{"metadata": {"name": "smokeshift-busybox-1-abcde"}, "status": {"podIP": "127.0.0.2"}}]}`
+
+const fakeNginxPods = `{"items": [
+	{"metadata": {"name": "smokeshift-nginx-1-aaaaa"}, "spec": {"nodeName": "node2"}, "status": {"podIP": "127.0.0.11", "conditions": [{"type": "Ready", "status": "True"}]}},
+	{"metadata": {"name": "smokeshift-nginx-1-bbbbb"}, "spec": {"nodeName": "node3"}, "status": {"podIP": "127.0.0.12", "conditions": [{"type": "Ready", "status": "True"}]}},
+	{"metadata": {"name": "smokeshift-nginx-1-ccccc"}, "spec": {"nodeName": "node4"}, "status": {"podIP": "127.0.0.13", "conditions": [{"type": "Ready", "status": "True"}]}}
+]}`
+
+// fakeAdmittedRoute points at a closed port so fetching it fails fast
+const fakeAdmittedRoute = `{"status": {"ingress": [{"host": "127.0.0.1:1", "routerName": "router", "conditions": [{"type": "Admitted", "status": "True"}]}]}}`
+
+// fakeCluster scripts a healthy cluster with three schedulable nodes.
+// Responses added to the returned executor before calling it take precedence.
+func fakeCluster(overrides ...FakeResponse) *FakeExecutor {
+	f := NewFakeExecutor(overrides...)
+	f.On(`^--namespace=smokeshift version$`, 0, "oc v3.6.0\n")
+	f.On(`^--namespace=smokeshift whoami$`, 0, "system:admin\n")
+	f.On(`^--namespace=smokeshift whoami --show-server$`, 0, "https://master.example.com:8443\n")
+	f.On(`^(--namespace=[a-z]+ )?auth can-i `, 0, "yes\n")
+	f.On(`^--namespace=smokeshift get project smokeshift`, 1, "Error from server (NotFound): namespaces \"smokeshift\" not found\n")
+	f.On(`^new-project smokeshift`, 0, "Now using project \"smokeshift\"\n")
+	f.On(`^adm policy add-scc-to-user anyuid`, 0, "")
+	f.On(`^--namespace=smokeshift get nodes -o json$`, 0, fakeNodes)
+	f.On(`^--namespace=smokeshift run smokeshift-busybox `, 0, "deploymentconfig \"smokeshift-busybox\" created\n")
+	f.On(`^--namespace=smokeshift create -f `, 0, "created\n")
+	f.On(`^--namespace=smokeshift get dc smokeshift-busybox -o json$`, 0, `{"status": {"availableReplicas": 1}}`)
+	f.On(`^--namespace=smokeshift get ds smokeshift-nginx -o json$`, 0, `{"status": {"desiredNumberScheduled": 3, "numberReady": 3}}`)
+	f.On(`^--namespace=smokeshift get pods -l run=smokeshift-nginx -o json$`, 0, fakeNginxPods)
+	f.On(`^--namespace=smokeshift get pods -l run=smokeshift-busybox -o json$`, 0, fakeBusyboxPods)
+	f.On(`^--namespace=smokeshift get service smokeshift-nginx -o json$`, 0, `{"spec": {"clusterIP": "172.30.0.10"}}`)
+	f.On(`^--namespace=smokeshift exec smokeshift-busybox-1-abcde -- wget -S -O /dev/null http://google\.com/$`, 1, "wget: bad address 'google.com'\n")
+	// Blocked by the deny-all policy at the first attempt, allowed afterwards
+	f.Add(FakeResponse{Pattern: `^--namespace=smokeshift exec smokeshift-busybox-1-abcde -- wget -qO- -T 2 `, ExitCode: 1, Output: "wget: download timed out\n", Times: 3})
+	f.On(`^--namespace=smokeshift exec smokeshift-busybox-1-abcde -- wget -qO- 127\.0\.0\.30$`, 0, "Built by smokeshift\n")
+	f.On(`^--namespace=smokeshift exec smokeshift-busybox-1-abcde -- wget -qO- `, 0, "<h1>Welcome to nginx!</h1>\n")
+	f.On(`^--namespace=smokeshift start-build smokeshift-build -o name$`, 0, "build/smokeshift-build-1\n")
+	f.On(`^--namespace=smokeshift get build smokeshift-build-1 -o json$`, 0, fakeBuild)
+	f.On(`^--namespace=smokeshift get is smokeshift-build -o json$`, 0, fakeImageStream)
+	f.On(`^--namespace=smokeshift get dc smokeshift-build -o json$`, 0, `{"status": {"availableReplicas": 1}}`)
+	f.On(`^--namespace=smokeshift get pods -l run=smokeshift-build -o json$`, 0, `{"items": [{"metadata": {"name": "smokeshift-build-1-xyz"}, "spec": {"nodeName": "node3"}, "status": {"podIP": "127.0.0.30", "conditions": [{"type": "Ready", "status": "True"}]}}]}`)
+	f.On(`^--namespace=smokeshift exec smokeshift-busybox-1-abcde -- cat /etc/resolv\.conf$`, 0, fakeResolvConf)
+	f.On(`^--namespace=smokeshift exec smokeshift-busybox-1-abcde -- nslookup smokeshift-nginx(\.smokeshift(\.svc\.cluster\.local)?)?$`, 0, fakeNslookup("smokeshift-nginx", "172.30.0.10 smokeshift-nginx.smokeshift.svc.cluster.local"))
+	f.On(`^--namespace=smokeshift exec smokeshift-busybox-1-abcde -- nslookup kubernetes\.default\.svc\.cluster\.local$`, 0, fakeNslookup("kubernetes.default.svc.cluster.local", "172.30.0.1 kubernetes.default.svc.cluster.local"))
+	f.On(`^--namespace=smokeshift exec smokeshift-busybox-1-abcde -- nslookup smokeshift-nginx-headless\.smokeshift\.svc\.cluster\.local$`, 0, fakeNslookup("smokeshift-nginx-headless.smokeshift.svc.cluster.local", "127.0.0.11", "127.0.0.12", "127.0.0.13"))
+	f.On(`^--namespace=smokeshift exec smokeshift-busybox-1-abcde -- nslookup smokeshift-external\.smokeshift\.svc\.cluster\.local$`, 0, fakeNslookup("smokeshift-external.smokeshift.svc.cluster.local", "172.30.0.1 kubernetes.default.svc.cluster.local"))
+	f.On(`^--namespace=smokeshift exec smokeshift-busybox-1-abcde -- nslookup 172\.30\.0\.10$`, 0, fakeNslookup("172.30.0.10", "172.30.0.10 smokeshift-nginx.smokeshift.svc.cluster.local"))
+	f.On(`^--namespace=smokeshift exec smokeshift-busybox-1-abcde -- nslookup google\.com$`, 1, "nslookup: can't resolve 'google.com'\n")
+	f.On(`^get storageclass -o json$`, 0, fakeStorageClasses)
+	f.On(`^--namespace=smokeshift get pvc smokeshift-data[a-z-]* -o json$`, 0, `{"spec": {"volumeName": "pvc-0001"}, "status": {"phase": "Bound"}}`)
+	f.On(`^--namespace=smokeshift get pods -l run=smokeshift-data[a-z-]*-writer -o json$`, 0, fakeClaimPod("smokeshift-data-writer", "node2"))
+	f.On(`^--namespace=smokeshift get pods -l run=smokeshift-data[a-z-]*-reader -o json$`, 0, fakeClaimPod("smokeshift-data-reader", "node3"))
+	f.On(`^--namespace=smokeshift exec smokeshift-data-(writer|reader) -- `, 0, "")
+	f.On(`^--namespace=smokeshift get dc smokeshift-nginx-tls -o json$`, 0, `{"status": {"availableReplicas": 1}}`)
+	f.On(`^--namespace=smokeshift get route smokeshift-nginx[a-z-]* -o json$`, 0, fakeAdmittedRoute)
+	f.On(`^get clusternetwork default -o json$`, 0, `{"pluginName": "redhat/openshift-ovs-multitenant"}`)
+	f.On(`^--namespace=smokeshift-isolated create -f `, 0, "created\n")
+	f.On(`^--namespace=smokeshift-isolated get pods -l run=smokeshift-isolated-client -o json$`, 0, fakeClaimPod("smokeshift-isolated-client", "node4"))
+	f.On(`^--namespace=smokeshift-isolated exec smokeshift-isolated-client -- wget `, 1, "wget: download timed out\n")
+	f.On(`^delete project smokeshift-isolated$`, 0, "project \"smokeshift-isolated\" deleted\n")
+	f.On(`^--namespace=default get endpoints kubernetes -o json$`, 0, fakeAPIEndpoints)
+	f.On(`^get --raw=/(healthz|readyz) --server=`, 0, "ok")
+	f.On(`^get --raw=/version --server=`, 0, `{"gitVersion": "v1.11.0+d4cacc0"}`)
+	f.On(`^get clusteroperators -o json$`, 1, "error: the server doesn't have a resource type \"clusteroperators\"\n")
+	f.On(`^get componentstatuses -o json$`, 0, fakeComponentStatuses)
+	f.On(`^--namespace=smokeshift get pods -o json$`, 0, fakeNginxPods)
+	f.On(`^--namespace=smokeshift delete `, 0, "deleted\n")
+	f.On(`^delete project smokeshift$`, 0, "project \"smokeshift\" deleted\n")
+	return f
+}
+
+// fakeNodes has a cordoned master and three ready compute nodes
+const fakeNodes = `{"items": [
+	{"metadata": {"name": "node1", "labels": {"node-role.kubernetes.io/master": "true"}}, "spec": {"unschedulable": true}, "status": {"conditions": [{"type": "Ready", "status": "True"}], "nodeInfo": {"kubeletVersion": "v1.11.0+d4cacc0"}}},
+	{"metadata": {"name": "node2", "labels": {"node-role.kubernetes.io/compute": "true"}}, "status": {"conditions": [{"type": "Ready", "status": "True"}], "nodeInfo": {"kubeletVersion": "v1.11.0+d4cacc0"}}},
+	{"metadata": {"name": "node3", "labels": {"node-role.kubernetes.io/compute": "true"}}, "status": {"conditions": [{"type": "Ready", "status": "True"}], "nodeInfo": {"kubeletVersion": "v1.11.0+d4cacc0"}}},
+	{"metadata": {"name": "node4", "labels": {"node-role.kubernetes.io/compute": "true"}}, "status": {"conditions": [{"type": "Ready", "status": "True"}], "nodeInfo": {"kubeletVersion": "v1.11.0+d4cacc0"}}}
+]}`
+
+const fakeAPIEndpoints = `{"subsets": [{"addresses": [{"ip": "10.0.0.1"}, {"ip": "10.0.0.2"}], "ports": [{"name": "https", "port": 8443}, {"name": "dns", "port": 8053}]}]}`
+
+const fakeComponentStatuses = `{"items": [
+	{"metadata": {"name": "controller-manager"}, "conditions": [{"type": "Healthy", "status": "True", "message": "ok"}]},
+	{"metadata": {"name": "etcd-0"}, "conditions": [{"type": "Healthy", "status": "True", "message": "{\"health\": \"true\"}"}]}
+]}`
+
+const fakeResolvConf = `nameserver 172.30.0.1
+search smokeshift.svc.cluster.local svc.cluster.local cluster.local
+options ndots:5
+`
+
+// fakeNslookup prints the answer of busybox nslookup for name, every address
+// optionally followed by the name it resolves back to
+func fakeNslookup(name string, addresses ...string) string {
+	out := "Server:    172.30.0.1\nAddress 1: 172.30.0.1 kubernetes.default.svc.cluster.local\n\nName:      " + name + "\n"
+	for i, address := range addresses {
+		out += fmt.Sprintf("Address %d: %s\n", i+1, address)
+	}
+	return out
+}
+
+const fakeStorageClasses = `{"items": [
+	{"metadata": {"name": "standard", "annotations": {"storageclass.kubernetes.io/is-default-class": "true"}}, "provisioner": "kubernetes.io/cinder"},
+	{"metadata": {"name": "fast"}, "provisioner": "kubernetes.io/cinder"}
+]}`
+
+func fakeClaimPod(name, node string) string {
+	return `{"items": [{"metadata": {"name": "` + name + `"}, "spec": {"nodeName": "` + node + `"}, "status": {"podIP": "127.0.0.20", "conditions": [{"type": "Ready", "status": "True"}]}}]}`
+}
+
+const fakeBuild = `{"status": {"phase": "Complete", "duration": 42000000000,
+	"output": {"to": {"imageDigest": "sha256:0123"}},
+	"stages": [{"name": "Build", "durationMilliseconds": 30000}, {"name": "PushImage", "durationMilliseconds": 8000}]}}`
+
+const fakeImageStream = `{"status": {"dockerImageRepository": "docker-registry.default.svc:5000/smokeshift/smokeshift-build",
+	"tags": [{"tag": "latest", "items": [{"image": "sha256:0123"}]}]}}`
+
+func runAgainst(f *FakeExecutor, skipCleanup bool) error {
+	_, err := runAgainstContext(context.Background(), f, skipCleanup)
+	return err
+}
+
+func runAgainstContext(ctx context.Context, f *FakeExecutor, skipCleanup bool) (*report.Report, error) {
+	previousInterval := retryInterval
+	previousNamespace := config.Namespace
+	retryInterval = 0
+	config.Namespace = "smokeshift"
+	defer func() {
+		retryInterval = previousInterval
+		config.Namespace = previousNamespace
+	}()
+	defer fakeLookup(nil)()
+	return CheckOpenshift(ctx, f, ioutil.Discard, skipCleanup)
+}
+
+func TestCheckOpenshiftHealthyCluster(t *testing.T) {
+	f := fakeCluster()
+	if err := runAgainst(f, false); err != nil {
+		t.Fatalf("Expected healthy cluster to pass, got %v", err)
+	}
+	if n := f.Called(`exec smokeshift-busybox-1-abcde -- wget -qO- 127\.0\.0\.1[123]$`); n != 3 {
+		t.Errorf("Expected every nginx pod to be accessed once, got %d", n)
+	}
+	if n := f.Called(`^delete project smokeshift$`); n != 1 {
+		t.Errorf("Expected the project to be cleaned up, got %d delete calls", n)
+	}
+}
+
+func TestCheckOpenshiftSkipCleanup(t *testing.T) {
+	f := fakeCluster()
+	if err := runAgainst(f, true); err != nil {
+		t.Fatalf("Expected healthy cluster to pass, got %v", err)
+	}
+	// Network policies would break the checks after them, they always go
+	if n := f.Called(`delete`) - f.Called(`delete networkpolicy `); n != 0 {
+		t.Errorf("Expected no cleanup with skipCleanup, got %d delete calls", n)
+	}
+}
+
+func TestCheckOpenshiftSkipEgress(t *testing.T) {
+	config.Skip = []string{"egress"}
+	defer func() { config.Skip = nil }()
+	f := fakeCluster()
+	if err := runAgainst(f, false); err != nil {
+		t.Fatalf("Expected healthy cluster to pass, got %v", err)
+	}
+	if n := f.Called(`google\.com`); n != 0 {
+		t.Errorf("Expected egress checks to be skipped, got %d calls", n)
+	}
+}
+
+func TestCheckOpenshiftUnknownCheck(t *testing.T) {
+	config.Only = []string{"no-such-check"}
+	defer func() { config.Only = nil }()
+	f := fakeCluster()
+	if err := runAgainst(f, false); err == nil || !strings.Contains(err.Error(), "no-such-check") {
+		t.Errorf("Expected unknown check to be reported, got %v", err)
+	}
+	if len(f.Calls()) != 0 {
+		t.Errorf("Expected nothing to run, got %v", f.Calls())
+	}
+}
+
+func TestCheckOpenshiftPreconditionsFail(t *testing.T) {
+	f := fakeCluster(FakeResponse{Pattern: `whoami$`, ExitCode: 1, Output: "error: You must be logged in to the server (Unauthorized)\n"})
+	if err := runAgainst(f, false); err == nil {
+		t.Fatal("Expected unauthenticated user to fail")
+	}
+	if n := f.Called(`new-project`); n != 0 {
+		t.Errorf("Expected nothing to be created, got %d new-project calls", n)
+	}
+}
+
+func TestCheckOpenshiftExitCodes(t *testing.T) {
+	tests := []struct {
+		name     string
+		f        *FakeExecutor
+		strict   bool
+		expected int
+	}{
+		{"advisory failure", fakeCluster(), false, report.ExitOK},
+		{"strict advisory failure", fakeCluster(), true, report.ExitAdvisoryFailure},
+		{"build strategy disabled", fakeCluster(FakeResponse{Pattern: `start-build`, ExitCode: 1, Output: "Error from server (Forbidden): build strategy Docker is not allowed\n"}), false, report.ExitOK},
+		{"required failure", fakeCluster(FakeResponse{Pattern: `wget -qO- 172\.30\.0\.10$`, ExitCode: 1, Output: "wget: timed out\n"}), false, report.ExitRequiredFailure},
+		{"precondition failure", fakeCluster(FakeResponse{Pattern: `version$`, ExitCode: 127, Output: "oc: not found\n"}), false, report.ExitPreconditionFailure},
+		{"cleanup failure", fakeCluster(FakeResponse{Pattern: `^delete project smokeshift$`, ExitCode: 1, Output: "Error from server (Forbidden)\n"}), false, report.ExitCleanupFailure},
+	}
+	for _, test := range tests {
+		config.Strict = test.strict
+		rep, err := runAgainstContext(context.Background(), test.f, false)
+		config.Strict = false
+		if code := rep.ExitCode(test.strict); code != test.expected {
+			t.Errorf("%s: expected exit code %d, got %d (%v)", test.name, test.expected, code, err)
+		}
+		if (err == nil) != (test.expected == report.ExitOK) {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+		}
+	}
+}
+
+func TestCheckOpenshiftDeployFailure(t *testing.T) {
+	f := fakeCluster(FakeResponse{Pattern: `create -f `, ExitCode: 1, Output: "error: image not found\n"})
+	err := runAgainst(f, false)
+	if err == nil || err.Error() != "Failed to deploy test workloads" {
+		t.Fatalf("Expected deploy failure, got %v", err)
+	}
+	if n := f.Called(`exec `); n != 0 {
+		t.Errorf("Expected no checks to run after a failed deploy, got %d exec calls", n)
+	}
+	if n := f.Called(`^delete project smokeshift$`); n != 1 {
+		t.Errorf("Expected the project to be cleaned up after a failed deploy, got %d delete calls", n)
+	}
+}
+
+func TestCheckOpenshiftNodeCoverage(t *testing.T) {
+	// node2 is unreachable and node4 did not get a pod
+	pods := `{"items": [
+	{"metadata": {"name": "smokeshift-nginx-1-aaaaa"}, "spec": {"nodeName": "node2"}, "status": {"podIP": "127.0.0.11", "conditions": [{"type": "Ready", "status": "True"}]}},
+	{"metadata": {"name": "smokeshift-nginx-1-bbbbb"}, "spec": {"nodeName": "node3"}, "status": {"podIP": "127.0.0.12", "conditions": [{"type": "Ready", "status": "True"}]}}
+]}`
+	f := fakeCluster(
+		FakeResponse{Pattern: `get pods -l run=smokeshift-nginx`, Output: pods},
+		FakeResponse{Pattern: `wget -qO- 127\.0\.0\.11$`, ExitCode: 1, Output: "wget: can't connect to remote host (127.0.0.11): No route to host\n"},
+	)
+	rep, _ := runAgainstContext(context.Background(), f, false)
+	if len(rep.Coverage) != 3 {
+		t.Fatalf("Expected coverage of the 3 schedulable nodes, got %+v", rep.Coverage)
+	}
+	expected := map[string]bool{"node2": false, "node3": true, "node4": false}
+	for _, c := range rep.Coverage {
+		if c.Covered != expected[c.Node] {
+			t.Errorf("Expected %s covered=%v, got %+v", c.Node, expected[c.Node], c)
+		}
+	}
+	if c := rep.Coverage[0]; !c.Scheduled || c.Reachable == nil || *c.Reachable {
+		t.Errorf("Expected node2 to be scheduled and unreachable, got %+v", c)
+	}
+	if c := rep.Coverage[2]; c.Scheduled || c.Pod != "" {
+		t.Errorf("Expected node4 not to be scheduled, got %+v", c)
+	}
+	for _, check := range rep.Checks {
+		if check.Check == "node-coverage" && (check.Status != report.ErrorIgnored || !strings.Contains(check.Detail, "node2, node4")) {
+			t.Errorf("Expected uncovered nodes to be flagged, got %+v", check)
+		}
+	}
+}
+
+func TestCheckOpenshiftNodeInventory(t *testing.T) {
+	rep, err := runAgainstContext(context.Background(), fakeCluster(), false)
+	if err != nil {
+		t.Fatalf("Expected healthy cluster to pass, got %v", err)
+	}
+	if len(rep.Nodes) != 4 {
+		t.Fatalf("Expected every node in the inventory, got %+v", rep.Nodes)
+	}
+	if n := rep.Nodes[0]; n.Name != "node1" || n.Schedulable || !n.Ready || !reflect.DeepEqual(n.Roles, []string{"master"}) || n.KubeletVersion != "v1.11.0+d4cacc0" {
+		t.Errorf("Expected node1 to be a ready, cordoned master, got %+v", n)
+	}
+}
+
+func TestCheckOpenshiftRestricted(t *testing.T) {
+	config.Restricted = true
+	defer func() { config.Restricted = false }()
+	forbidden := "Error from server (Forbidden): forbidden\n"
+	f := fakeCluster(
+		FakeResponse{Pattern: `^adm policy `, ExitCode: 1, Output: forbidden},
+		FakeResponse{Pattern: `get nodes `, ExitCode: 1, Output: forbidden},
+		FakeResponse{Pattern: `^get storageclass `, ExitCode: 1, Output: forbidden},
+		FakeResponse{Pattern: `^get clusternetwork `, ExitCode: 1, Output: forbidden},
+		FakeResponse{Pattern: `wget -qO- 127\.0\.0\.30:8080$`, Output: "Built by smokeshift\n"},
+	)
+	rep, err := runAgainstContext(context.Background(), f, false)
+	if err != nil {
+		t.Fatalf("Expected restricted run to pass, got %v", err)
+	}
+	if n := f.Called(`^adm |get nodes |^get storageclass |^get clusternetwork `); n != 0 {
+		t.Errorf("Expected no cluster-scoped calls, got %d", n)
+	}
+	if n := f.Called(`exec smokeshift-busybox-1-abcde -- wget -qO- 127\.0\.0\.1[123]:8080$`); n != 3 {
+		t.Errorf("Expected every nginx pod to be accessed on port 8080, got %d", n)
+	}
+	if skipped := strings.Join(rep.SkippedForPermissions, ","); skipped != "project-isolation,control-plane,node-health,node-coverage" {
+		t.Errorf("Expected project-isolation, control-plane, node-health and node-coverage to be skipped for permissions, got %q", skipped)
+	}
+	for _, check := range rep.Checks {
+		if check.Check == "project-isolation" && (check.Status != report.Skipped || !strings.Contains(check.Detail, "--sdn-mode")) {
+			t.Errorf("Expected the isolation check to be skipped for reading the cluster network, got %+v", check)
+		}
+	}
+}
+
+func TestCheckOpenshiftMissingPermissions(t *testing.T) {
+	f := fakeCluster(FakeResponse{Pattern: `^auth can-i update securitycontextconstraints$`, ExitCode: 1, Output: "no\n"})
+	rep, err := runAgainstContext(context.Background(), f, false)
+	if err == nil || rep.ExitCode(false) != report.ExitPreconditionFailure {
+		t.Fatalf("Expected a precondition failure, got %v", err)
+	}
+	if n := f.Called(`new-project|create -f|run smokeshift-busybox`); n != 0 {
+		t.Errorf("Expected nothing to be created, got %d calls", n)
+	}
+	// The project does not exist yet, its permissions come with creating it
+	if n := f.Called(`^--namespace=smokeshift auth can-i `); n != 0 {
+		t.Errorf("Expected no project permission to be reviewed, got %d", n)
+	}
+	if n := f.Called(`^--namespace=default auth can-i get endpoints$`); n != 1 {
+		t.Errorf("Expected the kubernetes endpoints permission to be reviewed in the default namespace, got %d", n)
+	}
+	missing := rep.MissingPermissions
+	if len(missing) != 1 || missing[0].Resource != "securitycontextconstraints" || missing[0].Scope != "cluster" || strings.Join(missing[0].NeededBy, ",") != "setup" {
+		t.Errorf("Expected the SCC update to be missing for the setup, got %+v", missing)
+	}
+}
+
+func TestCheckOpenshiftMissingAdvisoryPermissions(t *testing.T) {
+	f := fakeCluster(
+		FakeResponse{Pattern: `^--namespace=smokeshift get project smokeshift`, Output: `{"metadata": {"name": "smokeshift"}}`, Times: 1},
+		FakeResponse{Pattern: `^--namespace=smokeshift auth can-i create networkpolicies\.networking\.k8s\.io$`, ExitCode: 1, Output: "no\n"},
+	)
+	rep, err := runAgainstContext(context.Background(), f, false)
+	if err != nil {
+		t.Fatalf("Expected permissions only advisory checks need not to fail the run, got %v", err)
+	}
+	missing := rep.MissingPermissions
+	if len(missing) != 1 || missing[0].Scope != "smokeshift" || strings.Join(missing[0].NeededBy, ",") != "network-policy" {
+		t.Errorf("Expected network policies to be missing for the network-policy check, got %+v", missing)
+	}
+	if n := f.Called(`^--namespace=smokeshift auth can-i create daemonsets\.apps$`); n != 1 {
+		t.Errorf("Expected DaemonSets to be reviewed in the apps group, got %d", n)
+	}
+}
+
+func TestCheckOpenshiftPermissionReviewUnsupported(t *testing.T) {
+	f := fakeCluster(FakeResponse{Pattern: `auth can-i `, ExitCode: 1, Output: "Error: unknown command \"auth\" for \"oc\"\n"})
+	if err := runAgainst(f, false); err != nil {
+		t.Fatalf("Expected the run to go on without access reviews, got %v", err)
+	}
+	if n := f.Called(`auth can-i `); n != 1 {
+		t.Errorf("Expected a single review attempt, got %d", n)
+	}
+}
+
+func TestCheckOpenshiftMesh(t *testing.T) {
+	config.Mesh = true
+	defer func() { config.Mesh = false }()
+	clients := `{"items": [
+	{"metadata": {"name": "smokeshift-mesh-aaaaa"}, "spec": {"nodeName": "node2"}},
+	{"metadata": {"name": "smokeshift-mesh-bbbbb"}, "spec": {"nodeName": "node3"}},
+	{"metadata": {"name": "smokeshift-mesh-ccccc"}, "spec": {"nodeName": "node4"}}
+]}`
+	f := fakeCluster(
+		FakeResponse{Pattern: `get ds smokeshift-mesh -o json$`, Output: `{"status": {"desiredNumberScheduled": 3, "numberReady": 3}}`},
+		FakeResponse{Pattern: `get pods -l run=smokeshift-mesh -o json$`, Output: clients},
+		FakeResponse{Pattern: `exec smokeshift-mesh-ccccc -- wget -qO- 127\.0\.0\.12$`, ExitCode: 1, Output: "wget: download timed out\n"},
+		FakeResponse{Pattern: `exec smokeshift-mesh-.* -- wget -qO- `, Output: "<h1>Welcome to nginx!</h1>\n"},
+	)
+	rep, err := runAgainstContext(context.Background(), f, false)
+	if err == nil {
+		t.Fatal("Expected a broken node pair to fail the run")
+	}
+	if n := f.Called(`exec smokeshift-mesh-`); n != 9+2 {
+		t.Errorf("Expected every nginx pod to be accessed from every client, got %d calls", n)
+	}
+	if len(rep.Mesh) != 3 || rep.Mesh["node4"]["node3"] || !rep.Mesh["node3"]["node4"] {
+		t.Errorf("Expected only node4 -> node3 to fail, got %v", rep.Mesh)
+	}
+	if n := f.Called(`delete ds smokeshift-mesh$`); n != 1 {
+		t.Errorf("Expected the mesh clients to be cleaned up, got %d delete calls", n)
+	}
+}
+
+func TestCheckOpenshiftOnlyMesh(t *testing.T) {
+	config.Only = []string{"mesh"}
+	defer func() { config.Only = nil }()
+	f := fakeCluster(
+		FakeResponse{Pattern: `get ds smokeshift-mesh -o json$`, Output: `{"status": {"desiredNumberScheduled": 1, "numberReady": 1}}`},
+		FakeResponse{Pattern: `get pods -l run=smokeshift-mesh -o json$`, Output: `{"items": [{"metadata": {"name": "smokeshift-mesh-aaaaa"}, "spec": {"nodeName": "node2"}}]}`},
+		FakeResponse{Pattern: `exec smokeshift-mesh-aaaaa -- wget -qO- `, Output: "<h1>Welcome to nginx!</h1>\n"},
+	)
+	rep, err := runAgainstContext(context.Background(), f, false)
+	if err != nil {
+		t.Fatalf("Expected --only=mesh to run the mesh check, got %v", err)
+	}
+	if n := f.Called(`exec smokeshift-mesh-aaaaa -- wget -qO- `); n != 3 {
+		t.Errorf("Expected every nginx pod to be accessed from the client, got %d calls", n)
+	}
+	if len(rep.Mesh) != 1 {
+		t.Errorf("Expected a mesh matrix, got %v", rep.Mesh)
+	}
+}
+
+func TestCheckOpenshiftMissingPods(t *testing.T) {
+	f := fakeCluster(FakeResponse{Pattern: `get pods -l run=smokeshift-busybox`, Output: `{"items": []}`})
+	err := runAgainst(f, false)
+	if err == nil || err.Error() != "One or more required steps failed" {
+		t.Fatalf("Expected missing busybox pod to fail the checks, got %v", err)
+	}
+}
+
+func TestCheckOpenshiftPartialNetworkFailure(t *testing.T) {
+	f := fakeCluster(FakeResponse{Pattern: `exec smokeshift-busybox-1-abcde -- wget -qO- 127\.0\.0\.12$`, ExitCode: 1, Output: "wget: can't connect to remote host (127.0.0.12): No route to host\n"})
+	err := runAgainst(f, false)
+	if err == nil || err.Error() != "One or more required steps failed" {
+		t.Fatalf("Expected unreachable pod to fail the checks, got %v", err)
+	}
+	if n := f.Called(`wget -qO- 127\.0\.0\.12$`); n != 3 {
+		t.Errorf("Expected the unreachable pod to be retried 3 times, got %d", n)
+	}
+	if n := f.Called(`wget -qO- 127\.0\.0\.1[13]$`); n != 2 {
+		t.Errorf("Expected the reachable pods to be accessed once each, got %d", n)
+	}
+}
+
+func TestCheckOpenshiftReport(t *testing.T) {
+	f := fakeCluster(FakeResponse{Pattern: `exec smokeshift-busybox-1-abcde -- wget -qO- 127\.0\.0\.12$`, ExitCode: 1, Output: "wget: can't connect to remote host (127.0.0.12): No route to host\n"})
+	rep, err := runAgainstContext(context.Background(), f, false)
+	if err == nil || rep.Success || rep.Error != err.Error() {
+		t.Fatalf("Expected failed report, got %+v (%v)", rep, err)
+	}
+	if rep.Server != "https://master.example.com:8443" || rep.User != "system:admin" {
+		t.Errorf("Expected cluster details in the report, got %q as %q", rep.Server, rep.User)
+	}
+	statuses := map[string]report.Status{}
+	for _, check := range rep.Checks {
+		statuses[check.Name] = check.Status
+		if check.Name == "Accessed Nginx pod at 127.0.0.12 from BusyBox" {
+			if check.Target == nil || check.Target.Pod != "smokeshift-nginx-1-bbbbb" || check.Target.IP != "127.0.0.12" {
+				t.Errorf("Expected pod target, got %+v", check.Target)
+			}
+			if check.Detail == "" {
+				t.Error("Expected failure detail for the unreachable pod")
+			}
+		}
+	}
+	expected := map[string]report.Status{
+		"Configured OC CLI exists":                          report.OK,
+		"Accessed Nginx pod at 127.0.0.11 from BusyBox":     report.OK,
+		"Accessed Nginx pod at 127.0.0.12 from BusyBox":     report.Error,
+		"Accessed http://google.com/ from BusyBox":          report.ErrorIgnored,
+		"Resolved short name smokeshift-nginx from BusyBox": report.OK,
+		"Resolved external name google.com from BusyBox":    report.ErrorIgnored,
+		"Accessed Nginx pod at 127.0.0.11 from this node":   report.ErrorIgnored,
+		"Deleted smokeshift project":                        report.OK,
+	}
+	for name, status := range expected {
+		if statuses[name] != status {
+			t.Errorf("Expected %q to be %s, got %q", name, status, statuses[name])
+		}
+	}
+}
+
+func TestCheckOpenshiftCallTimeout(t *testing.T) {
+	f := fakeCluster(FakeResponse{Pattern: `wget -qO- 172\.30\.0\.10$`, Delay: time.Minute})
+	previousTimeout := config.CallTimeout
+	config.CallTimeout = 20 * time.Millisecond
+	defer func() { config.CallTimeout = previousTimeout }()
+
+	err := runAgainst(f, true)
+	if err == nil || err.Error() != "One or more required steps failed" {
+		t.Fatalf("Expected hung exec to fail the checks, got %v", err)
+	}
+	if n := f.Called(`wget -qO- 127\.0\.0\.1[123]$`); n != 3 {
+		t.Errorf("Expected the checks after the hung exec to run, got %d pod accesses", n)
+	}
+}
+
+func TestRunOCTimedOut(t *testing.T) {
+	env := &Environment{Executor: NewFakeExecutor(FakeResponse{Pattern: `exec`, Delay: time.Minute})}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if ko := env.RunOC(ctx, "exec", "busybox", "--", "wget", "-qO-", "10.1.0.5"); ko.Success || !ko.TimedOut {
+		t.Errorf("Expected call to time out, got %+v", ko)
+	}
+}
+
+func TestCheckOpenshiftOverallTimeout(t *testing.T) {
+	f := fakeCluster(FakeResponse{Pattern: `get ds smokeshift-nginx`, Output: `{"status": {"desiredNumberScheduled": 3, "numberReady": 1}}`})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := runAgainstContext(ctx, f, false); err == nil {
+		t.Fatal("Expected deployments that never become ready to fail once the run times out")
+	}
+	if n := f.Called(`^delete project smokeshift$`); n != 1 {
+		t.Errorf("Expected cleanup to run after the timeout, got %d delete calls", n)
+	}
+}
+
+func TestFakeExecutorTimes(t *testing.T) {
+	f := NewFakeExecutor(FakeResponse{Pattern: `get dc`, Output: "first", Times: 1}).On(`get dc`, 2, "second")
+	if ko := f.Execute(context.Background(), "get", "dc"); !ko.Success || ko.CombinedOut != "first" {
+		t.Errorf("Expected first response, got %+v", ko)
+	}
+	if ko := f.Execute(context.Background(), "get", "dc"); ko.Success || ko.ExitCode != 2 || ko.CombinedOut != "second" {
+		t.Errorf("Expected second response, got %+v", ko)
+	}
+	if ko := f.Execute(context.Background(), "get", "pods"); ko.Success || ko.ExitCode != 1 {
+		t.Errorf("Expected unscripted command to fail, got %+v", ko)
+	}
+}
+
+const fakeStuckPods = `{"items": [
+	{"metadata": {"name": "smokeshift-nginx-abcde"}, "spec": {"nodeName": "node1"}, "status": {"phase": "Pending", "conditions": [{"type": "Ready", "status": "False"}], "containerStatuses": [{"name": "smokeshift-nginx", "state": {"waiting": {"reason": "ImagePullBackOff", "message": "Back-off pulling image \"nginx:stable-alpine\""}}}]}},
+	{"metadata": {"name": "smokeshift-nginx-fghij"}, "spec": {"nodeName": "node2"}, "status": {"phase": "Running", "conditions": [{"type": "Ready", "status": "False"}], "containerStatuses": [{"name": "smokeshift-nginx", "restartCount": 4, "state": {"waiting": {"reason": "CrashLoopBackOff"}}, "lastState": {"terminated": {"reason": "Error", "exitCode": 1}}}]}},
+	{"metadata": {"name": "smokeshift-nginx-klmno"}, "status": {"phase": "Pending", "conditions": [{"type": "PodScheduled", "status": "False", "reason": "Unschedulable", "message": "0/3 nodes are available: 3 Insufficient memory."}]}}
+]}`
+
+const fakeStuckEvents = `{"items": [
+	{"type": "Normal", "reason": "Scheduled", "message": "Successfully assigned", "lastTimestamp": "2020-01-01T10:00:00Z", "involvedObject": {"kind": "Pod", "name": "smokeshift-nginx-abcde"}},
+	{"type": "Warning", "reason": "Failed", "message": "Failed to pull image", "count": 3, "lastTimestamp": "2020-01-01T10:02:00Z", "involvedObject": {"kind": "Pod", "name": "smokeshift-nginx-abcde"}},
+	{"type": "Warning", "reason": "FailedScheduling", "message": "0/3 nodes are available", "lastTimestamp": "2020-01-01T10:01:00Z", "involvedObject": {"kind": "Pod", "name": "smokeshift-nginx-klmno"}}
+]}`
+
+func TestCheckOpenshiftDiagnosesStuckDeployments(t *testing.T) {
+	f := fakeCluster(
+		FakeResponse{Pattern: `get ds smokeshift-nginx`, Output: `{"status": {"desiredNumberScheduled": 3, "numberReady": 0}}`},
+		FakeResponse{Pattern: `^--namespace=smokeshift get pods -o json$`, Output: fakeStuckPods},
+		FakeResponse{Pattern: `^--namespace=smokeshift get events -o json$`, Output: fakeStuckEvents},
+		FakeResponse{Pattern: `^--namespace=smokeshift logs smokeshift-nginx-fghij --container=smokeshift-nginx --tail=10 --previous$`, Output: "nginx: [emerg] bind() failed\n"},
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	rep, err := runAgainstContext(ctx, f, false)
+	if err == nil {
+		t.Fatal("Expected deployments that never become ready to fail")
+	}
+	var detail string
+	for _, check := range rep.Checks {
+		if check.Name == "Both deployments completed successfully within timeout" {
+			detail = check.Detail
+		}
+	}
+	for _, expected := range []string{
+		"Pod smokeshift-nginx-abcde on node1 is Pending\n  container smokeshift-nginx waiting: ImagePullBackOff: Back-off pulling image",
+		"container smokeshift-nginx restarted 4 times, last exit: Error (exit code 1)",
+		"Pod smokeshift-nginx-klmno is Pending\n  not scheduled: Unschedulable: 0/3 nodes are available: 3 Insufficient memory.",
+		"Recent warning events\n  FailedScheduling pod/smokeshift-nginx-klmno: 0/3 nodes are available\n  Failed pod/smokeshift-nginx-abcde (x3): Failed to pull image\n",
+		"Last logs of smokeshift-nginx-fghij/smokeshift-nginx before it restarted\n  nginx: [emerg] bind() failed\n",
+	} {
+		if !strings.Contains(detail, expected) {
+			t.Errorf("Expected the diagnosis to contain %q, got\n%s", expected, detail)
+		}
+	}
+	if strings.Contains(detail, "Scheduled pod/") {
+		t.Errorf("Expected only warning events, got\n%s", detail)
+	}
+	if n := f.Called(`logs smokeshift-nginx-abcde`); n != 0 {
+		t.Errorf("Expected no logs for a container that never started, got %d calls", n)
+	}
+}
+
+// stuckCluster is a cluster whose Nginx pods never become ready, with the
+// objects and logs diagnostics are collected from
+func stuckCluster(overrides ...FakeResponse) *FakeExecutor {
+	return fakeCluster(append(overrides,
+		FakeResponse{Pattern: `get ds smokeshift-nginx`, Output: `{"status": {"desiredNumberScheduled": 3, "numberReady": 0}}`},
+		FakeResponse{Pattern: `^--namespace=smokeshift get pods -o json$`, Output: fakeStuckPods},
+		FakeResponse{Pattern: `^--namespace=smokeshift get events -o json$`, Output: fakeStuckEvents},
+		FakeResponse{Pattern: `^--namespace=smokeshift get (services|endpoints|replicationcontrollers|deploymentconfigs|daemonsets|routes|buildconfigs|builds|imagestreams|persistentvolumeclaims|networkpolicies) -o json$`, Output: `{"kind": "List", "items": []}`},
+		FakeResponse{Pattern: `^--namespace=smokeshift logs smokeshift-nginx-fghij --container=smokeshift-nginx --tail=1000$`, Output: "starting\n"},
+		FakeResponse{Pattern: `^--namespace=smokeshift logs smokeshift-nginx-fghij --container=smokeshift-nginx --tail=\d+ --previous$`, Output: "nginx: [emerg] bind() failed\n"},
+	)...)
+}
+
+// tarballFiles reads the files of a gzipped tarball by name
+func tarballFiles(t *testing.T, path string) map[string]string {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{}
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return files
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[header.Name] = string(data)
+	}
+}
+
+func TestCheckOpenshiftCollectDiagnostics(t *testing.T) {
+	dir, err := ioutil.TempDir("", "smokeshift")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	config.CollectDiagnostics = true
+	config.DiagnosticsFile = filepath.Join(dir, "run.tar.gz")
+	defer func() {
+		config.CollectDiagnostics = false
+		config.DiagnosticsFile = ""
+	}()
+	f := stuckCluster()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	rep, err := runAgainstContext(ctx, f, false)
+	if err == nil {
+		t.Fatal("Expected deployments that never become ready to fail")
+	}
+	if rep.Diagnostics != config.DiagnosticsFile {
+		t.Errorf("Expected the report to point at the diagnostics, got %q", rep.Diagnostics)
+	}
+
+	files := tarballFiles(t, config.DiagnosticsFile)
+	for name, expected := range map[string]string{
+		"run/project/pods.yaml":                                         "name: smokeshift-nginx-abcde",
+		"run/project/events.yaml":                                       "reason: FailedScheduling",
+		"run/project/describe.txt":                                      "pod/smokeshift-nginx-abcde\n  Phase:     Pending\n  Condition: Ready=False\n  Event:     Normal Scheduled: Successfully assigned\n  Event:     Warning Failed (x3): Failed to pull image\n",
+		"run/logs/smokeshift-nginx-fghij/smokeshift-nginx.log":          "starting",
+		"run/logs/smokeshift-nginx-fghij/smokeshift-nginx.previous.log": "bind() failed",
+		"run/nodes.txt":                                                 "node2",
+		"run/nodes.yaml":                                                "kubeletVersion: v1.11.0+d4cacc0",
+		"run/commands.log":                                              "exit=0 oc --namespace=smokeshift get ds smokeshift-nginx -o json\n",
+		// The report is written once cleanup is done
+		"run/report.json": `"name": "Deleted smokeshift project"`,
+	} {
+		if !strings.Contains(files[name], expected) {
+			t.Errorf("Expected %s to contain %q, got %q", name, expected, files[name])
+		}
+	}
+	if _, ok := files["run/logs/smokeshift-nginx-abcde/smokeshift-nginx.log"]; ok {
+		t.Error("Expected no logs for a container that never started")
+	}
+
+	if _, ok := files["run/isolated/project/pods.yaml"]; ok {
+		t.Error("Expected no isolated project once the run deleted it")
+	}
+	if n := f.Called(`describe`); n != 0 {
+		t.Errorf("Expected the descriptions to be built from the objects read, got %d describe calls", n)
+	}
+
+	collectedAt, deletedAt := -1, -1
+	for i, call := range f.Calls() {
+		switch strings.Join(call, " ") {
+		case "--namespace=smokeshift get buildconfigs -o json":
+			collectedAt = i
+		case "delete project smokeshift":
+			deletedAt = i
+		}
+	}
+	if collectedAt < 0 || deletedAt < collectedAt {
+		t.Errorf("Expected diagnostics to be collected before cleanup, collected at call %d, deleted at %d", collectedAt, deletedAt)
+	}
+}
+
+func TestGather(t *testing.T) {
+	dir, err := ioutil.TempDir("", "smokeshift")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	config.DiagnosticsFile = filepath.Join(dir, "left-behind.tgz")
+	defer func() { config.DiagnosticsFile = "" }()
+	previousNamespace := config.Namespace
+	config.Namespace = "smokeshift"
+	defer func() { config.Namespace = previousNamespace }()
+
+	if _, err := Gather(context.Background(), stuckCluster()); err == nil {
+		t.Error("Expected gathering a project that does not exist to fail")
+	}
+
+	path, err := Gather(context.Background(), stuckCluster(
+		FakeResponse{Pattern: `^--namespace=smokeshift get project smokeshift(-isolated)? -o json$`, Output: `{"status": {"phase": "Active"}}`},
+		FakeResponse{Pattern: `^--namespace=smokeshift-isolated get pods -o json$`, Output: fakeClaimPod("smokeshift-isolated-client", "node4")},
+		FakeResponse{Pattern: `^--namespace=smokeshift-isolated get \w+ -o json$`, Output: `{"kind": "List", "items": []}`},
+	))
+	if err != nil {
+		t.Fatalf("Expected gathering to succeed, got %v", err)
+	}
+	files := tarballFiles(t, path)
+	if _, ok := files["left-behind/project/pods.yaml"]; !ok {
+		t.Errorf("Expected the pods of the project, got %v", files)
+	}
+	if !strings.Contains(files["left-behind/isolated/project/pods.yaml"], "name: smokeshift-isolated-client") {
+		t.Errorf("Expected the pods of the isolated project, got %v", files)
+	}
+	if _, ok := files["left-behind/report.json"]; ok {
+		t.Error("Expected no report without a run")
+	}
+	if log := files["left-behind/commands.log"]; strings.Contains(log, "exit=1") || !strings.HasPrefix(strings.SplitN(log, " ", 4)[3], "oc --namespace=smokeshift get project smokeshift") {
+		t.Errorf("Expected the command log to start over with the project lookup, got %q", log)
+	}
+}
+
+func TestCheckOpenshiftInterrupted(t *testing.T) {
+	f := stuckCluster()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	rep, err := runAgainstContext(ctx, f, false)
+	if err == nil {
+		t.Fatal("Expected an interrupted run to fail")
+	}
+	if !rep.Interrupted || rep.ExitCode(false) != report.ExitInterrupted {
+		t.Errorf("Expected the run to be reported as interrupted, got interrupted=%v, exit code %d", rep.Interrupted, rep.ExitCode(false))
+	}
+	if rep.Cleanup != report.CleanupDone {
+		t.Errorf("Expected cleanup to complete after the interrupt, got %q", rep.Cleanup)
+	}
+	if n := f.Called(`^delete project smokeshift$`); n != 1 {
+		t.Errorf("Expected the project to be deleted after the interrupt, got %d delete calls", n)
+	}
+	if n := f.Called(`get events`); n != 0 {
+		t.Errorf("Expected no diagnosis to hold up cleanup after an interrupt, got %d calls", n)
+	}
+}
+
+func TestCheckOpenshiftCleanupTimeout(t *testing.T) {
+	config.CleanupTimeout = 50 * time.Millisecond
+	defer func() { config.CleanupTimeout = 0 }()
+	f := fakeCluster(FakeResponse{Pattern: `^delete project smokeshift$`, Delay: time.Minute})
+
+	start := time.Now()
+	rep, err := runAgainstContext(context.Background(), f, false)
+	if err == nil {
+		t.Fatal("Expected a cleanup that does not complete to fail the run")
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("Expected cleanup to give up after --cleanup-timeout, took %s", elapsed)
+	}
+	if rep.Cleanup != report.CleanupTimedOut || rep.ExitCode(false) != report.ExitCleanupFailure {
+		t.Errorf("Expected cleanup to time out, got %q and exit code %d", rep.Cleanup, rep.ExitCode(false))
+	}
+}
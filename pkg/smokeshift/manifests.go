@@ -0,0 +1,319 @@
+package smokeshift
+
+// Objects created with RunCreate for the workloads that oc run and oc expose
+// cannot describe.
+
+// nginxDaemonSet runs one nginx pod on every node the scheduler allows,
+// listening on port
+func nginxDaemonSet(name, image string, port int) map[string]interface{} {
+	return daemonSet(name, map[string]interface{}{
+		"name":  name,
+		"image": image,
+		"ports": []interface{}{map[string]interface{}{"containerPort": port}},
+		"readinessProbe": map[string]interface{}{
+			"httpGet": map[string]interface{}{"path": "/", "port": port},
+		},
+	})
+}
+
+// clientDaemonSet runs an idle pod on every node the scheduler allows for
+// commands to be run in
+func clientDaemonSet(name, image string) map[string]interface{} {
+	return daemonSet(name, map[string]interface{}{
+		"name":  name,
+		"image": image,
+		"args":  []string{"sleep", "3600"},
+	})
+}
+
+// daemonSet runs container on every node, the pods carry the same run
+// label oc run would set. apps/v1 is served from Kubernetes 1.9 on and is
+// the only group left from 1.16, it requires the selector to match the
+// template labels.
+func daemonSet(name string, container map[string]interface{}) map[string]interface{} {
+	labels := map[string]string{"run": name}
+	return map[string]interface{}{
+		"kind":       "DaemonSet",
+		"apiVersion": "apps/v1",
+		"metadata":   map[string]interface{}{"name": name, "labels": labels},
+		"spec": map[string]interface{}{
+			"selector": map[string]interface{}{"matchLabels": labels},
+			"template": map[string]interface{}{
+				"metadata": map[string]interface{}{"labels": labels},
+				"spec":     map[string]interface{}{"containers": []interface{}{container}},
+			},
+		},
+	}
+}
+
+// route exposes the target port of a service through the routers, tls sets the
+// termination of TLS routes and is nil for plain HTTP
+func route(name, serviceName string, port int, tls map[string]interface{}) map[string]interface{} {
+	spec := map[string]interface{}{
+		"to":   map[string]interface{}{"kind": "Service", "name": serviceName},
+		"port": map[string]interface{}{"targetPort": port},
+	}
+	if tls != nil {
+		spec["tls"] = tls
+	}
+	return map[string]interface{}{
+		"kind":       "Route",
+		"apiVersion": "route.openshift.io/v1",
+		"metadata":   map[string]interface{}{"name": name},
+		"spec":       spec,
+	}
+}
+
+// service exposes targetPort of the pods run under the given run label on
+// port
+func service(name, run string, port, targetPort int) map[string]interface{} {
+	labels := map[string]string{"run": run}
+	return map[string]interface{}{
+		"kind":       "Service",
+		"apiVersion": "v1",
+		"metadata":   map[string]interface{}{"name": name, "labels": labels},
+		"spec": map[string]interface{}{
+			"selector": labels,
+			"ports":    []interface{}{map[string]interface{}{"protocol": "TCP", "port": port, "targetPort": targetPort}},
+		},
+	}
+}
+
+// headlessService has no cluster IP, its name resolves to the IPs of the
+// ready pods run under the given run label
+func headlessService(name, run string, port int) map[string]interface{} {
+	obj := service(name, run, port, port)
+	obj["spec"].(map[string]interface{})["clusterIP"] = "None"
+	return obj
+}
+
+// externalNameService is an alias of externalName in the cluster DNS
+func externalNameService(name, externalName string) map[string]interface{} {
+	return map[string]interface{}{
+		"kind":       "Service",
+		"apiVersion": "v1",
+		"metadata":   map[string]interface{}{"name": name},
+		"spec": map[string]interface{}{
+			"type":         "ExternalName",
+			"externalName": externalName,
+		},
+	}
+}
+
+// tlsSecret holds a serving certificate and its key
+func tlsSecret(name string, cert, key []byte) map[string]interface{} {
+	return map[string]interface{}{
+		"kind":       "Secret",
+		"apiVersion": "v1",
+		"metadata":   map[string]interface{}{"name": name},
+		"type":       "kubernetes.io/tls",
+		"data":       map[string][]byte{"tls.crt": cert, "tls.key": key},
+	}
+}
+
+func configMap(name string, data map[string]string) map[string]interface{} {
+	return map[string]interface{}{
+		"kind":       "ConfigMap",
+		"apiVersion": "v1",
+		"metadata":   map[string]interface{}{"name": name},
+		"data":       data,
+	}
+}
+
+// tlsNginxConf serves the nginx welcome page over TLS only
+const tlsNginxConf = `server {
+    listen 8443 ssl;
+    ssl_certificate /etc/nginx/tls/tls.crt;
+    ssl_certificate_key /etc/nginx/tls/tls.key;
+    location / {
+        root /usr/share/nginx/html;
+    }
+}
+`
+
+// tlsNginxDeploymentConfig runs a single nginx pod serving HTTPS on port
+// 8443 with the certificate of the secret and the config of the config map,
+// both called name
+func tlsNginxDeploymentConfig(name, image string) map[string]interface{} {
+	labels := map[string]string{"run": name}
+	container := map[string]interface{}{
+		"name":  name,
+		"image": image,
+		"ports": []interface{}{map[string]interface{}{"containerPort": 8443}},
+		"volumeMounts": []interface{}{
+			map[string]interface{}{"name": "tls", "mountPath": "/etc/nginx/tls"},
+			map[string]interface{}{"name": "conf", "mountPath": "/etc/nginx/conf.d"},
+		},
+	}
+	return map[string]interface{}{
+		"kind":       "DeploymentConfig",
+		"apiVersion": "apps.openshift.io/v1",
+		"metadata":   map[string]interface{}{"name": name, "labels": labels},
+		"spec": map[string]interface{}{
+			"replicas": 1,
+			"selector": labels,
+			"triggers": []interface{}{map[string]string{"type": "ConfigChange"}},
+			"template": map[string]interface{}{
+				"metadata": map[string]interface{}{"labels": labels},
+				"spec": map[string]interface{}{
+					"containers": []interface{}{container},
+					"volumes": []interface{}{
+						map[string]interface{}{"name": "tls", "secret": map[string]interface{}{"secretName": name}},
+						map[string]interface{}{"name": "conf", "configMap": map[string]interface{}{"name": name}},
+					},
+				},
+			},
+		},
+	}
+}
+
+// claim requests a volume of the given StorageClass, the default one if
+// storageClass is empty
+func claim(name, storageClass, size string) map[string]interface{} {
+	spec := map[string]interface{}{
+		"accessModes": []string{"ReadWriteOnce"},
+		"resources":   map[string]interface{}{"requests": map[string]string{"storage": size}},
+	}
+	if storageClass != "" {
+		spec["storageClassName"] = storageClass
+	}
+	return map[string]interface{}{
+		"kind":       "PersistentVolumeClaim",
+		"apiVersion": "v1",
+		"metadata":   map[string]interface{}{"name": name},
+		"spec":       spec,
+	}
+}
+
+// idlePod runs a single pod for commands to be run in, under the run label
+// name
+func idlePod(name, image string) map[string]interface{} {
+	return map[string]interface{}{
+		"kind":       "Pod",
+		"apiVersion": "v1",
+		"metadata":   map[string]interface{}{"name": name, "labels": map[string]string{"run": name}},
+		"spec": map[string]interface{}{
+			"terminationGracePeriodSeconds": 1,
+			"containers": []interface{}{map[string]interface{}{
+				"name":  name,
+				"image": image,
+				"args":  []string{"sleep", "3600"},
+			}},
+		},
+	}
+}
+
+// claimPod runs an idle pod with the claim mounted at /data, on any node but
+// avoidNode if set
+func claimPod(name, claimName, image, avoidNode string) map[string]interface{} {
+	pod := idlePod(name, image)
+	spec := pod["spec"].(map[string]interface{})
+	container := spec["containers"].([]interface{})[0].(map[string]interface{})
+	container["volumeMounts"] = []interface{}{map[string]interface{}{"name": "data", "mountPath": "/data"}}
+	spec["volumes"] = []interface{}{map[string]interface{}{
+		"name":                  "data",
+		"persistentVolumeClaim": map[string]interface{}{"claimName": claimName},
+	}}
+	if avoidNode != "" {
+		spec["affinity"] = map[string]interface{}{
+			"nodeAffinity": map[string]interface{}{
+				"requiredDuringSchedulingIgnoredDuringExecution": map[string]interface{}{
+					"nodeSelectorTerms": []interface{}{map[string]interface{}{
+						"matchExpressions": []interface{}{map[string]interface{}{
+							"key":      "kubernetes.io/hostname",
+							"operator": "NotIn",
+							"values":   []string{avoidNode},
+						}},
+					}},
+				},
+			},
+		}
+	}
+	return pod
+}
+
+func imageStream(name string) map[string]interface{} {
+	return map[string]interface{}{
+		"kind":       "ImageStream",
+		"apiVersion": "image.openshift.io/v1",
+		"metadata":   map[string]interface{}{"name": name},
+	}
+}
+
+// dockerBuildConfig builds the inline dockerfile and pushes the image to the
+// latest tag of the image stream called name, builds are started explicitly
+func dockerBuildConfig(name, dockerfile string) map[string]interface{} {
+	return map[string]interface{}{
+		"kind":       "BuildConfig",
+		"apiVersion": "build.openshift.io/v1",
+		"metadata":   map[string]interface{}{"name": name},
+		"spec": map[string]interface{}{
+			"source":   map[string]interface{}{"type": "Dockerfile", "dockerfile": dockerfile},
+			"strategy": map[string]interface{}{"type": "Docker", "dockerStrategy": map[string]interface{}{}},
+			"output": map[string]interface{}{
+				"to": map[string]interface{}{"kind": "ImageStreamTag", "name": name + ":latest"},
+			},
+		},
+	}
+}
+
+// imageStreamDeploymentConfig runs a single pod from the latest tag of the
+// image stream called name, serving HTTP on port
+func imageStreamDeploymentConfig(name string, port int) map[string]interface{} {
+	labels := map[string]string{"run": name}
+	container := map[string]interface{}{
+		"name": name,
+		// Replaced with the image of the tag by the image change trigger
+		"image": " ",
+		"ports": []interface{}{map[string]interface{}{"containerPort": port}},
+		"readinessProbe": map[string]interface{}{
+			"httpGet": map[string]interface{}{"path": "/", "port": port},
+		},
+	}
+	return map[string]interface{}{
+		"kind":       "DeploymentConfig",
+		"apiVersion": "apps.openshift.io/v1",
+		"metadata":   map[string]interface{}{"name": name, "labels": labels},
+		"spec": map[string]interface{}{
+			"replicas": 1,
+			"selector": labels,
+			"triggers": []interface{}{
+				map[string]string{"type": "ConfigChange"},
+				map[string]interface{}{
+					"type": "ImageChange",
+					"imageChangeParams": map[string]interface{}{
+						"automatic":      true,
+						"containerNames": []string{name},
+						"from":           map[string]interface{}{"kind": "ImageStreamTag", "name": name + ":latest"},
+					},
+				},
+			},
+			"template": map[string]interface{}{
+				"metadata": map[string]interface{}{"labels": labels},
+				"spec":     map[string]interface{}{"containers": []interface{}{container}},
+			},
+		},
+	}
+}
+
+// networkPolicy selects the pods run under the given run label and only
+// admits traffic from the pods run under from, or no traffic if from is empty
+func networkPolicy(name, run, from string) map[string]interface{} {
+	ingress := []interface{}{}
+	if from != "" {
+		ingress = append(ingress, map[string]interface{}{
+			"from": []interface{}{map[string]interface{}{
+				"podSelector": map[string]interface{}{"matchLabels": map[string]string{"run": from}},
+			}},
+		})
+	}
+	return map[string]interface{}{
+		"kind":       "NetworkPolicy",
+		"apiVersion": "networking.k8s.io/v1",
+		"metadata":   map[string]interface{}{"name": name},
+		"spec": map[string]interface{}{
+			"podSelector": map[string]interface{}{"matchLabels": map[string]string{"run": run}},
+			"ingress":     ingress,
+		},
+	}
+}
@@ -0,0 +1,310 @@
+package smokeshift
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/opencredo/smokeshift/pkg/config"
+)
+
+// The master checks probe the control plane directly rather than relying on
+// oc calls succeeding: the health endpoints of every API server, the status
+// of the control plane components and how long reads take.
+func init() {
+	Register(apiHealthCheck{})
+	Register(controlPlaneCheck{})
+	Register(apiLatencyCheck{})
+}
+
+const apiLatencyRequests = 20
+
+// 1. Probe the health endpoints of every API server
+type apiHealthCheck struct{}
+
+func (apiHealthCheck) Name() string { return "api-health" }
+func (apiHealthCheck) Description() string {
+	return "Probe /healthz, /readyz and /version on every API server endpoint"
+}
+func (apiHealthCheck) Severity() Severity     { return Advisory }
+func (apiHealthCheck) Tags() []string         { return []string{"master"} }
+func (apiHealthCheck) Dependencies() []string { return nil }
+
+// Permissions are needed to read the kubernetes service endpoints, the
+// health endpoints themselves are open to every user
+func (apiHealthCheck) Permissions() []Permission {
+	if len(config.APIEndpoints) > 0 || config.Restricted {
+		return nil
+	}
+	return []Permission{{Verb: "get", Resource: "endpoints", Namespace: "default"}}
+}
+
+func (apiHealthCheck) Run(ctx context.Context, env *Environment) []Result {
+	results := []Result{}
+	versions := map[string]bool{}
+	for _, endpoint := range apiEndpoints(ctx, env) {
+		for _, path := range []string{"/healthz", "/readyz"} {
+			results = append(results, timed(func() Result {
+				return healthResult(ctx, env, endpoint, path)
+			}))
+		}
+		results = append(results, timed(func() Result {
+			r := versionResult(ctx, env, endpoint)
+			if r.Passed {
+				versions[r.Info["version"]] = true
+			}
+			return r
+		}))
+	}
+	if len(versions) > 1 {
+		found := []string{}
+		for version := range versions {
+			found = append(found, version)
+		}
+		sort.Strings(found)
+		results = append(results, Result{Name: "API server endpoints run the same version", Detail: "Found " + strings.Join(found, ", ") + "\n"})
+	}
+	return results
+}
+
+// lookupHost resolves the host names of the API server URLs
+var lookupHost = net.DefaultResolver.LookupHost
+
+// apiEndpoint is an API server to probe through URL, Addresses are every
+// URL found that reaches the same host
+type apiEndpoint struct {
+	URL       string
+	Addresses []string
+}
+
+// label names the endpoint by all of its addresses
+func (e apiEndpoint) label() string {
+	if len(e.Addresses) < 2 {
+		return e.URL
+	}
+	return e.URL + " (" + strings.Join(e.Addresses[1:], ", ") + ")"
+}
+
+// apiEndpoints returns the server oc talks to and the --api-endpoint URLs,
+// or else the addresses of the kubernetes service, which has an endpoint
+// for every master
+func apiEndpoints(ctx context.Context, env *Environment) []apiEndpoint {
+	urls := []string{}
+	if env.Server != "" {
+		urls = append(urls, env.Server)
+	}
+	if len(config.APIEndpoints) > 0 {
+		return mergeEndpoints(ctx, append(urls, config.APIEndpoints...))
+	}
+	if config.Restricted {
+		return mergeEndpoints(ctx, urls)
+	}
+	// The endpoints cannot always be read, the server alone is probed then
+	ko := env.RunOC(ctx, "--namespace=default", "get", "endpoints", "kubernetes", "-o", "json")
+	return mergeEndpoints(ctx, append(urls, ko.EndpointURLs("https")...))
+}
+
+// mergeEndpoints probes each host and port once, the server URL usually
+// names one of the masters the kubernetes service lists by IP
+func mergeEndpoints(ctx context.Context, urls []string) []apiEndpoint {
+	endpoints := []apiEndpoint{}
+	seen := map[string]int{}
+	listed := map[string]bool{}
+	for _, u := range urls {
+		if listed[u] {
+			continue
+		}
+		listed[u] = true
+		keys := hostPorts(ctx, u)
+		i := -1
+		for _, key := range keys {
+			if j, ok := seen[key]; ok {
+				i = j
+				break
+			}
+		}
+		if i < 0 {
+			i = len(endpoints)
+			endpoints = append(endpoints, apiEndpoint{URL: u})
+		}
+		endpoints[i].Addresses = append(endpoints[i].Addresses, u)
+		for _, key := range keys {
+			if _, ok := seen[key]; !ok {
+				seen[key] = i
+			}
+		}
+	}
+	return endpoints
+}
+
+// hostPorts returns the IP and port pairs the URL reaches, or the URL itself
+// when it cannot be parsed
+func hostPorts(ctx context.Context, raw string) []string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Hostname() == "" {
+		return []string{raw}
+	}
+	port := u.Port()
+	if port == "" {
+		port = "443"
+		if u.Scheme == "http" {
+			port = "80"
+		}
+	}
+	ips := []string{u.Hostname()}
+	if net.ParseIP(u.Hostname()) == nil {
+		if resolved, err := lookupHost(ctx, u.Hostname()); err == nil && len(resolved) > 0 {
+			ips = resolved
+		}
+	}
+	keys := []string{}
+	for _, ip := range ips {
+		keys = append(keys, net.JoinHostPort(ip, port))
+	}
+	return keys
+}
+
+// healthResult expects path to answer ok, /readyz is only served since
+// Kubernetes 1.16 and is reported as such when not found
+func healthResult(ctx context.Context, env *Environment, endpoint apiEndpoint, path string) Result {
+	name := "API server " + endpoint.label() + " answered ok on " + path
+	ko := env.RunOC(ctx, "get", "--raw="+path, "--server="+endpoint.URL)
+	if path == "/readyz" && !ko.Success && strings.Contains(ko.CombinedOut, "NotFound") {
+		return Result{Name: name, Passed: true, Info: map[string]string{"status": "not served"}}
+	}
+	if !ko.Success {
+		return ocResult(name, nil, ko)
+	}
+	r := Result{Name: name, Passed: strings.TrimSpace(ko.CombinedOut) == "ok"}
+	if !r.Passed {
+		r.Detail = ko.CombinedOut
+	}
+	return r
+}
+
+// versionResult reads the Kubernetes version served by the endpoint
+func versionResult(ctx context.Context, env *Environment, endpoint apiEndpoint) Result {
+	name := "API server " + endpoint.label() + " served its version"
+	ko := env.RunOC(ctx, "get", "--raw=/version", "--server="+endpoint.URL)
+	if !ko.Success {
+		return ocResult(name, nil, ko)
+	}
+	version := ko.GitVersion()
+	r := Result{Name: name, Passed: version != "", Info: withInfo(nil, "version", version)}
+	if !r.Passed {
+		r.Detail = "No gitVersion in\n" + ko.CombinedOut
+	}
+	return r
+}
+
+// 2. List the health of the control plane components
+type controlPlaneCheck struct{}
+
+func (controlPlaneCheck) Name() string { return "control-plane" }
+func (controlPlaneCheck) Description() string {
+	return "Expect every ClusterOperator, or component status before OpenShift 4, to be healthy"
+}
+func (controlPlaneCheck) Severity() Severity     { return Advisory }
+func (controlPlaneCheck) Tags() []string         { return []string{"master"} }
+func (controlPlaneCheck) Dependencies() []string { return nil }
+func (controlPlaneCheck) ClusterAccess() []string {
+	return []string{"list ClusterOperators or component statuses"}
+}
+func (controlPlaneCheck) Permissions() []Permission {
+	return []Permission{
+		{Verb: "list", Resource: "clusteroperators.config.openshift.io", Cluster: true},
+		{Verb: "list", Resource: "componentstatuses", Cluster: true},
+	}
+}
+
+func (controlPlaneCheck) Run(ctx context.Context, env *Environment) []Result {
+	var components []ComponentHealth
+	listed := timed(func() Result {
+		name := "Listed the control plane components"
+		// ClusterOperators replace component statuses in OpenShift 4
+		ko := env.RunOC(ctx, "get", "clusteroperators", "-o", "json")
+		if ko.Success {
+			components = ko.ClusterOperators()
+		} else {
+			if ko = env.RunOC(ctx, "get", "componentstatuses", "-o", "json"); !ko.Success {
+				return ocResult(name, nil, ko)
+			}
+			components = ko.ComponentStatuses()
+		}
+		if len(components) == 0 {
+			return Result{Name: name, Detail: "No component found\n"}
+		}
+		return Result{Name: name, Passed: true}
+	})
+	results := []Result{listed}
+	for _, c := range components {
+		r := Result{Name: "Component " + c.Name + " is healthy", Passed: c.Healthy, Info: withInfo(nil, "version", c.Version)}
+		if !c.Healthy {
+			r.Detail = c.Message + "\n"
+		}
+		results = append(results, r)
+	}
+	return results
+}
+
+// 3. Measure how long reads through the API take
+type apiLatencyCheck struct{}
+
+func (apiLatencyCheck) Name() string { return "api-latency" }
+func (apiLatencyCheck) Description() string {
+	return "Measure the round-trip latency of reads from the API server"
+}
+func (apiLatencyCheck) Severity() Severity     { return Advisory }
+func (apiLatencyCheck) Tags() []string         { return []string{"master"} }
+func (apiLatencyCheck) Dependencies() []string { return nil }
+
+// Run reads the pods of the project --api-latency-requests times, one after
+// the other, with the oc backend the time taken includes starting oc
+func (apiLatencyCheck) Run(ctx context.Context, env *Environment) []Result {
+	return []Result{timed(func() Result {
+		requests := config.APILatencyRequests
+		if requests <= 0 {
+			requests = apiLatencyRequests
+		}
+		name := fmt.Sprintf("Read the pods of project %s %d times", config.Namespace, requests)
+		latencies := []time.Duration{}
+		for i := 0; i < requests; i++ {
+			start := time.Now()
+			if ko := env.RunOCinNamespace(ctx, "get", "pods", "-o", "json"); !ko.Success {
+				return ocResult(name, nil, ko)
+			}
+			latencies = append(latencies, time.Since(start))
+		}
+		return Result{Name: name, Passed: true, Info: latencyInfo(latencies)}
+	})}
+}
+
+// latencyInfo reports the median, 90th and 99th percentiles and the maximum
+// of latencies
+func latencyInfo(latencies []time.Duration) map[string]string {
+	if len(latencies) == 0 {
+		return nil
+	}
+	sorted := append([]time.Duration{}, latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return map[string]string{
+		"p50": percentile(sorted, 50).String(),
+		"p90": percentile(sorted, 90).String(),
+		"p99": percentile(sorted, 99).String(),
+		"max": sorted[len(sorted)-1].String(),
+	}
+}
+
+// percentile returns the nearest-rank percentile p of sorted latencies
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
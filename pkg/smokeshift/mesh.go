@@ -0,0 +1,139 @@
+package smokeshift
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/opencredo/smokeshift/pkg/config"
+	"github.com/opencredo/smokeshift/pkg/report"
+	"github.com/opencredo/smokeshift/pkg/util"
+)
+
+// In mesh mode a client pod runs on every node and every Nginx pod is
+// accessed from each of them, so a broken path between any two nodes shows.
+func init() {
+	Register(meshCheck{})
+}
+
+// meshMode reports whether the mesh clients are deployed: with --mesh, or
+// when --only names the mesh check or tag, which would select nothing
+// otherwise. Tags like network that also match the mesh check do not imply
+// it.
+func meshMode() bool {
+	for _, selector := range config.Only {
+		if selector == "mesh" || selector == (meshCheck{}).Name() {
+			return true
+		}
+	}
+	return config.Mesh
+}
+
+type meshCheck struct{}
+
+func (meshCheck) Name() string { return "pod-mesh" }
+func (meshCheck) Description() string {
+	return "Access every Nginx pod by its IP from a client pod on every node (--mesh)"
+}
+func (meshCheck) Severity() Severity     { return Required }
+func (meshCheck) Tags() []string         { return []string{"network", "mesh"} }
+func (meshCheck) Dependencies() []string { return nil }
+
+// Run probes from all clients at once, each client accesses the Nginx pods
+// one after the other
+func (meshCheck) Run(ctx context.Context, env *Environment) []Result {
+	perClient := make([][]Result, len(env.MeshClients))
+	var wg sync.WaitGroup
+	for i, client := range env.MeshClients {
+		wg.Add(1)
+		go func(i int, client Pod) {
+			defer wg.Done()
+			for _, pod := range env.NginxPods {
+				result := timed(func() Result {
+					return podFetch(ctx, env, client, "Accessed Nginx pod at "+pod.IP+" on "+pod.Node+" from "+client.Node, pod.target(), nginxAddress(pod.IP))
+				})
+				result.Source = client.target()
+				perClient[i] = append(perClient[i], result)
+			}
+		}(i, client)
+	}
+	wg.Wait()
+
+	results := []Result{}
+	for _, r := range perClient {
+		results = append(results, r...)
+	}
+	return results
+}
+
+// recordMesh adds the node by node matrix of the pod-mesh results to the
+// report and prints it with the pairs of nodes that cannot talk
+func recordMesh(rec *recorder, env *Environment) {
+	if len(env.MeshClients) == 0 {
+		return
+	}
+	matrix := meshMatrix(rec.report.Checks)
+	if len(matrix) == 0 {
+		return
+	}
+	rec.report.Mesh = matrix
+
+	from := []string{}
+	toSet := map[string]bool{}
+	for source, row := range matrix {
+		from = append(from, source)
+		for destination := range row {
+			toSet[destination] = true
+		}
+	}
+	to := []string{}
+	for destination := range toSet {
+		to = append(to, destination)
+	}
+	sort.Strings(from)
+	sort.Strings(to)
+
+	rows := [][]string{}
+	broken := []string{}
+	for _, source := range from {
+		row := []string{source}
+		for _, destination := range to {
+			ok, probed := matrix[source][destination]
+			switch {
+			case !probed:
+				row = append(row, "-")
+			case ok:
+				row = append(row, "ok")
+			default:
+				row = append(row, "FAIL")
+				broken = append(broken, source+" -> "+destination)
+			}
+		}
+		rows = append(rows, row)
+	}
+	rec.info("Pod network mesh, client nodes by Nginx nodes")
+	util.PrintTable(rec.out, append([]string{"from \\ to"}, to...), rows)
+	if len(broken) > 0 {
+		rec.info("Node pairs that cannot talk: " + strings.Join(broken, ", "))
+	}
+}
+
+// meshMatrix tells, by client node then Nginx node, whether every probe
+// between the two passed
+func meshMatrix(results []report.CheckResult) map[string]map[string]bool {
+	matrix := map[string]map[string]bool{}
+	for _, result := range results {
+		if result.Check != "pod-mesh" || result.Source == nil || result.Target == nil {
+			continue
+		}
+		row, ok := matrix[result.Source.Node]
+		if !ok {
+			row = map[string]bool{}
+			matrix[result.Source.Node] = row
+		}
+		passed, probed := row[result.Target.Node]
+		row[result.Target.Node] = result.Status == report.OK && (passed || !probed)
+	}
+	return matrix
+}
@@ -0,0 +1,119 @@
+package smokeshift
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// The network policy check proves the SDN plugin enforces NetworkPolicy
+// objects rather than only accepting them: BusyBox must lose access to the
+// Nginx pods under a deny-all policy and get it back once allowed.
+func init() {
+	Register(networkPolicyCheck{})
+}
+
+const (
+	denyPolicyName  = runPrefix + "deny-all"
+	allowPolicyName = runPrefix + "allow-busybox"
+	policyTimeout   = 60 * time.Second
+)
+
+type networkPolicyCheck struct{}
+
+func (networkPolicyCheck) Name() string { return "network-policy" }
+func (networkPolicyCheck) Description() string {
+	return "Deny all traffic to the Nginx pods, then allow BusyBox, and verify both are enforced"
+}
+func (networkPolicyCheck) Severity() Severity { return Advisory }
+func (networkPolicyCheck) Tags() []string     { return []string{"network", "policy"} }
+
+// Dependencies make sure BusyBox reaches the pods before policies apply
+func (networkPolicyCheck) Dependencies() []string { return []string{"pod-ip"} }
+
+func (networkPolicyCheck) Permissions() []Permission {
+	return []Permission{
+		{Verb: "create", Resource: "networkpolicies.networking.k8s.io"},
+		{Verb: "delete", Resource: "networkpolicies.networking.k8s.io"},
+	}
+}
+
+// Run removes the policies whatever the outcome, even when cleanup is
+// skipped, as they would break the checks run after it
+func (networkPolicyCheck) Run(ctx context.Context, env *Environment) []Result {
+	results := []Result{timed(func() Result {
+		return enforcePolicy(ctx, env, "Nginx pods unreachable from BusyBox under a deny-all network policy",
+			networkPolicy(denyPolicyName, ngDeploymentName, ""), false)
+	})}
+	if results[0].Passed {
+		results = append(results, timed(func() Result {
+			return enforcePolicy(ctx, env, "Nginx pods reachable from BusyBox again once allowed by a network policy",
+				networkPolicy(allowPolicyName, ngDeploymentName, bbDeploymentName), true)
+		}))
+	}
+	return append(results, timed(func() Result {
+		name := "Deleted network policies"
+		out := ""
+		for _, policy := range []string{allowPolicyName, denyPolicyName} {
+			if ko := env.RunOCinNamespace(ctx, "delete", "networkpolicy", policy); !ko.Success && !strings.Contains(ko.CombinedOut, "NotFound") {
+				out += ko.CombinedOut
+			}
+		}
+		return Result{Name: name, Passed: out == "", Detail: out}
+	}))
+}
+
+// enforcePolicy creates the policy and waits until every Nginx pod is
+// reachable, or unreachable, from BusyBox, reporting how long that took. A
+// probe that fails other than by wget not reaching the pod, e.g. oc exec
+// itself, fails the step rather than counting as unreachable.
+func enforcePolicy(ctx context.Context, env *Environment, name string, policy map[string]interface{}, reachable bool) Result {
+	if len(env.NginxPods) == 0 {
+		return Result{Name: name, Detail: "No Nginx pod to probe\n"}
+	}
+	start := time.Now()
+	if ko := env.RunCreate(ctx, policy); !ko.Success {
+		return ocResult(name, nil, ko)
+	}
+	var pending []string
+	var failed *OCOutput
+	r := waitUntil(ctx, name, "the network policy to be enforced", policyTimeout, func() bool {
+		pending = []string{}
+		for _, pod := range env.NginxPods {
+			ko := env.RunOCinNamespace(ctx, "exec", env.Busybox.Name, "--", "wget", "-qO-", "-T", "2", nginxAddress(pod.IP))
+			if !ko.Success && !wgetUnreachable(ko) {
+				failed = &ko
+				return true
+			}
+			if ko.Success != reachable {
+				pending = append(pending, pod.IP)
+			}
+		}
+		return len(pending) == 0
+	})
+	if failed != nil {
+		r = ocResult(name, env.Busybox.target(), *failed)
+		r.Detail = "Could not probe the Nginx pods from BusyBox:\n" + r.Detail
+		return r
+	}
+	if r.Passed {
+		r.Info = map[string]string{"convergence time": time.Since(start).String()}
+	} else if len(pending) > 0 && !r.TimedOut {
+		state := "reachable"
+		if reachable {
+			state = "unreachable"
+		}
+		r.Detail += "Still " + state + ": " + strings.Join(pending, ", ") + "\n"
+	}
+	return r
+}
+
+// wgetUnreachable reports whether wget, run in a pod with oc exec, failed
+// because the address did not answer or refused the connection, rather than
+// oc exec or the API server failing
+func wgetUnreachable(ko OCOutput) bool {
+	if ko.Success || ko.TimedOut || ko.ExitCode != 1 || !strings.Contains(ko.CombinedOut, "wget: ") {
+		return false
+	}
+	return strings.Contains(ko.CombinedOut, "timed out") || strings.Contains(ko.CombinedOut, "refused")
+}
@@ -0,0 +1,108 @@
+package smokeshift
+
+import (
+	"context"
+	"io"
+	"strings"
+
+	"github.com/opencredo/smokeshift/pkg/report"
+	"github.com/opencredo/smokeshift/pkg/util"
+)
+
+// The node health check reads the conditions every node reports, a node
+// that is not ready or under pressure cannot be relied on to run pods.
+func init() {
+	Register(nodeHealthCheck{})
+}
+
+type nodeHealthCheck struct{}
+
+func (nodeHealthCheck) Name() string { return "node-health" }
+func (nodeHealthCheck) Description() string {
+	return "Expect every node to be ready and free of memory, disk and PID pressure"
+}
+func (nodeHealthCheck) Severity() Severity      { return Advisory }
+func (nodeHealthCheck) Tags() []string          { return []string{"nodes"} }
+func (nodeHealthCheck) Dependencies() []string  { return nil }
+func (nodeHealthCheck) ClusterAccess() []string { return []string{"list the nodes"} }
+func (nodeHealthCheck) Permissions() []Permission {
+	return []Permission{{Verb: "list", Resource: "nodes", Cluster: true}}
+}
+
+func (nodeHealthCheck) Run(ctx context.Context, env *Environment) []Result {
+	if len(env.NodeInventory) == 0 {
+		return []Result{{Name: "Found the nodes", Detail: "No node listed\n"}}
+	}
+	results := []Result{}
+	for _, n := range env.NodeInventory {
+		r := Result{
+			Name:   "Node " + n.Name + " is ready without pressure",
+			Passed: len(n.Problems) == 0,
+			Target: &report.Target{Node: n.Name},
+			Info:   withInfo(nil, "roles", strings.Join(n.Roles, ","), "kubelet", n.KubeletVersion),
+		}
+		if !r.Passed {
+			r.Detail = strings.Join(n.Problems, "\n") + "\n"
+		}
+		results = append(results, r)
+	}
+	return results
+}
+
+// nodeInventory describes the nodes for the report
+func nodeInventory(nodes []Node) []report.NodeInfo {
+	inventory := []report.NodeInfo{}
+	for _, n := range nodes {
+		info := report.NodeInfo{
+			Name:             n.Name,
+			Roles:            n.Roles,
+			Ready:            n.Ready,
+			Schedulable:      n.Schedulable(),
+			KubeletVersion:   n.KubeletVersion,
+			OSImage:          n.OSImage,
+			KernelVersion:    n.KernelVersion,
+			ContainerRuntime: n.ContainerRuntime,
+		}
+		for _, problem := range n.Problems {
+			info.Problems = append(info.Problems, strings.SplitN(problem, ":", 2)[0])
+		}
+		for _, taint := range n.Taints {
+			info.Taints = append(info.Taints, taint.String())
+		}
+		inventory = append(inventory, info)
+	}
+	return inventory
+}
+
+// recordNodes prints the node inventory of the report as a table
+func recordNodes(rec *recorder) {
+	if len(rec.report.Nodes) == 0 {
+		return
+	}
+	rec.info("Node inventory")
+	printNodes(rec.out, rec.report.Nodes)
+}
+
+// printNodes prints a row per node
+func printNodes(out io.Writer, nodes []report.NodeInfo) {
+	rows := [][]string{}
+	for _, n := range nodes {
+		status := "Ready"
+		if !n.Ready {
+			status = "NotReady"
+		}
+		if !n.Schedulable {
+			status += ",Unschedulable"
+		}
+		rows = append(rows, []string{n.Name, orNone(strings.Join(n.Roles, ",")), status,
+			orNone(strings.Join(n.Problems, ",")), orNone(strings.Join(n.Taints, ",")), n.KubeletVersion, n.OSImage, n.ContainerRuntime})
+	}
+	util.PrintTable(out, []string{"node", "roles", "status", "problems", "taints", "kubelet", "os", "runtime"}, rows)
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "<none>"
+	}
+	return s
+}
@@ -1,10 +1,15 @@
 package smokeshift
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"os/exec"
+	"io/ioutil"
+	"os"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/opencredo/smokeshift/pkg/config"
 )
@@ -13,69 +18,129 @@ type OCOutput struct {
 	Success     bool
 	CombinedOut string
 	RawOut      []byte
+	ExitCode    int
+	// TimedOut is set when the command was stopped because its context
+	// expired, either the per call timeout or the overall deadline.
+	TimedOut bool
 }
 
-func RunOCinNamespace(args ...string) OCOutput {
+func (env *Environment) RunOCinNamespace(ctx context.Context, args ...string) OCOutput {
 	if config.Namespace != "" {
 		args = append([]string{"--namespace=" + config.Namespace}, args...)
 	}
 
-	return RunOC(args...)
+	return env.RunOC(ctx, args...)
 }
 
-func RunOC(args ...string) OCOutput {
-	OCCmd := exec.Command("oc", args...)
-	bytes, err := OCCmd.CombinedOutput()
-	if err != nil {
-		return OCOutput{
-			Success:     false,
-			CombinedOut: string(bytes),
-			RawOut:      bytes,
-		}
+// RunOC runs a single oc command with the Executor of env, bounded by
+// config.CallTimeout
+func (env *Environment) RunOC(ctx context.Context, args ...string) OCOutput {
+	if config.CallTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, config.CallTimeout)
+		defer cancel()
 	}
-	return OCOutput{
-		Success:     true,
-		CombinedOut: string(bytes),
-		RawOut:      bytes,
+	start := time.Now()
+	ko := env.Executor.Execute(ctx, args...)
+	if !ko.Success && ctx.Err() != nil {
+		ko.TimedOut = true
 	}
+	commands.record(start, args, ko)
+	return ko
+}
+
+func (env *Environment) RunGetService(ctx context.Context, svcName string) OCOutput {
+	return env.RunOCinNamespace(ctx, "get", "service", svcName, "-o", "json")
 }
 
-func RunGetService(svcName string) OCOutput {
-	return RunOCinNamespace("get", "service", svcName, "-o", "json")
+func (env *Environment) RunGetPodByImage(ctx context.Context, name string) OCOutput {
+	return env.RunOCinNamespace(ctx, "get", "deployment", name, "-o", "json")
 }
 
-func RunGetPodByImage(name string) OCOutput {
-	return RunOCinNamespace("get", "deployment", name, "-o", "json")
+func (env *Environment) RunGetDeployment(ctx context.Context, name string) OCOutput {
+	return env.RunOCinNamespace(ctx, "get", "dc", name, "-o", "json")
 }
 
-func RunGetDeployment(name string) OCOutput {
-	return RunOCinNamespace("get", "dc", name, "-o", "json")
+func (env *Environment) RunGetProject(ctx context.Context, name string) OCOutput {
+	return env.RunOCinNamespace(ctx, "get", "project", name, "-o", "json")
 }
 
-func RunGetProject(name string) OCOutput {
-	return RunOCinNamespace("get", "project", name, "-o", "json")
+func (env *Environment) RunCreateProject(ctx context.Context, name string) OCOutput {
+	return env.RunOC(ctx, "new-project", name, "--skip-config-write=true")
 }
 
-func RunCreateProject(name string) OCOutput {
-	return RunOC("new-project", name, "--skip-config-write=true")
+func (env *Environment) RunDeleteProject(ctx context.Context, name string) OCOutput {
+	return env.RunOC(ctx, "delete", "project", name)
 }
 
-func RunDeleteProject(name string) OCOutput {
-	return RunOC("delete", "project", name)
+// RunJoinProjects joins the pod network of project to the one of target
+func (env *Environment) RunJoinProjects(ctx context.Context, target, project string) OCOutput {
+	return env.RunOC(ctx, "adm", "pod-network", "join-projects", "--to="+target, project)
 }
 
-func RunEnablePolicy(args ...string) OCOutput {
+// RunCanI asks whether the user may perform verb on resource in namespace,
+// or cluster-wide if namespace is empty. A subresource is given as e.g.
+// pods/exec.
+func (env *Environment) RunCanI(ctx context.Context, verb, resource, namespace string) OCOutput {
+	args := []string{"auth", "can-i", verb}
+	if parts := strings.SplitN(resource, "/", 2); len(parts) == 2 {
+		args = append(args, parts[0], "--subresource="+parts[1])
+	} else {
+		args = append(args, resource)
+	}
+	if namespace != "" {
+		args = append([]string{"--namespace=" + namespace}, args...)
+	}
+	return env.RunOC(ctx, args...)
+}
+
+func (env *Environment) RunEnablePolicy(ctx context.Context, args ...string) OCOutput {
 	args = append([]string{"adm", "policy"}, args...)
-	return RunOC(args...)
+	return env.RunOC(ctx, args...)
+}
+
+func (env *Environment) RunPod(ctx context.Context, name string, image string, count int64) OCOutput {
+	//return env.RunOCinNamespace(ctx, "run", name, "--image="+image, "--image-pull-policy=IfNotPresent", "--replicas="+strconv.FormatInt(count, 10), "-o", "json")
+	return env.RunOCinNamespace(ctx, "run", name, "--image="+image, "--replicas="+strconv.FormatInt(count, 10), "-o", "json")
+}
+
+func (env *Environment) RunGetNodes(ctx context.Context) OCOutput {
+	return env.RunOCinNamespace(ctx, "get", "nodes", "-o", "json")
+}
+
+func (env *Environment) RunGetDaemonSet(ctx context.Context, name string) OCOutput {
+	return env.RunOCinNamespace(ctx, "get", "ds", name, "-o", "json")
 }
 
-func RunPod(name string, image string, count int64) OCOutput {
-	//return RunOCinNamespace("run", name, "--image="+image, "--image-pull-policy=IfNotPresent", "--replicas="+strconv.FormatInt(count, 10), "-o", "json")
-	return RunOCinNamespace("run", name, "--image="+image, "--replicas="+strconv.FormatInt(count, 10), "-o", "json")
+// RunCreate creates objects in the namespace with oc create, they are
+// written to a temporary file as a List first
+func (env *Environment) RunCreate(ctx context.Context, objects ...interface{}) OCOutput {
+	return env.RunCreateInNamespace(ctx, config.Namespace, objects...)
 }
 
-func RunGetNodes() OCOutput {
-	return RunOCinNamespace("get", "nodes", "-o", "json")
+// RunCreateInNamespace creates objects in the given namespace
+func (env *Environment) RunCreateInNamespace(ctx context.Context, namespace string, objects ...interface{}) OCOutput {
+	list := map[string]interface{}{"kind": "List", "apiVersion": "v1", "items": objects}
+	data, err := json.Marshal(list)
+	if err != nil {
+		return OCOutput{CombinedOut: err.Error() + "\n", ExitCode: 1}
+	}
+	f, err := ioutil.TempFile("", runPrefix)
+	if err != nil {
+		return OCOutput{CombinedOut: err.Error() + "\n", ExitCode: 1}
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return OCOutput{CombinedOut: err.Error() + "\n", ExitCode: 1}
+	}
+	if namespace == "" {
+		return env.RunOC(ctx, "create", "-f", f.Name())
+	}
+	return env.RunOC(ctx, "--namespace="+namespace, "create", "-f", f.Name())
 }
 
 func (ko OCOutput) ObservedReplicaCount() int64 {
@@ -84,6 +149,21 @@ func (ko OCOutput) ObservedReplicaCount() int64 {
 	return resp.Status.AvaiableReplicas
 }
 
+// DaemonSetReady reports whether every pod the DaemonSet should run is
+// ready, a DaemonSet with no pods scheduled is not
+func (ko OCOutput) DaemonSetReady() bool {
+	resp := DaemonSetResponse{}
+	json.Unmarshal(ko.RawOut, &resp)
+	return resp.Status.DesiredNumberScheduled > 0 && resp.Status.NumberReady == resp.Status.DesiredNumberScheduled
+}
+
+type DaemonSetResponse struct {
+	Status struct {
+		DesiredNumberScheduled int64 `json:"desiredNumberScheduled"`
+		NumberReady            int64 `json:"numberReady"`
+	} `json:"status"`
+}
+
 type DeploymentResponse struct {
 	Status struct {
 		AvaiableReplicas int64 `json:"availableReplicas"`
@@ -102,11 +182,13 @@ type ServiceResponse struct {
 	} `json:"spec"`
 }
 
+// PodIPs returns the IPs of the pods listed by oc get pods -o json, or nil
+// if the output cannot be parsed
 func (ko OCOutput) PodIPs() []string {
 	//In Scala, this code would be gorgeous. In Golang, it's a blood blister
 	resp := PodsResponse{}
 	if err := json.Unmarshal(ko.RawOut, &resp); err != nil {
-		fmt.Println(err)
+		return nil
 	}
 	podIPs := make([]string, len(resp.Items))
 	for i, item := range resp.Items {
@@ -115,37 +197,365 @@ func (ko OCOutput) PodIPs() []string {
 	return podIPs
 }
 
+// FirstPodName returns the name of the first pod listed by oc get pods -o
+// json, or "" if the output cannot be parsed
 func (ko OCOutput) FirstPodName() string {
 	resp := PodsResponse{}
 	if err := json.Unmarshal(ko.RawOut, &resp); err != nil {
-		fmt.Println(err)
+		return ""
 	}
-	json.Unmarshal(ko.RawOut, &resp)
 	if len(resp.Items) < 1 {
 		return ""
 	}
 	return resp.Items[0].Metadata.Name
 }
 
+// Pod is the name, IP and node of a pod
+type Pod struct {
+	Name  string
+	IP    string
+	Node  string
+	Ready bool
+}
+
+// Pods returns the pods listed by oc get pods -o json, or nil if the output
+// cannot be parsed, e.g. when the call failed
+func (ko OCOutput) Pods() []Pod {
+	resp := PodsResponse{}
+	if err := json.Unmarshal(ko.RawOut, &resp); err != nil {
+		return nil
+	}
+	pods := make([]Pod, len(resp.Items))
+	for i, item := range resp.Items {
+		pods[i] = Pod{Name: item.Metadata.Name, IP: item.Status.PodIP, Node: item.Spec.NodeName}
+		for _, condition := range item.Status.Conditions {
+			if condition.Type == "Ready" {
+				pods[i].Ready = condition.Status == "True"
+			}
+		}
+	}
+	return pods
+}
+
 type PodsResponse struct {
 	Items []struct {
 		Metadata struct {
 			Name string `json:"name"`
 		} `json:"metadata"`
+		Spec struct {
+			NodeName string `json:"nodeName"`
+		} `json:"spec"`
 		Status struct {
-			PodIP string `json:"podIP"`
+			Phase      string `json:"phase"`
+			PodIP      string `json:"podIP"`
+			Conditions []struct {
+				Type    string `json:"type"`
+				Status  string `json:"status"`
+				Reason  string `json:"reason"`
+				Message string `json:"message"`
+			} `json:"conditions"`
+			ContainerStatuses []struct {
+				Name         string         `json:"name"`
+				RestartCount int            `json:"restartCount"`
+				State        ContainerState `json:"state"`
+				LastState    ContainerState `json:"lastState"`
+			} `json:"containerStatuses"`
 		} `json:"status"`
 	} `json:"items"`
 }
 
+// ContainerState is the state of a container, only one of its fields is set
+type ContainerState struct {
+	Waiting *struct {
+		Reason  string `json:"reason"`
+		Message string `json:"message"`
+	} `json:"waiting"`
+	Running *struct {
+		StartedAt string `json:"startedAt"`
+	} `json:"running"`
+	Terminated *struct {
+		Reason   string `json:"reason"`
+		Message  string `json:"message"`
+		ExitCode int    `json:"exitCode"`
+	} `json:"terminated"`
+}
+
+// PodState tells why a pod is not ready
+type PodState struct {
+	Pod
+	Phase string
+	// Problems describe what keeps the pod from being ready, e.g.
+	// "container nginx waiting: ImagePullBackOff: Back-off pulling image"
+	Problems []string
+	// Logged are the containers that started and may have logged something,
+	// Restarted those whose previous run logged why it stopped
+	Logged    []string
+	Restarted []string
+}
+
+// PodStates returns the state of every pod, pods that are ready have no
+// problems
+func (ko OCOutput) PodStates() []PodState {
+	resp := PodsResponse{}
+	if err := json.Unmarshal(ko.RawOut, &resp); err != nil {
+		return nil
+	}
+	pods := ko.Pods()
+	states := []PodState{}
+	for i, item := range resp.Items {
+		state := PodState{Pod: pods[i], Phase: item.Status.Phase}
+		for _, cond := range item.Status.Conditions {
+			if cond.Type == "PodScheduled" && cond.Status != "True" {
+				state.Problems = append(state.Problems, "not scheduled: "+joinNonEmpty(": ", cond.Reason, cond.Message))
+			}
+		}
+		for _, c := range item.Status.ContainerStatuses {
+			switch {
+			case c.State.Waiting != nil:
+				state.Problems = append(state.Problems, "container "+c.Name+" waiting: "+joinNonEmpty(": ", c.State.Waiting.Reason, c.State.Waiting.Message))
+			case c.State.Terminated != nil:
+				state.Problems = append(state.Problems, fmt.Sprintf("container %s terminated: %s (exit code %d)", c.Name, joinNonEmpty(": ", c.State.Terminated.Reason, c.State.Terminated.Message), c.State.Terminated.ExitCode))
+				state.Logged = append(state.Logged, c.Name)
+			default:
+				state.Logged = append(state.Logged, c.Name)
+			}
+			if last := c.LastState.Terminated; c.RestartCount > 0 && last != nil {
+				state.Problems = append(state.Problems, fmt.Sprintf("container %s restarted %d times, last exit: %s (exit code %d)", c.Name, c.RestartCount, last.Reason, last.ExitCode))
+				state.Restarted = append(state.Restarted, c.Name)
+				if c.State.Waiting != nil {
+					state.Logged = append(state.Logged, c.Name)
+				}
+			}
+		}
+		if len(state.Problems) == 0 && !state.Ready {
+			for _, cond := range item.Status.Conditions {
+				if cond.Type == "Ready" && cond.Status != "True" {
+					state.Problems = append(state.Problems, "not ready: "+joinNonEmpty(": ", cond.Reason, cond.Message))
+				}
+			}
+		}
+		states = append(states, state)
+	}
+	return states
+}
+
+// Event is a Kubernetes event about an object of the project
+type Event struct {
+	Type    string
+	Reason  string
+	Object  string
+	Message string
+	Count   int
+	Last    time.Time
+}
+
+// Events returns the events from the oldest to the most recent
+func (ko OCOutput) Events() []Event {
+	resp := struct {
+		Items []struct {
+			Type           string `json:"type"`
+			Reason         string `json:"reason"`
+			Message        string `json:"message"`
+			Count          int    `json:"count"`
+			LastTimestamp  string `json:"lastTimestamp"`
+			InvolvedObject struct {
+				Kind string `json:"kind"`
+				Name string `json:"name"`
+			} `json:"involvedObject"`
+		} `json:"items"`
+	}{}
+	json.Unmarshal(ko.RawOut, &resp)
+	events := []Event{}
+	for _, item := range resp.Items {
+		last, _ := time.Parse(time.RFC3339, item.LastTimestamp)
+		events = append(events, Event{
+			Type:    item.Type,
+			Reason:  item.Reason,
+			Object:  strings.ToLower(item.InvolvedObject.Kind) + "/" + item.InvolvedObject.Name,
+			Message: strings.TrimSpace(item.Message),
+			Count:   item.Count,
+			Last:    last,
+		})
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Last.Before(events[j].Last) })
+	return events
+}
+
+// ObjectStatus is what the status of an object of any kind tells, e.g.
+// "Ready=False (ContainersNotReady: containers with unready status)"
+type ObjectStatus struct {
+	Name       string
+	Created    string
+	Phase      string
+	Conditions []string
+}
+
+// ObjectStatuses returns the name, phase and conditions of every object of a
+// list, whatever its kind
+func (ko OCOutput) ObjectStatuses() []ObjectStatus {
+	resp := struct {
+		Items []struct {
+			Metadata struct {
+				Name              string `json:"name"`
+				CreationTimestamp string `json:"creationTimestamp"`
+			} `json:"metadata"`
+			Status struct {
+				Phase      string `json:"phase"`
+				Conditions []struct {
+					Type    string `json:"type"`
+					Status  string `json:"status"`
+					Reason  string `json:"reason"`
+					Message string `json:"message"`
+				} `json:"conditions"`
+			} `json:"status"`
+		} `json:"items"`
+	}{}
+	json.Unmarshal(ko.RawOut, &resp)
+	objects := []ObjectStatus{}
+	for _, item := range resp.Items {
+		obj := ObjectStatus{Name: item.Metadata.Name, Created: item.Metadata.CreationTimestamp, Phase: item.Status.Phase}
+		for _, c := range item.Status.Conditions {
+			condition := c.Type + "=" + c.Status
+			if why := joinNonEmpty(": ", c.Reason, firstLine(c.Message)); why != "" {
+				condition += " (" + why + ")"
+			}
+			obj.Conditions = append(obj.Conditions, condition)
+		}
+		objects = append(objects, obj)
+	}
+	return objects
+}
+
+// joinNonEmpty joins the parts that are not empty with sep
+func joinNonEmpty(sep string, parts ...string) string {
+	nonEmpty := []string{}
+	for _, part := range parts {
+		if part != "" {
+			nonEmpty = append(nonEmpty, part)
+		}
+	}
+	return strings.Join(nonEmpty, sep)
+}
+
 type NodeResponse struct {
 	Items []struct {
+		Metadata struct {
+			Name   string            `json:"name"`
+			Labels map[string]string `json:"labels"`
+		} `json:"metadata"`
 		Spec struct {
-			Unschedulable bool `json:"unschedulable,omitempty"`
+			Unschedulable bool        `json:"unschedulable,omitempty"`
+			Taints        []NodeTaint `json:"taints"`
 		} `json:"spec"`
+		Status struct {
+			Conditions []struct {
+				Type    string `json:"type"`
+				Status  string `json:"status"`
+				Message string `json:"message"`
+			} `json:"conditions"`
+			NodeInfo struct {
+				KubeletVersion          string `json:"kubeletVersion"`
+				OSImage                 string `json:"osImage"`
+				KernelVersion           string `json:"kernelVersion"`
+				ContainerRuntimeVersion string `json:"containerRuntimeVersion"`
+			} `json:"nodeInfo"`
+		} `json:"status"`
 	} `json:"items"`
 }
 
+// NodeTaint keeps pods that do not tolerate it off a node
+type NodeTaint struct {
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+	Effect string `json:"effect"`
+}
+
+func (t NodeTaint) String() string {
+	if t.Value == "" {
+		return t.Key + ":" + t.Effect
+	}
+	return t.Key + "=" + t.Value + ":" + t.Effect
+}
+
+// Node is what the report tells about a node
+type Node struct {
+	Name string
+	// Roles come from the node-role.kubernetes.io/ROLE labels
+	Roles         []string
+	Unschedulable bool
+	Ready         bool
+	// Problems are the conditions reporting trouble with their message,
+	// e.g. "DiskPressure: kubelet has disk pressure"
+	Problems         []string
+	Taints           []NodeTaint
+	KubeletVersion   string
+	OSImage          string
+	KernelVersion    string
+	ContainerRuntime string
+}
+
+// Schedulable tells whether pods without tolerations, like the Nginx pods,
+// can run on the node
+func (n Node) Schedulable() bool {
+	if n.Unschedulable || !n.Ready {
+		return false
+	}
+	for _, taint := range n.Taints {
+		if taint.Effect == "NoSchedule" || taint.Effect == "NoExecute" {
+			return false
+		}
+	}
+	return true
+}
+
+// nodeProblems are the conditions that report trouble when true
+var nodeProblems = map[string]bool{
+	"MemoryPressure":     true,
+	"DiskPressure":       true,
+	"PIDPressure":        true,
+	"OutOfDisk":          true,
+	"NetworkUnavailable": true,
+}
+
+// Nodes returns every node with its conditions, taints and versions
+func (ko OCOutput) Nodes() []Node {
+	resp := NodeResponse{}
+	json.Unmarshal(ko.RawOut, &resp)
+	nodes := []Node{}
+	for _, item := range resp.Items {
+		info := item.Status.NodeInfo
+		n := Node{
+			Name:             item.Metadata.Name,
+			Roles:            []string{},
+			Unschedulable:    item.Spec.Unschedulable,
+			Taints:           item.Spec.Taints,
+			KubeletVersion:   info.KubeletVersion,
+			OSImage:          info.OSImage,
+			KernelVersion:    info.KernelVersion,
+			ContainerRuntime: info.ContainerRuntimeVersion,
+		}
+		for label := range item.Metadata.Labels {
+			if strings.HasPrefix(label, "node-role.kubernetes.io/") {
+				n.Roles = append(n.Roles, strings.TrimPrefix(label, "node-role.kubernetes.io/"))
+			}
+		}
+		sort.Strings(n.Roles)
+		for _, cond := range item.Status.Conditions {
+			switch {
+			case cond.Type == "Ready":
+				n.Ready = cond.Status == "True"
+				if !n.Ready {
+					n.Problems = append(n.Problems, "NotReady: "+cond.Message)
+				}
+			case nodeProblems[cond.Type] && cond.Status == "True":
+				n.Problems = append(n.Problems, cond.Type+": "+cond.Message)
+			}
+		}
+		nodes = append(nodes, n)
+	}
+	return nodes
+}
+
 func (ko OCOutput) NodeCount() int {
 	resp := NodeResponse{}
 	json.Unmarshal(ko.RawOut, &resp)
@@ -158,6 +568,218 @@ func (ko OCOutput) NodeCount() int {
 	return count
 }
 
+// SchedulableNodes returns the names of the nodes that accept new pods, i.e.
+// ready nodes that are neither cordoned nor tainted
+func (ko OCOutput) SchedulableNodes() []string {
+	nodes := []string{}
+	for _, n := range ko.Nodes() {
+		if n.Schedulable() {
+			nodes = append(nodes, n.Name)
+		}
+	}
+	return nodes
+}
+
+// RouteIngress is the state of a route in one router
+type RouteIngress struct {
+	Host       string
+	RouterName string
+	// Admitted is set once the router serves the route, Rejected if it
+	// refused to, e.g. because another route claimed the host
+	Admitted bool
+	Rejected bool
+	Reason   string
+	Message  string
+}
+
+// RouteIngresses returns the state of the route in every router that
+// considered it
+func (ko OCOutput) RouteIngresses() []RouteIngress {
+	resp := RouteResponse{}
+	json.Unmarshal(ko.RawOut, &resp)
+	ingresses := []RouteIngress{}
+	for _, item := range resp.Status.Ingress {
+		ingress := RouteIngress{Host: item.Host, RouterName: item.RouterName}
+		for _, condition := range item.Conditions {
+			if condition.Type == "Admitted" {
+				ingress.Admitted = condition.Status == "True"
+				ingress.Rejected = condition.Status == "False"
+				ingress.Reason = condition.Reason
+				ingress.Message = condition.Message
+			}
+		}
+		ingresses = append(ingresses, ingress)
+	}
+	return ingresses
+}
+
+type RouteResponse struct {
+	Status struct {
+		Ingress []struct {
+			Host       string `json:"host"`
+			RouterName string `json:"routerName"`
+			Conditions []struct {
+				Type    string `json:"type"`
+				Status  string `json:"status"`
+				Reason  string `json:"reason"`
+				Message string `json:"message"`
+			} `json:"conditions"`
+		} `json:"ingress"`
+	} `json:"status"`
+}
+
+// ClaimPhase returns the phase of a persistent volume claim, e.g. Bound, and
+// the name of the volume bound to it
+func (ko OCOutput) ClaimPhase() (string, string) {
+	resp := ClaimResponse{}
+	json.Unmarshal(ko.RawOut, &resp)
+	return resp.Status.Phase, resp.Spec.VolumeName
+}
+
+type ClaimResponse struct {
+	Spec struct {
+		VolumeName string `json:"volumeName"`
+	} `json:"spec"`
+	Status struct {
+		Phase string `json:"phase"`
+	} `json:"status"`
+}
+
+// StorageClass is the name and provisioner of a StorageClass and whether
+// claims without a class are provisioned from it
+type StorageClass struct {
+	Name        string
+	Provisioner string
+	Default     bool
+}
+
+func (ko OCOutput) StorageClasses() []StorageClass {
+	resp := StorageClassesResponse{}
+	json.Unmarshal(ko.RawOut, &resp)
+	classes := []StorageClass{}
+	for _, item := range resp.Items {
+		annotations := item.Metadata.Annotations
+		classes = append(classes, StorageClass{
+			Name:        item.Metadata.Name,
+			Provisioner: item.Provisioner,
+			Default: annotations["storageclass.kubernetes.io/is-default-class"] == "true" ||
+				annotations["storageclass.beta.kubernetes.io/is-default-class"] == "true",
+		})
+	}
+	return classes
+}
+
+type StorageClassesResponse struct {
+	Items []struct {
+		Metadata struct {
+			Name        string            `json:"name"`
+			Annotations map[string]string `json:"annotations"`
+		} `json:"metadata"`
+		Provisioner string `json:"provisioner"`
+	} `json:"items"`
+}
+
+// BuildStatus is the progress of a build
+type BuildStatus struct {
+	// Phase is New, Pending or Running until the build is Complete,
+	// Failed, Error or Cancelled
+	Phase   string
+	Reason  string
+	Message string
+	// Duration is how long the build ran, PushDuration how long pushing
+	// the image took if the cluster reports build stages
+	Duration     time.Duration
+	PushDuration time.Duration
+	ImageDigest  string
+}
+
+// Done tells whether the build stopped, successfully or not
+func (s BuildStatus) Done() bool {
+	switch s.Phase {
+	case "Complete", "Failed", "Error", "Cancelled":
+		return true
+	}
+	return false
+}
+
+func (ko OCOutput) BuildStatus() BuildStatus {
+	resp := BuildResponse{}
+	json.Unmarshal(ko.RawOut, &resp)
+	status := BuildStatus{
+		Phase:       resp.Status.Phase,
+		Reason:      resp.Status.Reason,
+		Message:     resp.Status.Message,
+		Duration:    time.Duration(resp.Status.Duration),
+		ImageDigest: resp.Status.Output.To.ImageDigest,
+	}
+	for _, stage := range resp.Status.Stages {
+		if stage.Name == "PushImage" {
+			status.PushDuration = time.Duration(stage.DurationMilliseconds) * time.Millisecond
+		}
+	}
+	return status
+}
+
+type BuildResponse struct {
+	Status struct {
+		Phase    string `json:"phase"`
+		Reason   string `json:"reason"`
+		Message  string `json:"message"`
+		Duration int64  `json:"duration"`
+		Output   struct {
+			To struct {
+				ImageDigest string `json:"imageDigest"`
+			} `json:"to"`
+		} `json:"output"`
+		Stages []struct {
+			Name                 string `json:"name"`
+			DurationMilliseconds int64  `json:"durationMilliseconds"`
+		} `json:"stages"`
+	} `json:"status"`
+}
+
+// ImageStreamTag returns the repository of an image stream in the internal
+// registry and the image the tag points to, the most recent one first
+func (ko OCOutput) ImageStreamTag(tag string) (string, []string) {
+	resp := ImageStreamResponse{}
+	json.Unmarshal(ko.RawOut, &resp)
+	images := []string{}
+	for _, t := range resp.Status.Tags {
+		if t.Tag != tag {
+			continue
+		}
+		for _, item := range t.Items {
+			images = append(images, item.Image)
+		}
+	}
+	return resp.Status.DockerImageRepository, images
+}
+
+type ImageStreamResponse struct {
+	Status struct {
+		DockerImageRepository string `json:"dockerImageRepository"`
+		Tags                  []struct {
+			Tag   string `json:"tag"`
+			Items []struct {
+				Image string `json:"image"`
+			} `json:"items"`
+		} `json:"tags"`
+	} `json:"status"`
+}
+
+// SDNMode returns the mode of the OpenShift SDN plugin of the cluster
+// network, e.g. multitenant for redhat/openshift-ovs-multitenant, or the
+// name of any other plugin
+func (ko OCOutput) SDNMode() string {
+	resp := ClusterNetworkResponse{}
+	json.Unmarshal(ko.RawOut, &resp)
+	return strings.TrimPrefix(resp.PluginName, "redhat/openshift-ovs-")
+}
+
+type ClusterNetworkResponse struct {
+	PluginName string `json:"pluginName"`
+}
+
 func (ko OCOutput) NamespaceStatus() string {
 	resp := NamespaceResponse{}
 	json.Unmarshal(ko.RawOut, &resp)
@@ -169,3 +791,130 @@ type NamespaceResponse struct {
 		Phase string `json:"phase"`
 	} `json:"status"`
 }
+
+// EndpointURLs returns https://IP:PORT for every address of an Endpoints
+// object and its port called portName
+func (ko OCOutput) EndpointURLs(portName string) []string {
+	resp := EndpointsResponse{}
+	json.Unmarshal(ko.RawOut, &resp)
+	urls := []string{}
+	for _, subset := range resp.Subsets {
+		for _, port := range subset.Ports {
+			if port.Name != portName {
+				continue
+			}
+			for _, address := range subset.Addresses {
+				urls = append(urls, fmt.Sprintf("https://%s:%d", address.IP, port.Port))
+			}
+		}
+	}
+	return urls
+}
+
+type EndpointsResponse struct {
+	Subsets []struct {
+		Addresses []struct {
+			IP string `json:"ip"`
+		} `json:"addresses"`
+		Ports []struct {
+			Name string `json:"name"`
+			Port int    `json:"port"`
+		} `json:"ports"`
+	} `json:"subsets"`
+}
+
+// GitVersion returns the version served on /version, e.g. v1.11.0+d4cacc0
+func (ko OCOutput) GitVersion() string {
+	resp := struct {
+		GitVersion string `json:"gitVersion"`
+	}{}
+	json.Unmarshal(ko.RawOut, &resp)
+	return resp.GitVersion
+}
+
+// ComponentHealth is the health of a control plane component, from a
+// ClusterOperator or a ComponentStatus
+type ComponentHealth struct {
+	Name    string
+	Healthy bool
+	Version string
+	// Message tells why the component is not healthy
+	Message string
+}
+
+// ClusterOperators returns the health of every ClusterOperator, healthy
+// ones are available and not degraded
+func (ko OCOutput) ClusterOperators() []ComponentHealth {
+	resp := ComponentsResponse{}
+	json.Unmarshal(ko.RawOut, &resp)
+	components := []ComponentHealth{}
+	for _, item := range resp.Items {
+		c := ComponentHealth{Name: item.Metadata.Name}
+		available, degraded := false, false
+		for _, cond := range item.Status.Conditions {
+			switch {
+			case cond.Type == "Available" && cond.Status == "True":
+				available = true
+			case cond.Type == "Available":
+				c.Message = strings.TrimSpace(c.Message + " Not available: " + cond.Message)
+			case cond.Type == "Degraded" && cond.Status == "True":
+				degraded = true
+				c.Message = strings.TrimSpace(c.Message + " Degraded: " + cond.Message)
+			}
+		}
+		c.Healthy = available && !degraded
+		for _, version := range item.Status.Versions {
+			if version.Name == "operator" {
+				c.Version = version.Version
+			}
+		}
+		components = append(components, c)
+	}
+	return components
+}
+
+// ComponentStatuses returns the health of every ComponentStatus
+func (ko OCOutput) ComponentStatuses() []ComponentHealth {
+	resp := ComponentsResponse{}
+	json.Unmarshal(ko.RawOut, &resp)
+	components := []ComponentHealth{}
+	for _, item := range resp.Items {
+		c := ComponentHealth{Name: item.Metadata.Name}
+		for _, cond := range item.Conditions {
+			if cond.Type != "Healthy" {
+				continue
+			}
+			c.Healthy = cond.Status == "True"
+			if !c.Healthy {
+				c.Message = strings.TrimSpace(cond.Message + " " + cond.Error)
+			}
+		}
+		components = append(components, c)
+	}
+	return components
+}
+
+// ComponentsResponse holds ClusterOperators, which have their conditions
+// under status, or ComponentStatuses, which have them at the top level
+type ComponentsResponse struct {
+	Items []struct {
+		Metadata struct {
+			Name string `json:"name"`
+		} `json:"metadata"`
+		Conditions []ComponentCondition `json:"conditions"`
+		Status     struct {
+			Conditions []ComponentCondition `json:"conditions"`
+			Versions   []struct {
+				Name    string `json:"name"`
+				Version string `json:"version"`
+			} `json:"versions"`
+		} `json:"status"`
+	} `json:"items"`
+}
+
+type ComponentCondition struct {
+	Type    string `json:"type"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	Error   string `json:"error"`
+}
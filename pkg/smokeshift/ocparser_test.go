@@ -1,6 +1,9 @@
 package smokeshift
 
-import "testing"
+import (
+	"reflect"
+	"testing"
+)
 
 func TestNodeCount(t *testing.T) {
 
@@ -14,6 +17,137 @@ func TestNodeCount(t *testing.T) {
 	}
 }
 
+func TestSchedulableNodes(t *testing.T) {
+	ko := OCOutput{Success: true, RawOut: []byte(SampleNodeConditionsResponse)}
+	if nodes := ko.SchedulableNodes(); !reflect.DeepEqual(nodes, []string{"node2", "node4"}) {
+		t.Errorf("Expected node2 and node4, got %v", nodes)
+	}
+	// Every node of the older sample is NotReady
+	ko = OCOutput{Success: true, RawOut: []byte(SampleNodeRespones)}
+	if nodes := ko.SchedulableNodes(); len(nodes) != 0 {
+		t.Errorf("Expected no schedulable node, got %v", nodes)
+	}
+}
+
+func TestNodes(t *testing.T) {
+	ko := OCOutput{Success: true, RawOut: []byte(SampleNodeConditionsResponse)}
+	nodes := ko.Nodes()
+	if len(nodes) != 5 {
+		t.Fatalf("Expected 5 nodes, got %+v", nodes)
+	}
+	master := nodes[0]
+	if !reflect.DeepEqual(master.Roles, []string{"infra", "master"}) || len(master.Taints) != 1 || master.Taints[0].String() != "node-role.kubernetes.io/master:NoSchedule" {
+		t.Errorf("Expected a tainted master and infra node, got %+v", master)
+	}
+	if master.KubeletVersion != "v1.11.0+d4cacc0" || master.OSImage != "Red Hat Enterprise Linux Server 7.6 (Maipo)" || master.ContainerRuntime != "docker://1.13.1" {
+		t.Errorf("Expected the node info to be parsed, got %+v", master)
+	}
+	if n := nodes[2]; n.Ready || !reflect.DeepEqual(n.Problems, []string{"NotReady: Kubelet stopped posting node status."}) {
+		t.Errorf("Expected node3 to be NotReady, got %+v", n)
+	}
+	if n := nodes[3]; !n.Ready || !reflect.DeepEqual(n.Problems, []string{"DiskPressure: kubelet has disk pressure"}) || !n.Schedulable() {
+		t.Errorf("Expected node4 to be ready under disk pressure, got %+v", n)
+	}
+	if n := nodes[4]; !n.Unschedulable || n.Schedulable() || len(n.Problems) != 0 {
+		t.Errorf("Expected node5 to be healthy and cordoned, got %+v", n)
+	}
+}
+
+const SampleNodeConditionsResponse = `{"items": [
+	{"metadata": {"name": "node1", "labels": {"node-role.kubernetes.io/master": "true", "node-role.kubernetes.io/infra": "true"}},
+	 "spec": {"taints": [{"key": "node-role.kubernetes.io/master", "effect": "NoSchedule"}]},
+	 "status": {"conditions": [{"type": "Ready", "status": "True"}, {"type": "MemoryPressure", "status": "False"}],
+	  "nodeInfo": {"kubeletVersion": "v1.11.0+d4cacc0", "osImage": "Red Hat Enterprise Linux Server 7.6 (Maipo)", "containerRuntimeVersion": "docker://1.13.1"}}},
+	{"metadata": {"name": "node2", "labels": {"node-role.kubernetes.io/compute": "true"}},
+	 "status": {"conditions": [{"type": "Ready", "status": "True"}]}},
+	{"metadata": {"name": "node3", "labels": {"node-role.kubernetes.io/compute": "true"}},
+	 "status": {"conditions": [{"type": "Ready", "status": "Unknown", "message": "Kubelet stopped posting node status."}]}},
+	{"metadata": {"name": "node4", "labels": {"node-role.kubernetes.io/compute": "true"}},
+	 "status": {"conditions": [{"type": "Ready", "status": "True"}, {"type": "DiskPressure", "status": "True", "message": "kubelet has disk pressure"}]}},
+	{"metadata": {"name": "node5"}, "spec": {"unschedulable": true},
+	 "status": {"conditions": [{"type": "Ready", "status": "True"}]}}
+]}`
+
+func TestPods(t *testing.T) {
+	ko := OCOutput{Success: true, RawOut: []byte(`{"items": [
+		{"metadata": {"name": "a"}, "spec": {"nodeName": "node2"}, "status": {"podIP": "10.1.0.2", "conditions": [{"type": "Ready", "status": "True"}]}},
+		{"metadata": {"name": "b"}, "spec": {"nodeName": "node3"}, "status": {"conditions": [{"type": "Ready", "status": "False"}]}}
+	]}`)}
+	expected := []Pod{{Name: "a", IP: "10.1.0.2", Node: "node2", Ready: true}, {Name: "b", Node: "node3"}}
+	if pods := ko.Pods(); !reflect.DeepEqual(pods, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, pods)
+	}
+	if pods := (OCOutput{TimedOut: true}).Pods(); pods != nil {
+		t.Errorf("Expected no pods from a call that timed out, got %+v", pods)
+	}
+	if ips, name := ko.PodIPs(), ko.FirstPodName(); !reflect.DeepEqual(ips, []string{"10.1.0.2", ""}) || name != "a" {
+		t.Errorf("Expected the pod IPs and first pod name, got %v and %q", ips, name)
+	}
+	unparsable := OCOutput{CombinedOut: "error: timed out\n", RawOut: []byte("error: timed out\n")}
+	if ips, name := unparsable.PodIPs(), unparsable.FirstPodName(); ips != nil || name != "" {
+		t.Errorf("Expected no pod IPs or name from unparsable output, got %v and %q", ips, name)
+	}
+}
+
+func TestPodStates(t *testing.T) {
+	ko := OCOutput{Success: true, RawOut: []byte(fakeStuckPods)}
+	expected := []PodState{
+		{Pod: Pod{Name: "smokeshift-nginx-abcde", Node: "node1"}, Phase: "Pending",
+			Problems: []string{`container smokeshift-nginx waiting: ImagePullBackOff: Back-off pulling image "nginx:stable-alpine"`}},
+		{Pod: Pod{Name: "smokeshift-nginx-fghij", Node: "node2"}, Phase: "Running",
+			Problems: []string{"container smokeshift-nginx waiting: CrashLoopBackOff", "container smokeshift-nginx restarted 4 times, last exit: Error (exit code 1)"},
+			Logged:   []string{"smokeshift-nginx"}, Restarted: []string{"smokeshift-nginx"}},
+		{Pod: Pod{Name: "smokeshift-nginx-klmno"}, Phase: "Pending",
+			Problems: []string{"not scheduled: Unschedulable: 0/3 nodes are available: 3 Insufficient memory."}},
+	}
+	if states := ko.PodStates(); !reflect.DeepEqual(states, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, states)
+	}
+}
+
+func TestEvents(t *testing.T) {
+	events := OCOutput{Success: true, RawOut: []byte(fakeStuckEvents)}.Events()
+	reasons := []string{}
+	for _, e := range events {
+		reasons = append(reasons, e.Reason)
+	}
+	if expected := []string{"Scheduled", "FailedScheduling", "Failed"}; !reflect.DeepEqual(reasons, expected) {
+		t.Errorf("Expected events from the oldest, %v, got %v", expected, reasons)
+	}
+	if e := events[2]; e.Object != "pod/smokeshift-nginx-abcde" || e.Count != 3 || e.Message != "Failed to pull image" {
+		t.Errorf("Unexpected event %+v", e)
+	}
+}
+
+func TestObjectStatuses(t *testing.T) {
+	objects := OCOutput{Success: true, RawOut: []byte(fakeStuckPods)}.ObjectStatuses()
+	if len(objects) != 3 {
+		t.Fatalf("Expected every pod, got %+v", objects)
+	}
+	expected := ObjectStatus{Name: "smokeshift-nginx-klmno", Phase: "Pending", Conditions: []string{"PodScheduled=False (Unschedulable: 0/3 nodes are available: 3 Insufficient memory.)"}}
+	if !reflect.DeepEqual(objects[2], expected) {
+		t.Errorf("Expected %+v, got %+v", expected, objects[2])
+	}
+	for kind, expected := range map[string]string{"pods": "pod", "endpoints": "endpoints", "networkpolicies": "networkpolicy"} {
+		if got := objectKind(kind); got != expected {
+			t.Errorf("Expected events to name %s %q, got %q", kind, expected, got)
+		}
+	}
+}
+
+func TestDaemonSetReady(t *testing.T) {
+	tests := map[string]bool{
+		`{"status": {"desiredNumberScheduled": 3, "numberReady": 3}}`: true,
+		`{"status": {"desiredNumberScheduled": 3, "numberReady": 2}}`: false,
+		`{"status": {}}`: false,
+	}
+	for response, expected := range tests {
+		if ready := (OCOutput{RawOut: []byte(response)}).DaemonSetReady(); ready != expected {
+			t.Errorf("Expected ready=%v for %s", expected, response)
+		}
+	}
+}
+
 const SampleNodeRespones = `
 {
     "kind": "List",
@@ -457,7 +591,7 @@ func TestNamespaceStatus(t *testing.T) {
     }
 
     if namespaceStatus := ko.NamespaceStatus(); namespaceStatus != "Active" {
-        t.Errorf("Wrong namespace status, expeted `Active`, got %d", namespaceStatus)
+        t.Errorf("Wrong namespace status, expeted `Active`, got %s", namespaceStatus)
     }
 }
 
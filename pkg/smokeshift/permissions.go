@@ -0,0 +1,156 @@
+package smokeshift
+
+import (
+	"context"
+	"strings"
+
+	"github.com/opencredo/smokeshift/pkg/config"
+	"github.com/opencredo/smokeshift/pkg/report"
+	"github.com/opencredo/smokeshift/pkg/util"
+)
+
+// Permission is an action the run must be allowed to perform, reviewed with
+// oc auth can-i before anything is created
+type Permission struct {
+	Verb string
+	// Resource is e.g. "pods", "pods/exec" for a subresource or
+	// "daemonsets.apps" with its API group
+	Resource string
+	// Cluster permissions are reviewed cluster-wide, the others in the
+	// project
+	Cluster bool
+	// Namespace is set for permissions needed in another namespace than the
+	// project, e.g. "default"
+	Namespace string
+}
+
+// namespace is where the permission is reviewed, "" for cluster-wide
+func (p Permission) namespace() string {
+	switch {
+	case p.Cluster:
+		return ""
+	case p.Namespace != "":
+		return p.Namespace
+	}
+	return config.Namespace
+}
+
+func (p Permission) scope() string {
+	if p.Cluster {
+		return "cluster"
+	}
+	return p.namespace()
+}
+
+// PermissionNeeder is implemented by checks that need permissions beyond
+// those of the test workloads
+type PermissionNeeder interface {
+	// Permissions are what the check needs as configured
+	Permissions() []Permission
+}
+
+// workloadPermissions are needed to create, inspect and clean up the test
+// workloads whatever the checks
+func workloadPermissions() []Permission {
+	permissions := []Permission{
+		{Verb: "create", Resource: "projectrequests", Cluster: true},
+		{Verb: "delete", Resource: "projects"},
+		{Verb: "create", Resource: "deploymentconfigs"},
+		{Verb: "create", Resource: "daemonsets.apps"},
+		{Verb: "create", Resource: "services"},
+		{Verb: "list", Resource: "pods"},
+		{Verb: "create", Resource: "pods/exec"},
+	}
+	if !config.Restricted {
+		permissions = append(permissions,
+			Permission{Verb: "update", Resource: "securitycontextconstraints", Cluster: true},
+			Permission{Verb: "list", Resource: "nodes", Cluster: true},
+		)
+	}
+	return permissions
+}
+
+// neededPermission is a permission with what needs it
+type neededPermission struct {
+	Permission
+	neededBy []string
+	required bool
+}
+
+// neededPermissions returns the permissions of the workloads and of every
+// check that will run, checks skipped in restricted mode need none
+func neededPermissions(registry *Registry) []*neededPermission {
+	needed := []*neededPermission{}
+	byPermission := map[Permission]*neededPermission{}
+	add := func(p Permission, by string, required bool) {
+		n, ok := byPermission[p]
+		if !ok {
+			n = &neededPermission{Permission: p}
+			byPermission[p] = n
+			needed = append(needed, n)
+		}
+		n.neededBy = append(n.neededBy, by)
+		n.required = n.required || required
+	}
+	for _, p := range workloadPermissions() {
+		add(p, "setup", true)
+	}
+	for _, c := range registry.Checks() {
+		if scoped, ok := c.(ClusterScoped); ok && config.Restricted && len(scoped.ClusterAccess()) > 0 {
+			continue
+		}
+		if needer, ok := c.(PermissionNeeder); ok {
+			for _, p := range needer.Permissions() {
+				add(p, c.Name(), c.Severity() == Required)
+			}
+		}
+	}
+	return needed
+}
+
+// preflightPermissions reviews every permission the run needs and prints
+// those missing. Project permissions are only reviewed if the project
+// exists, a new project makes its requester admin. Permissions in other
+// namespaces are always reviewed. The run cannot go on if
+// the setup or a required check is missing one.
+func preflightPermissions(ctx context.Context, env *Environment, rec *recorder, registry *Registry) bool {
+	s := rec.start(report.PhasePrecondition, "User has the permissions the selected checks need")
+	projectExists := env.RunGetProject(ctx, config.Namespace).Success
+	missing := []report.MissingPermission{}
+	required := false
+	for _, n := range neededPermissions(registry) {
+		if n.namespace() == config.Namespace && !projectExists {
+			continue
+		}
+		ko := env.RunCanI(ctx, n.Verb, n.Resource, n.namespace())
+		if ko.Success {
+			continue
+		}
+		if !strings.HasPrefix(strings.TrimSpace(ko.CombinedOut), "no") {
+			// Reviews are not supported by every oc and server, the run
+			// goes on and fails where permissions are missing
+			s.ignored("Could not review permissions\n"+ko.CombinedOut, ko.TimedOut)
+			return true
+		}
+		missing = append(missing, report.MissingPermission{Verb: n.Verb, Resource: n.Resource, Scope: n.scope(), NeededBy: n.neededBy})
+		required = required || n.required
+	}
+	rec.report.MissingPermissions = missing
+	if len(missing) == 0 {
+		s.ok()
+		return true
+	}
+
+	rows := [][]string{}
+	for _, m := range missing {
+		rows = append(rows, []string{m.Verb, m.Resource, m.Scope, strings.Join(m.NeededBy, ", ")})
+	}
+	rec.info("Missing permissions")
+	util.PrintTable(rec.out, []string{"verb", "resource", "scope", "needed by"}, rows)
+	if required {
+		s.errored("The setup or required checks are missing permissions, use --skip or --restricted to leave out what needs them\n")
+		return false
+	}
+	s.ignored("Advisory checks are missing permissions\n", false)
+	return true
+}
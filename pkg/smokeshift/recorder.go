@@ -0,0 +1,129 @@
+package smokeshift
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/opencredo/smokeshift/pkg/report"
+	"github.com/opencredo/smokeshift/pkg/util"
+)
+
+// recorder prints the outcome of every step as it happens and keeps it
+// in the report of the run
+type recorder struct {
+	out    io.Writer
+	report *report.Report
+}
+
+// step is a single timed entry of the report
+type step struct {
+	rec    *recorder
+	phase  report.Phase
+	name   string
+	check  string
+	start  time.Time
+	target *report.Target
+	source *report.Target
+	info   map[string]string
+}
+
+func (r *recorder) start(phase report.Phase, name string) *step {
+	return &step{rec: r, phase: phase, name: name, start: time.Now()}
+}
+
+func (r *recorder) info(msg string) {
+	util.PrettyPrintInfo(r.out, msg)
+}
+
+// result records the outcome of a check, failures of advisory checks are
+// reported as ignored
+func (r *recorder) result(c Check, result Result) {
+	s := &step{rec: r, phase: report.PhaseCheck, name: result.Name, check: c.Name(), start: time.Now().Add(-result.Duration), target: result.Target, source: result.Source, info: result.Info}
+	switch {
+	case result.Passed:
+		s.ok()
+	case c.Severity() == Advisory:
+		s.ignored(result.Detail, result.TimedOut)
+	case result.TimedOut:
+		s.finish(report.Timeout, result.Detail)
+	default:
+		s.errored(result.Detail)
+	}
+}
+
+// on records what the step is run against
+func (s *step) on(target report.Target) *step {
+	s.target = &target
+	return s
+}
+
+func (s *step) ok() {
+	s.finish(report.OK, "")
+}
+
+// failed finishes the step with the output of the oc call that failed it,
+// calls stopped by a timeout are reported as [TIMEOUT] instead of [ERROR]
+func (s *step) failed(ko OCOutput) {
+	if ko.TimedOut {
+		s.finish(report.Timeout, ko.CombinedOut)
+	} else {
+		s.finish(report.Error, ko.CombinedOut)
+	}
+}
+
+// errored finishes the step as failed with a free form detail
+func (s *step) errored(detail string) {
+	s.finish(report.Error, detail)
+}
+
+// ignored finishes an advisory step that did not pass
+func (s *step) ignored(detail string, timedOut bool) {
+	if timedOut {
+		s.finish(report.TimeoutIgnored, detail)
+	} else {
+		s.finish(report.ErrorIgnored, detail)
+	}
+}
+
+func (s *step) skipped(reason string) {
+	s.finish(report.Skipped, reason)
+}
+
+func (s *step) finish(status report.Status, detail string) {
+	s.rec.report.Add(report.CheckResult{
+		Name:     s.name,
+		Check:    s.check,
+		Phase:    s.phase,
+		Status:   status,
+		Duration: report.Duration(time.Since(s.start)),
+		Detail:   detail,
+		Target:   s.target,
+		Source:   s.source,
+		Info:     s.info,
+	})
+	out := s.rec.out
+	switch status {
+	case report.OK:
+		util.PrettyPrintOk(out, s.name)
+	case report.Error:
+		util.PrettyPrintErr(out, s.name)
+		printFailureDetail(out, detail)
+	case report.Timeout:
+		util.PrettyPrintTimeout(out, s.name)
+		printFailureDetail(out, detail)
+	case report.ErrorIgnored:
+		util.PrettyPrintErrorIgnored(out, s.name)
+	case report.TimeoutIgnored:
+		util.PrettyPrintTimeoutIgnored(out, s.name)
+	case report.Skipped:
+		util.PrettyPrintSkipped(out, s.name)
+	}
+	printInfo(out, s.info)
+}
+
+func printInfo(out io.Writer, info map[string]string) {
+	for _, key := range (report.CheckResult{Info: info}).InfoKeys() {
+		fmt.Fprintf(out, "    %s: %s\n", key, info[key])
+	}
+}
@@ -1,15 +1,34 @@
 package smokeshift
 
-import "time"
+import (
+	"context"
+	"time"
+)
 
-func retry(times int, f func() bool) bool {
+// retryInterval is the pause between attempts
+var retryInterval = 1 * time.Second
+
+// retry calls f until it succeeds, it has been called times times or ctx is done
+func retry(ctx context.Context, times int, f func() bool) bool {
 	attempt := 0
 	for attempt < times {
 		if ok := f(); ok {
 			return true
 		}
-		time.Sleep(1 * time.Second)
+		if !sleep(ctx, retryInterval) {
+			return false
+		}
 		attempt++
 	}
 	return false
 }
+
+// sleep pauses for d, returning false if ctx is done first
+func sleep(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
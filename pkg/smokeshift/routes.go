@@ -0,0 +1,113 @@
+package smokeshift
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// The route checks expose the Nginx service through the routers, the way
+// users reach applications, and fetch it from this machine.
+func init() {
+	Register(routeAdmissionCheck{})
+	Register(routeHTTPCheck{})
+}
+
+const routeAdmissionTimeout = 60 * time.Second
+
+// Route is a route admitted by a router
+type Route struct {
+	Name string
+	Host string
+	// Router is the name of the router, i.e. the shard, that admitted it
+	Router        string
+	AdmissionTime time.Duration
+}
+
+// 1. Create a route for the nginx service and wait until a router serves it
+type routeAdmissionCheck struct{}
+
+func (routeAdmissionCheck) Name() string { return "route-admission" }
+func (routeAdmissionCheck) Description() string {
+	return "Create a route for the Nginx service and wait for a router to admit it"
+}
+func (routeAdmissionCheck) Severity() Severity     { return Required }
+func (routeAdmissionCheck) Tags() []string         { return []string{"router"} }
+func (routeAdmissionCheck) Dependencies() []string { return nil }
+func (routeAdmissionCheck) Permissions() []Permission {
+	return []Permission{{Verb: "create", Resource: "routes"}}
+}
+
+// Run sets env.Route once the route is admitted
+func (routeAdmissionCheck) Run(ctx context.Context, env *Environment) []Result {
+	name := env.ServiceName
+	return []Result{timed(func() Result {
+		r, result := admitRoute(ctx, env, "Route "+name+" admitted by a router", name, route(name, env.ServiceName, nginxPort(), nil))
+		if result.Passed {
+			env.Route = r
+		}
+		return result
+	})}
+}
+
+// admitRoute creates the route called routeName described by obj and waits
+// until a router admits it
+func admitRoute(ctx context.Context, env *Environment, name, routeName string, obj interface{}) (*Route, Result) {
+	start := time.Now()
+	if ko := env.RunCreate(ctx, obj); !ko.Success {
+		return nil, ocResult(name, nil, ko)
+	}
+	for time.Since(start) < routeAdmissionTimeout {
+		ko := env.RunOCinNamespace(ctx, "get", "route", routeName, "-o", "json")
+		if !ko.Success {
+			return nil, ocResult(name, nil, ko)
+		}
+		for _, ingress := range ko.RouteIngresses() {
+			if ingress.Admitted {
+				r := &Route{Name: routeName, Host: ingress.Host, Router: ingress.RouterName, AdmissionTime: time.Since(start)}
+				return r, Result{Name: name, Passed: true, Info: map[string]string{
+					"host":           r.Host,
+					"router":         r.Router,
+					"admission time": r.AdmissionTime.String(),
+				}}
+			}
+			if ingress.Rejected {
+				return nil, Result{Name: name, Detail: fmt.Sprintf("Router %s rejected the route: %s %s\n", ingress.RouterName, ingress.Reason, ingress.Message)}
+			}
+		}
+		if !sleep(ctx, retryInterval) {
+			return nil, Result{Name: name, TimedOut: true, Detail: "Run timed out while waiting for the route to be admitted\n"}
+		}
+	}
+	return nil, Result{Name: name, Detail: fmt.Sprintf("Route not admitted by any router after %s\n", routeAdmissionTimeout)}
+}
+
+// 2. Fetch the route from this machine
+type routeHTTPCheck struct{}
+
+func (routeHTTPCheck) Name() string { return "route-http" }
+func (routeHTTPCheck) Description() string {
+	return "Access the Nginx route over HTTP from this machine"
+}
+func (routeHTTPCheck) Severity() Severity     { return Advisory }
+func (routeHTTPCheck) Tags() []string         { return []string{"router", "local"} }
+func (routeHTTPCheck) Dependencies() []string { return []string{"route-admission"} }
+
+func (routeHTTPCheck) Run(ctx context.Context, env *Environment) []Result {
+	if env.Route == nil {
+		return []Result{{Name: "Accessed Nginx route from this node", Detail: "No admitted route\n"}}
+	}
+	return []Result{timed(func() Result {
+		name := "Accessed Nginx route at " + env.Route.Host + " from this node"
+		status, err := httpStatus(ctx, env.HTTPClient, "http://"+env.Route.Host+"/")
+		if err != nil {
+			return probeResult(name, nil, err)
+		}
+		r := Result{Name: name, Passed: strings.HasPrefix(status, "2"), Info: map[string]string{"status": status}}
+		if !r.Passed {
+			r.Detail = "Unexpected response status " + status + "\n"
+		}
+		return r
+	})}
+}
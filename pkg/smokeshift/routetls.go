@@ -0,0 +1,265 @@
+package smokeshift
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/opencredo/smokeshift/pkg/config"
+)
+
+// The TLS route checks fetch the Nginx welcome page through an edge, a
+// passthrough and a re-encrypt route. Passthrough and re-encrypt routes need
+// a backend serving TLS itself, a single nginx pod with a certificate signed
+// by smokeshift is deployed for them.
+func init() {
+	Register(routeTLSCheck{})
+}
+
+const tlsBackendName = runPrefix + "nginx-tls"
+
+type routeTLSCheck struct{}
+
+func (routeTLSCheck) Name() string { return "route-tls" }
+func (routeTLSCheck) Description() string {
+	return "Access edge, passthrough and re-encrypt routes over HTTPS from this machine and verify their certificates"
+}
+func (routeTLSCheck) Severity() Severity     { return Advisory }
+func (routeTLSCheck) Tags() []string         { return []string{"router", "tls", "local"} }
+func (routeTLSCheck) Dependencies() []string { return []string{"route-admission"} }
+func (routeTLSCheck) Permissions() []Permission {
+	return []Permission{
+		{Verb: "create", Resource: "routes"},
+		{Verb: "create", Resource: "secrets"},
+		{Verb: "create", Resource: "configmaps"},
+	}
+}
+
+func (routeTLSCheck) Run(ctx context.Context, env *Environment) []Result {
+	routerRoots, err := routerCAPool()
+	if err != nil {
+		return []Result{{Name: "Loaded router CA bundle", Detail: err.Error() + "\n"}}
+	}
+
+	results := []Result{}
+	results = append(results, timed(func() Result {
+		return tlsRoute(ctx, env, "edge", route(env.ServiceName+"-edge", env.ServiceName, nginxPort(), map[string]interface{}{"termination": "edge"}), routerRoots, true)
+	}))
+
+	var backendCA []byte
+	backend := timed(func() Result {
+		var r Result
+		backendCA, r = deployTLSBackend(ctx, env)
+		return r
+	})
+	results = append(results, backend)
+	if !backend.Passed {
+		return results
+	}
+	backendRoots := x509.NewCertPool()
+	backendRoots.AppendCertsFromPEM(backendCA)
+
+	// The pod's own certificate is served, it does not name the route host
+	results = append(results, timed(func() Result {
+		return tlsRoute(ctx, env, "passthrough", route(tlsBackendName+"-passthrough", tlsBackendName, 8443, map[string]interface{}{"termination": "passthrough"}), backendRoots, false)
+	}))
+	results = append(results, timed(func() Result {
+		reencrypt := map[string]interface{}{"termination": "reencrypt", "destinationCACertificate": string(backendCA)}
+		return tlsRoute(ctx, env, "re-encrypt", route(tlsBackendName+"-reencrypt", tlsBackendName, 8443, reencrypt), routerRoots, true)
+	}))
+	return results
+}
+
+// tlsRoute creates the route, waits for its admission and fetches it over
+// HTTPS, verifying the certificate served against roots
+func tlsRoute(ctx context.Context, env *Environment, termination string, obj map[string]interface{}, roots *x509.CertPool, verifyHost bool) Result {
+	routeName := obj["metadata"].(map[string]interface{})["name"].(string)
+	r, result := admitRoute(ctx, env, "Route "+routeName+" ("+termination+") admitted by a router", routeName, obj)
+	if !result.Passed {
+		return result
+	}
+
+	name := "Accessed " + termination + " route at " + r.Host + " over HTTPS from this node"
+	info := map[string]string{"termination": termination, "router": r.Router, "admission time": r.AdmissionTime.String()}
+	status, certs, err := httpsGet(ctx, env.HTTPClient.Timeout, "https://"+r.Host+"/")
+	if err != nil {
+		result := probeResult(name, nil, err)
+		result.Info = info
+		return result
+	}
+	info["status"] = status
+	leaf := certs[0]
+	info["subject"] = formatName(leaf.Subject)
+	info["issuer"] = formatName(leaf.Issuer)
+	info["expires"] = leaf.NotAfter.UTC().Format(time.RFC3339)
+
+	host := ""
+	if verifyHost {
+		host = strings.Split(r.Host, ":")[0]
+	}
+	problems := []string{}
+	if err := verifyChain(certs, roots, host); err != nil {
+		info["chain"] = err.Error()
+		problems = append(problems, "Certificate chain does not verify: "+err.Error())
+	} else {
+		info["chain"] = "valid"
+	}
+	if !strings.HasPrefix(status, "2") {
+		problems = append(problems, "Unexpected response status "+status)
+	}
+	result = Result{Name: name, Passed: len(problems) == 0, Info: info}
+	if !result.Passed {
+		result.Detail = strings.Join(problems, "\n") + "\n"
+	}
+	return result
+}
+
+// deployTLSBackend deploys nginx serving HTTPS behind the tlsBackendName
+// service with a new certificate and returns the PEM of the certificate
+// once the pod is available
+func deployTLSBackend(ctx context.Context, env *Environment) ([]byte, Result) {
+	name := "Deployed Nginx serving HTTPS for passthrough and re-encrypt routes"
+	cert, key, err := selfSignedCert(tlsBackendName, []string{
+		tlsBackendName,
+		tlsBackendName + "." + config.Namespace + ".svc",
+		tlsBackendName + "." + config.Namespace + ".svc.cluster.local",
+	})
+	if err != nil {
+		return nil, Result{Name: name, Detail: err.Error() + "\n"}
+	}
+	ko := env.RunCreate(ctx,
+		tlsSecret(tlsBackendName, cert, key),
+		configMap(tlsBackendName, map[string]string{"default.conf": tlsNginxConf}),
+		tlsNginxDeploymentConfig(tlsBackendName, nginxImage()),
+		service(tlsBackendName, tlsBackendName, 8443, 8443),
+	)
+	if !ko.Success {
+		return nil, ocResult(name, nil, ko)
+	}
+	start := time.Now()
+	for time.Since(start) < deploymentTimeout {
+		if ko := env.RunGetDeployment(ctx, tlsBackendName); ko.Success && ko.ObservedReplicaCount() == 1 {
+			return cert, Result{Name: name, Passed: true}
+		}
+		if !sleep(ctx, retryInterval) {
+			return nil, Result{Name: name, TimedOut: true, Detail: "Run timed out while waiting for the deployment\n"}
+		}
+	}
+	return nil, Result{Name: name, Detail: fmt.Sprintf("Deployment not available after %s\n", deploymentTimeout)}
+}
+
+// routerCAPool loads --router-ca, nil means the system roots
+func routerCAPool() (*x509.CertPool, error) {
+	if config.RouterCA == "" {
+		return nil, nil
+	}
+	data, err := ioutil.ReadFile(config.RouterCA)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in %s", config.RouterCA)
+	}
+	return pool, nil
+}
+
+// httpsGet fetches url accepting any certificate and returns the response
+// status and the certificates the server presented
+func httpsGet(ctx context.Context, timeout time.Duration, url string) (string, []*x509.Certificate, error) {
+	client := &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+	}
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return "", nil, err
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", nil, err
+	}
+	resp.Body.Close()
+	if resp.TLS == nil || len(resp.TLS.PeerCertificates) == 0 {
+		return "", nil, errors.New("no certificate presented")
+	}
+	return resp.Status, resp.TLS.PeerCertificates, nil
+}
+
+// verifyChain verifies the certificates presented by a server against
+// roots, host is not verified if empty
+func verifyChain(certs []*x509.Certificate, roots *x509.CertPool, host string) error {
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := certs[0].Verify(x509.VerifyOptions{
+		DNSName:       host,
+		Roots:         roots,
+		Intermediates: intermediates,
+	})
+	return err
+}
+
+// formatName prints the common name and organization of a certificate
+// subject or issuer
+func formatName(name pkix.Name) string {
+	parts := []string{}
+	if name.CommonName != "" {
+		parts = append(parts, "CN="+name.CommonName)
+	}
+	for _, o := range name.Organization {
+		parts = append(parts, "O="+o)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// selfSignedCert creates a certificate for hosts that signs itself, so it
+// can serve as its own CA, and returns it and its key PEM encoded
+func selfSignedCert(commonName string, hosts []string) ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: commonName, Organization: []string{"smokeshift"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		DNSNames:              hosts,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM, nil
+}
@@ -0,0 +1,255 @@
+package smokeshift
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/opencredo/smokeshift/pkg/config"
+)
+
+// The storage check provisions a persistent volume claim, mounts it in a pod
+// and writes to it, the way stateful applications use dynamic storage.
+func init() {
+	Register(storageCheck{})
+}
+
+const (
+	claimPrefix    = runPrefix + "data"
+	claimSize      = "1Gi"
+	storageTimeout = 180 * time.Second
+	payloadPath    = "/data/smokeshift"
+)
+
+type storageCheck struct{}
+
+func (storageCheck) Name() string { return "storage" }
+func (storageCheck) Description() string {
+	return "Provision a persistent volume claim, mount it in a pod and write and read back a payload"
+}
+func (storageCheck) Severity() Severity     { return Advisory }
+func (storageCheck) Tags() []string         { return []string{"storage"} }
+func (storageCheck) Dependencies() []string { return nil }
+
+// ClusterAccess is needed to list the StorageClasses with --storage-class all
+func (storageCheck) ClusterAccess() []string {
+	for _, class := range config.StorageClasses {
+		if class == "all" {
+			return []string{"list StorageClasses"}
+		}
+	}
+	return nil
+}
+
+func (storageCheck) Permissions() []Permission {
+	permissions := []Permission{
+		{Verb: "create", Resource: "persistentvolumeclaims"},
+		{Verb: "create", Resource: "pods"},
+	}
+	if len((storageCheck{}).ClusterAccess()) > 0 {
+		permissions = append(permissions, Permission{Verb: "list", Resource: "storageclasses.storage.k8s.io", Cluster: true})
+	}
+	return permissions
+}
+
+func (storageCheck) Run(ctx context.Context, env *Environment) []Result {
+	var classes []string
+	selected := timed(func() Result {
+		var r Result
+		classes, r = storageClasses(ctx, env)
+		return r
+	})
+	if !selected.Passed {
+		return []Result{selected}
+	}
+	results := []Result{}
+	for _, class := range classes {
+		results = append(results, claimResults(ctx, env, class)...)
+	}
+	return results
+}
+
+// storageClasses returns the StorageClasses selected by --storage-class, an
+// empty name standing for the default StorageClass
+func storageClasses(ctx context.Context, env *Environment) ([]string, Result) {
+	name := "Found StorageClasses to provision claims from"
+	all := false
+	for _, class := range config.StorageClasses {
+		all = all || class == "all"
+	}
+	if len(config.StorageClasses) > 0 && !all {
+		return config.StorageClasses, Result{Name: name, Passed: true}
+	}
+	if config.Restricted {
+		// StorageClasses cannot be listed, the default one is tried
+		return []string{""}, Result{Name: name, Passed: true}
+	}
+
+	ko := env.RunOC(ctx, "get", "storageclass", "-o", "json")
+	if !ko.Success {
+		if all {
+			return nil, ocResult(name, nil, ko)
+		}
+		// The default StorageClass may still be usable without access to
+		// the StorageClasses
+		return []string{""}, Result{Name: name, Passed: true}
+	}
+	classes := []string{}
+	for _, class := range ko.StorageClasses() {
+		if all {
+			classes = append(classes, class.Name)
+		} else if class.Default {
+			classes = []string{""}
+		}
+	}
+	if len(classes) == 0 {
+		if all {
+			return nil, Result{Name: name, Detail: "No StorageClass defined\n"}
+		}
+		return nil, Result{Name: name, Detail: "No default StorageClass, use --storage-class to pick one\n"}
+	}
+	return classes, Result{Name: name, Passed: true}
+}
+
+// claimResults provisions a claim of the StorageClass, mounts it and writes
+// to it, then deletes it whatever the outcome unless cleanup is skipped
+func claimResults(ctx context.Context, env *Environment, class string) []Result {
+	claimName := claimPrefix
+	info := map[string]string{"storage class": class}
+	if class == "" {
+		info["storage class"] = "default"
+	} else {
+		claimName += "-" + class
+	}
+	c := &storageClaim{name: claimName, class: class, payload: fmt.Sprintf("%s%d", runPrefix, time.Now().UnixNano())}
+	results := c.use(ctx, env, info)
+	if env.SkipCleanup {
+		return results
+	}
+	return append(results, timed(func() Result { return c.delete(ctx, env) }))
+}
+
+type storageClaim struct {
+	name    string
+	class   string
+	payload string
+	pods    []string
+}
+
+// use runs every step on the claim up to the first failure
+func (c *storageClaim) use(ctx context.Context, env *Environment, info map[string]string) []Result {
+	writer := c.name + "-writer"
+	start := time.Now()
+	var volume string
+	var pod Pod
+	var bindTime time.Duration
+
+	results := []Result{}
+	steps := []func() Result{
+		func() Result {
+			name := "Bound claim " + c.name
+			c.pods = append(c.pods, writer)
+			if ko := env.RunCreate(ctx, claim(c.name, c.class, claimSize), claimPod(writer, c.name, registryImage("alpine:3.5"), "")); !ko.Success {
+				return ocResult(name, nil, ko)
+			}
+			r := waitUntil(ctx, name, "the claim to be bound", storageTimeout, func() bool {
+				var phase string
+				phase, volume = env.RunOCinNamespace(ctx, "get", "pvc", c.name, "-o", "json").ClaimPhase()
+				return phase == "Bound"
+			})
+			bindTime = time.Since(start)
+			r.Info = withInfo(info, "volume", volume, "bind time", bindTime.String())
+			return r
+		},
+		func() Result {
+			r := c.mount(ctx, env, writer, &pod)
+			r.Info = withInfo(info, "node", pod.Node, "attach time", (time.Since(start) - bindTime).String())
+			return r
+		},
+		func() Result {
+			name := "Wrote and read back a payload on claim " + c.name
+			script := "echo " + c.payload + " > " + payloadPath + " && sync"
+			if ko := env.RunOCinNamespace(ctx, "exec", pod.Name, "--", "sh", "-c", script); !ko.Success {
+				return ocResult(name, pod.target(), ko)
+			}
+			return c.read(ctx, env, name, pod, info)
+		},
+	}
+	if config.StorageRemount {
+		steps = append(steps, func() Result { return c.remount(ctx, env, pod, info) })
+	}
+	for _, step := range steps {
+		result := timed(step)
+		results = append(results, result)
+		if !result.Passed {
+			break
+		}
+	}
+	return results
+}
+
+// mount waits for the pod called name to be ready, i.e. for the claim to be
+// attached and mounted
+func (c *storageClaim) mount(ctx context.Context, env *Environment, name string, pod *Pod) Result {
+	return waitUntil(ctx, "Mounted claim "+c.name+" in pod "+name, "the pod to be ready", storageTimeout, func() bool {
+		pods := env.RunOCinNamespace(ctx, "get", "pods", "-l", "run="+name, "-o", "json").Pods()
+		if len(pods) == 0 || !pods[0].Ready {
+			return false
+		}
+		*pod = pods[0]
+		return true
+	})
+}
+
+// read expects pod to find the payload on the claim
+func (c *storageClaim) read(ctx context.Context, env *Environment, name string, pod Pod, info map[string]string) Result {
+	ko := env.RunOCinNamespace(ctx, "exec", pod.Name, "--", "grep", "-x", c.payload, payloadPath)
+	r := ocResult(name, pod.target(), ko)
+	r.Info = info
+	if !ko.Success && !ko.TimedOut {
+		r.Detail = "Payload " + c.payload + " not found in " + payloadPath + "\n" + ko.CombinedOut
+	}
+	return r
+}
+
+// remount deletes the writer pod and mounts the claim in a pod on another
+// node, which needs the volume to be detached first
+func (c *storageClaim) remount(ctx context.Context, env *Environment, writer Pod, info map[string]string) Result {
+	name := "Remounted claim " + c.name + " on another node and read back the payload"
+	if len(env.Nodes) < 2 {
+		return Result{Name: name, Detail: "Remounting needs a second schedulable node\n"}
+	}
+	start := time.Now()
+	if ko := env.RunOCinNamespace(ctx, "delete", "pod", writer.Name); !ko.Success {
+		return ocResult(name, writer.target(), ko)
+	}
+	reader := c.name + "-reader"
+	c.pods = append(c.pods, reader)
+	if ko := env.RunCreate(ctx, claimPod(reader, c.name, registryImage("alpine:3.5"), writer.Node)); !ko.Success {
+		return ocResult(name, nil, ko)
+	}
+	var pod Pod
+	if r := c.mount(ctx, env, reader, &pod); !r.Passed {
+		r.Name = name
+		return r
+	}
+	return c.read(ctx, env, name, pod, withInfo(info, "node", pod.Node, "attach time", time.Since(start).String()))
+}
+
+// delete removes the pods and the claim, the provisioned volume is released
+// with it
+func (c *storageClaim) delete(ctx context.Context, env *Environment) Result {
+	name := "Deleted claim " + c.name + " and its pods"
+	out := ""
+	for _, pod := range c.pods {
+		if ko := env.RunOCinNamespace(ctx, "delete", "pod", pod); !ko.Success && !strings.Contains(ko.CombinedOut, "NotFound") {
+			out += ko.CombinedOut
+		}
+	}
+	ko := env.RunOCinNamespace(ctx, "delete", "pvc", c.name)
+	if !ko.Success {
+		out += ko.CombinedOut
+	}
+	return Result{Name: name, Passed: out == "", TimedOut: ko.TimedOut, Detail: out}
+}
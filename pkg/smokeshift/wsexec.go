@@ -0,0 +1,308 @@
+package smokeshift
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// Pod exec over the websocket flavour of the Kubernetes streaming API.
+// Every binary message starts with the channel it belongs to, with the
+// v4.channel.k8s.io protocol the error channel carries a Status object
+// that holds the exit code of the command.
+
+const (
+	wsGUID            = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	execProtocol      = "v4.channel.k8s.io"
+	wsOpBinary        = 0x2
+	wsOpClose         = 0x8
+	wsOpPing          = 0x9
+	wsOpPong          = 0xA
+	execStdoutChannel = 1
+	execStderrChannel = 2
+	execErrorChannel  = 3
+)
+
+// execResult is the outcome of a command run in a pod
+type execResult struct {
+	Output   []byte
+	ExitCode int
+	Message  string
+}
+
+// execStatus is the Status sent on the error channel
+type execStatus struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	Reason  string `json:"reason"`
+	Details struct {
+		Causes []struct {
+			Reason  string `json:"reason"`
+			Message string `json:"message"`
+		} `json:"causes"`
+	} `json:"details"`
+}
+
+// websocketExec runs command in a container of the pod and collects
+// stdout and stderr in the order the API server sent them.
+func websocketExec(ctx context.Context, cfg *APIConfig, namespace, pod string, command []string) (*execResult, error) {
+	u, err := url.Parse(cfg.Server)
+	if err != nil {
+		return nil, err
+	}
+	query := url.Values{"stdout": {"true"}, "stderr": {"true"}, "command": command}
+	u.Path = u.Path + "/api/v1/namespaces/" + namespace + "/pods/" + pod + "/exec"
+	u.RawQuery = query.Encode()
+
+	conn, err := dialAPI(ctx, cfg, u)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	// Unblock reads and writes on the raw connection once ctx is done
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	keyBytes := make([]byte, 16)
+	if _, err := rand.Read(keyBytes); err != nil {
+		return nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(keyBytes)
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	req.Header.Set("Sec-WebSocket-Protocol", execProtocol)
+	setAuth(cfg, req)
+	if err := req.Write(conn); err != nil {
+		return nil, err
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, apiError(resp.StatusCode, body)
+	}
+	if resp.Header.Get("Sec-WebSocket-Accept") != websocketAccept(key) {
+		return nil, errors.New("invalid Sec-WebSocket-Accept from API server")
+	}
+
+	result := &execResult{}
+	var message []byte
+	for {
+		fin, opcode, payload, err := readWebsocketFrame(br)
+		if err == io.EOF {
+			return result, nil
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, err
+		}
+		switch opcode {
+		case wsOpPing:
+			writeWebsocketFrame(conn, wsOpPong, payload, true)
+			continue
+		case wsOpClose:
+			writeWebsocketFrame(conn, wsOpClose, nil, true)
+			return result, nil
+		case wsOpPong:
+			continue
+		}
+		message = append(message, payload...)
+		if !fin {
+			continue
+		}
+		if len(message) > 0 {
+			handleExecMessage(result, message)
+		}
+		message = nil
+	}
+}
+
+func handleExecMessage(result *execResult, message []byte) {
+	switch message[0] {
+	case execStdoutChannel, execStderrChannel:
+		result.Output = append(result.Output, message[1:]...)
+	case execErrorChannel:
+		if len(message) == 1 {
+			return
+		}
+		status := execStatus{}
+		if err := json.Unmarshal(message[1:], &status); err != nil {
+			result.ExitCode = 1
+			result.Message = string(message[1:])
+			return
+		}
+		if status.Status == "Success" {
+			return
+		}
+		result.ExitCode = 1
+		result.Message = status.Message
+		for _, cause := range status.Details.Causes {
+			if cause.Reason == "ExitCode" {
+				if code, err := strconv.Atoi(cause.Message); err == nil {
+					result.ExitCode = code
+				}
+			}
+		}
+	}
+}
+
+func dialAPI(ctx context.Context, cfg *APIConfig, u *url.URL) (net.Conn, error) {
+	host := u.Host
+	if u.Port() == "" {
+		if u.Scheme == "https" {
+			host = net.JoinHostPort(u.Hostname(), "443")
+		} else {
+			host = net.JoinHostPort(u.Hostname(), "80")
+		}
+	}
+	dialer := &net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", host)
+	if err != nil || u.Scheme != "https" {
+		return conn, err
+	}
+	tlsConfig := &tls.Config{}
+	if cfg.TLS != nil {
+		tlsConfig = cfg.TLS.Clone()
+	}
+	if tlsConfig.ServerName == "" {
+		tlsConfig.ServerName = u.Hostname()
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	tlsConn := tls.Client(conn, tlsConfig)
+	if err := tlsConn.Handshake(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+func websocketAccept(key string) string {
+	h := sha1.New()
+	io.WriteString(h, key+wsGUID)
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// readWebsocketFrame reads a single frame, unmasking the payload if needed
+func readWebsocketFrame(r io.Reader) (fin bool, opcode byte, payload []byte, err error) {
+	header := make([]byte, 2)
+	if _, err = io.ReadFull(r, header); err != nil {
+		return
+	}
+	fin = header[0]&0x80 != 0
+	opcode = header[0] & 0x0F
+	masked := header[1]&0x80 != 0
+	length := uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		ext := make([]byte, 2)
+		if _, err = io.ReadFull(r, ext); err != nil {
+			return
+		}
+		length = uint64(binary.BigEndian.Uint16(ext))
+	case 127:
+		ext := make([]byte, 8)
+		if _, err = io.ReadFull(r, ext); err != nil {
+			return
+		}
+		length = binary.BigEndian.Uint64(ext)
+	}
+	var mask []byte
+	if masked {
+		mask = make([]byte, 4)
+		if _, err = io.ReadFull(r, mask); err != nil {
+			return
+		}
+	}
+	payload = make([]byte, length)
+	if _, err = io.ReadFull(r, payload); err != nil {
+		return
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return
+}
+
+// writeWebsocketFrame writes a single final frame, clients must mask
+func writeWebsocketFrame(w io.Writer, opcode byte, payload []byte, mask bool) error {
+	var buf bytes.Buffer
+	buf.WriteByte(0x80 | opcode)
+	var maskBit byte
+	if mask {
+		maskBit = 0x80
+	}
+	switch {
+	case len(payload) < 126:
+		buf.WriteByte(maskBit | byte(len(payload)))
+	case len(payload) <= 0xFFFF:
+		buf.WriteByte(maskBit | 126)
+		binary.Write(&buf, binary.BigEndian, uint16(len(payload)))
+	default:
+		buf.WriteByte(maskBit | 127)
+		binary.Write(&buf, binary.BigEndian, uint64(len(payload)))
+	}
+	data := payload
+	if mask {
+		key := make([]byte, 4)
+		if _, err := rand.Read(key); err != nil {
+			return err
+		}
+		buf.Write(key)
+		data = make([]byte, len(payload))
+		for i := range payload {
+			data[i] = payload[i] ^ key[i%4]
+		}
+	}
+	buf.Write(data)
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func formatExecOutput(result *execResult) string {
+	out := string(result.Output)
+	if result.ExitCode != 0 {
+		out += fmt.Sprintf("command terminated with exit code %d\n", result.ExitCode)
+	}
+	return out
+}
@@ -3,6 +3,7 @@ package util
 import (
 	"fmt"
 	"io"
+	"strings"
 	"text/tabwriter"
 
 	"github.com/fatih/color"
@@ -10,13 +11,15 @@ import (
 
 const (
 	noType          = ""
-	infoType	= "[INFO]"
+	infoType        = "[INFO]"
 	okType          = "[OK]"
 	errType         = "[ERROR]"
 	skippedType     = "[SKIPPED]"
 	warnType        = "[WARNING]"
 	unreachableType = "[UNREACHABLE]"
 	errIgnoredType  = "[ERROR IGNORED]"
+	timeoutType     = "[TIMEOUT]"
+	timeoutIgnType  = "[TIMEOUT IGNORED]"
 )
 
 var Green = color.New(color.FgGreen)
@@ -29,12 +32,11 @@ func PrettyPrintOk(out io.Writer, msg string, a ...interface{}) {
 	print(out, msg, okType, a...)
 }
 
-//PrettyPrintInfo [INFO](Blue) with formatted string
+// PrettyPrintInfo [INFO](Blue) with formatted string
 func PrettyPrintInfo(out io.Writer, msg string, a ...interface{}) {
 	print(out, msg, infoType, a...)
 }
 
-
 // PrettyPrintErr [ERROR](Red) with formatted string
 func PrettyPrintErr(out io.Writer, msg string, a ...interface{}) {
 	print(out, msg, errType, a...)
@@ -55,6 +57,16 @@ func PrettyPrintErrorIgnored(out io.Writer, msg string, a ...interface{}) {
 	print(out, msg, errIgnoredType, a...)
 }
 
+// PrettyPrintTimeout [TIMEOUT](Red) with formatted string
+func PrettyPrintTimeout(out io.Writer, msg string, a ...interface{}) {
+	print(out, msg, timeoutType, a...)
+}
+
+// PrettyPrintTimeoutIgnored [TIMEOUT IGNORED](Orange) with formatted string
+func PrettyPrintTimeoutIgnored(out io.Writer, msg string, a ...interface{}) {
+	print(out, msg, timeoutIgnType, a...)
+}
+
 // PrettyPrintUnreachable [UNREACHABLE](Red) with formatted string
 func PrettyPrintUnreachable(out io.Writer, msg string, a ...interface{}) {
 	print(out, msg, unreachableType, a...)
@@ -99,6 +111,16 @@ func PrintHeader(out io.Writer, msg string) {
 	w.Flush()
 }
 
+// PrintTable prints rows as left aligned columns under an upper case header
+func PrintTable(out io.Writer, header []string, rows [][]string) {
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, strings.ToUpper(strings.Join(header, "\t")))
+	for _, row := range rows {
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	w.Flush()
+}
+
 // PrintColor prints text in color
 func PrintColor(out io.Writer, clr *color.Color, msg string, a ...interface{}) {
 	// Remove any newline, results in only one \n
@@ -119,9 +141,9 @@ func print(out io.Writer, msg, status string, a ...interface{}) {
 		switch status {
 		case okType:
 			clr = Green
-		case errType, unreachableType:
+		case errType, unreachableType, timeoutType:
 			clr = Red
-		case warnType, errIgnoredType:
+		case warnType, errIgnoredType, timeoutIgnType:
 			clr = Orange
 		case skippedType, infoType:
 			clr = Blue